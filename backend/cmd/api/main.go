@@ -1,13 +1,22 @@
 package main
 
 import (
+	"crypto/rand"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"study-quest-backend/internal/config"
+	"study-quest-backend/internal/events"
 	"study-quest-backend/internal/handler"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/mqtt"
+	"study-quest-backend/internal/password"
 	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/scheduler"
 	"study-quest-backend/internal/service"
+	"study-quest-backend/internal/storage"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,6 +28,30 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	hasher := password.NewHasher(cfg.Security.PasswordAlgorithm, cfg.Security.BcryptCost)
+
+	store, files, err := newStorage(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	proofService := service.NewProofService(store, cfg.Storage.MaxUploadMB<<20, cfg.Storage.URLTTL)
+
+	levels, err := service.NewLevelCurve(levelsFromConfig(cfg.Levels))
+	if err != nil {
+		log.Fatalf("Invalid level curve: %v", err)
+	}
+	bus := events.NewBus(cfg.Events.HistorySize)
+	devicePublisher, err := newDevicePublisher(cfg.MQTT)
+	if err != nil {
+		log.Fatalf("Failed to configure MQTT: %v", err)
+	}
+	deviceOptions := service.DeviceOptions{
+		TopicTemplate: cfg.MQTT.TopicTemplate,
+		QoS:           byte(cfg.MQTT.QoS),
+		Retain:        cfg.MQTT.Retain,
+		Format:        cfg.MQTT.Format,
+	}
+
 	// 2. Initialize Database
 	db, err := repository.InitDB(cfg.Database)
 	if err != nil {
@@ -27,16 +60,45 @@ func main() {
 		
 	// Fallback to memory repositories
 	taskRepo := repository.NewMemoryTaskRepository()
-	userRepo := repository.NewMemoryUserRepository()
+	userRepo := repository.NewMemoryUserRepository(hasher)
 	sessionRepo := repository.NewMemorySessionRepository()
-	redemptionRepo := repository.NewMemoryRedemptionRepository()
+	redemptionRepo := repository.NewMemoryRedemptionRepository(userRepo)
 	rewardRepo := repository.NewMemoryRewardRepository()
+	pointRepo := repository.NewMemoryPointRepository(taskRepo, userRepo, redemptionRepo, rewardRepo)
+	familyRepo := repository.NewMemoryFamilyRepository()
+	screenTimeRepo := repository.NewMemoryScreenTimeRepository(userRepo, redemptionRepo)
+	configRepo := repository.NewMemoryAppConfigRepository()
+	flagRepo := repository.NewMemoryFeatureFlagRepository()
+	idempotencyRepo := repository.NewMemoryIdempotencyRepository()
+	badgeRepo := repository.NewMemoryBadgeRepository()
+	webhookRepo := repository.NewMemoryWebhookRepository()
+	deviceRepo := repository.NewMemoryDeviceRepository()
 	
-	taskService := service.NewTaskService(taskRepo, userRepo, redemptionRepo, rewardRepo)
-	authService := service.NewAuthService(userRepo, sessionRepo)
-	h := handler.NewHandler(taskService, authService)
+	taskService := service.NewTaskService(taskRepo, userRepo, familyRepo, redemptionRepo, rewardRepo, pointRepo, badgeRepo, proofService, levels, bus)
+	familyService := service.NewFamilyService(familyRepo, userRepo, rewardRepo, taskRepo)
+	authService := service.NewAuthService(userRepo, sessionRepo, familyService, hasher, cfg.Security.PasswordMinLength, cfg.Security.AdminUsernames)
+	rewardService := service.NewRewardService(rewardRepo, userRepo)
+	screenTimeService := service.NewScreenTimeService(screenTimeRepo, userRepo, bus)
+	configService := service.NewConfigService(configRepo, cfg.Remote.CacheTTL)
+	featureService := service.NewFeatureService(flagRepo, cfg.Remote.CacheTTL)
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo)
+	webhookService := service.NewWebhookService(webhookRepo, userRepo, cfg.Webhooks.Timeout, cfg.Webhooks.MaxAttempts, cfg.Webhooks.RetryDelay, cfg.Webhooks.Retention, cfg.Webhooks.AllowPrivateNetworks)
+	bus.Listen(webhookService.Enqueue)
+	deviceService := service.NewDeviceService(deviceRepo, userRepo, screenTimeRepo, devicePublisher, deviceOptions)
+	bus.Listen(deviceService.Notify)
+	go deviceService.Run()
+	h := handler.NewHandler(taskService, authService, familyService, rewardService, screenTimeService, configService, featureService, proofService, idempotencyService, webhookService, deviceService, bus, cfg.Events.Heartbeat)
+
+	scheduler.NewScheduler(taskRepo, userRepo, familyRepo, cfg.Scheduler.Interval).
+		AddJob("expire-screen-time", 30*time.Second, screenTimeService.ExpireSessions).
+		AddJob("purge-idempotency-keys", time.Hour, idempotencyService.PurgeExpired).
+		AddJob("mark-overdue-tasks", time.Minute, taskService.MarkOverdueTasks).
+		AddJob("deliver-webhooks", cfg.Webhooks.Interval, webhookService.DeliverDue).
+		AddJob("purge-webhook-deliveries", time.Hour, webhookService.PurgeDeliveries).
+		AddJob("retry-device-commands", cfg.MQTT.RetryInterval, deviceService.RetryFailed).
+		Start()
 	
-	startServer(h, cfg.Server.Port)
+	startServer(h, files, cfg.Server.Port)
 	return
 	}
 
@@ -49,9 +111,12 @@ func main() {
 	log.Println("Database migrated successfully")
 
 	// 4. Seed Initial Data
-	if err := repository.SeedData(db); err != nil {
+	if err := repository.SeedData(db, hasher); err != nil {
 		log.Printf("Warning: Failed to seed data: %v", err)
 	}
+	if err := repository.SeedBadges(db); err != nil {
+		log.Printf("Warning: Failed to seed badges: %v", err)
+	}
 
 	// 5. Initialize Repositories (MySQL)
 	taskRepo := repository.NewMySQLTaskRepository(db)
@@ -59,19 +124,114 @@ func main() {
 	sessionRepo := repository.NewMySQLSessionRepository(db)
 	redemptionRepo := repository.NewMySQLRedemptionRepository(db)
 	rewardRepo := repository.NewMySQLRewardRepository(db)
+	pointRepo := repository.NewMySQLPointRepository(db)
+	familyRepo := repository.NewMySQLFamilyRepository(db)
+	screenTimeRepo := repository.NewMySQLScreenTimeRepository(db)
+	configRepo := repository.NewMySQLAppConfigRepository(db)
+	flagRepo := repository.NewMySQLFeatureFlagRepository(db)
+	idempotencyRepo := repository.NewMySQLIdempotencyRepository(db)
+	badgeRepo := repository.NewMySQLBadgeRepository(db)
+	webhookRepo := repository.NewMySQLWebhookRepository(db)
+	deviceRepo := repository.NewMySQLDeviceRepository(db)
 
 	// 6. Initialize Services
-	taskService := service.NewTaskService(taskRepo, userRepo, redemptionRepo, rewardRepo)
-	authService := service.NewAuthService(userRepo, sessionRepo)
+	taskService := service.NewTaskService(taskRepo, userRepo, familyRepo, redemptionRepo, rewardRepo, pointRepo, badgeRepo, proofService, levels, bus)
+	familyService := service.NewFamilyService(familyRepo, userRepo, rewardRepo, taskRepo)
+	authService := service.NewAuthService(userRepo, sessionRepo, familyService, hasher, cfg.Security.PasswordMinLength, cfg.Security.AdminUsernames)
+	rewardService := service.NewRewardService(rewardRepo, userRepo)
+	screenTimeService := service.NewScreenTimeService(screenTimeRepo, userRepo, bus)
+	configService := service.NewConfigService(configRepo, cfg.Remote.CacheTTL)
+	featureService := service.NewFeatureService(flagRepo, cfg.Remote.CacheTTL)
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo)
+	webhookService := service.NewWebhookService(webhookRepo, userRepo, cfg.Webhooks.Timeout, cfg.Webhooks.MaxAttempts, cfg.Webhooks.RetryDelay, cfg.Webhooks.Retention, cfg.Webhooks.AllowPrivateNetworks)
+	bus.Listen(webhookService.Enqueue)
+	deviceService := service.NewDeviceService(deviceRepo, userRepo, screenTimeRepo, devicePublisher, deviceOptions)
+	bus.Listen(deviceService.Notify)
+	go deviceService.Run()
 	
 	// 7. Initialize Handlers
-	h := handler.NewHandler(taskService, authService)
+	h := handler.NewHandler(taskService, authService, familyService, rewardService, screenTimeService, configService, featureService, proofService, idempotencyService, webhookService, deviceService, bus, cfg.Events.Heartbeat)
+
+	// 8. Start Recurring Task Scheduler and housekeeping jobs
+	scheduler.NewScheduler(taskRepo, userRepo, familyRepo, cfg.Scheduler.Interval).
+		AddJob("expire-screen-time", 30*time.Second, screenTimeService.ExpireSessions).
+		AddJob("purge-idempotency-keys", time.Hour, idempotencyService.PurgeExpired).
+		AddJob("mark-overdue-tasks", time.Minute, taskService.MarkOverdueTasks).
+		AddJob("deliver-webhooks", cfg.Webhooks.Interval, webhookService.DeliverDue).
+		AddJob("purge-webhook-deliveries", time.Hour, webhookService.PurgeDeliveries).
+		AddJob("retry-device-commands", cfg.MQTT.RetryInterval, deviceService.RetryFailed).
+		Start()
 	
-	startServer(h, cfg.Server.Port)
+	startServer(h, files, cfg.Server.Port)
+}
+
+// levelsFromConfig converts the configured level curve; an empty one selects
+// the built-in curve
+func levelsFromConfig(configured []config.LevelConfig) []service.Level {
+	levels := make([]service.Level, len(configured))
+	for i, level := range configured {
+		levels[i] = service.Level{Threshold: level.Threshold, Title: level.Title, Icon: level.Icon}
+	}
+	return levels
+}
+
+// newDevicePublisher connects device control to the configured MQTT broker;
+// without a broker it returns nil and devices are never switched
+func newDevicePublisher(cfg config.MQTTConfig) (service.DevicePublisher, error) {
+	if cfg.Broker == "" {
+		return nil, nil
+	}
+	if cfg.QoS != 0 && cfg.QoS != 1 {
+		return nil, fmt.Errorf("mqtt.qos must be 0 or 1")
+	}
+	client, err := mqtt.NewClient(mqtt.Options{
+		Broker:    cfg.Broker,
+		ClientID:  cfg.ClientID,
+		Username:  cfg.Username,
+		Password:  cfg.Password,
+		KeepAlive: cfg.KeepAlive,
+		Timeout:   cfg.Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Device commands are published to %s", cfg.Broker)
+	return client, nil
 }
 
-func startServer(h *handler.Handler, port string) {
+// newStorage creates the configured file storage. For the local driver it
+// also returns the handler serving its signed URLs.
+func newStorage(cfg config.StorageConfig) (storage.Storage, http.Handler, error) {
+	if cfg.Driver == "s3" {
+		store, err := storage.NewS3(cfg.S3.Endpoint, cfg.S3.Region, cfg.S3.Bucket, cfg.S3.AccessKey, cfg.S3.SecretKey)
+		return store, nil, err
+	}
+
+	secret := []byte(cfg.SigningKey)
+	if len(secret) == 0 {
+		log.Println("storage.signing_key is not set; file URLs will stop working after a restart")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	store, err := storage.NewLocal(cfg.LocalDir, cfg.PublicURL, secret)
+	return store, store, err
+}
+
+func startServer(h *handler.Handler, files http.Handler, port string) {
+	r := newRouter(h, files)
+
+	// Start Server
+	if port == "" {
+		port = "8080"
+	}
+	log.Printf("Server starting on port %s...", port)
+	log.Printf("Open http://localhost:%s/web to view the demo", port)
+	r.Run(":" + port)
+}
 
+// newRouter registers the web demo, the uploaded files and the API routes
+// with their authentication and role checks
+func newRouter(h *handler.Handler, files http.Handler) *gin.Engine {
 	// Setup Router
 	r := gin.Default()
 	r.Use(corsMiddleware())
@@ -85,6 +245,10 @@ func startServer(h *handler.Handler, port string) {
 		webDir = "../../web"
 	}
 	r.Static("/web", webDir)
+	if files != nil {
+		// Uploaded files, only reachable through signed URLs
+		r.GET("/files/*key", gin.WrapH(http.StripPrefix("/files", files)))
+	}
 	r.GET("/", func(c *gin.Context) {
 		c.Redirect(http.StatusMovedPermanently, "/web")
 	})
@@ -97,48 +261,118 @@ func startServer(h *handler.Handler, port string) {
 		api.POST("/auth/register", h.Register)
 		api.POST("/auth/login", h.Login)
 		api.POST("/auth/logout", h.Logout)
-		
-		// Ranking (public)
-		api.GET("/ranking", h.GetRanking)
 	}
 	
 	// Protected routes (require authentication)
 	protected := r.Group("/api/v1")
-	protected.Use(h.AuthMiddleware())
+	protected.Use(h.AuthMiddleware(), h.Idempotent())
 	{
 		// Tasks
 		protected.GET("/tasks/today", h.GetTodayTasks)
-		protected.GET("/tasks/pending", h.GetPendingTasks)
-		protected.POST("/tasks/create", h.CreateTask)
-		protected.POST("/tasks/submit", h.SubmitTask)
-		protected.POST("/tasks/approve", h.ApproveTask)
+		protected.POST("/tasks/submit", h.RequireRole("student"), h.SubmitTask)
+		protected.GET("/tasks/history", h.GetTaskHistory)
+		protected.GET("/tasks/comments", h.GetTaskComments)
+		protected.POST("/tasks/comments", h.AddTaskComment)
 
 		// Profile
 		protected.GET("/profile", h.GetProfile)
+		protected.POST("/profile/level-ups/ack", h.AcknowledgeLevelUps)
+		protected.GET("/levels", h.GetLevels)
+		protected.GET("/badges", h.GetBadges)
+		protected.GET("/events", h.StreamEvents)
+		protected.POST("/auth/password", h.ChangePassword)
+		protected.GET("/points/transactions", h.GetPointTransactions)
+
+		// Ranking (within the family)
+		protected.GET("/ranking", h.GetRanking)
+
+		// Family
+		protected.GET("/family", h.GetFamily)
+		protected.POST("/family/join", h.JoinFamily)
 		
 	// Rewards
 	protected.GET("/rewards", h.GetRewards)
-	protected.POST("/rewards/redeem", h.RedeemReward)
-	protected.GET("/redemptions", h.GetRedemptions)
-	
-	// Students
-	protected.GET("/students", h.GetStudentList)
+	protected.GET("/rewards/categories", h.GetRewardCategories)
+	protected.POST("/rewards/redeem", h.RequireRole("student"), h.RequireFeature(model.FeatureMall), h.RedeemReward)
+
+		// Screen time
+		protected.GET("/screen-time", h.GetScreenTime)
+		protected.POST("/screen-time/start", h.RequireRole("student"), h.StartScreenTime)
+		protected.POST("/screen-time/pause", h.RequireRole("student"), h.PauseScreenTime)
+		protected.POST("/screen-time/stop", h.StopScreenTime)
+
+		// Redemptions (parents see the family, students their own)
+		protected.GET("/redemptions", h.GetRedemptions)
+		protected.POST("/redemptions/cancel", h.RequireRole("student"), h.CancelRedemption)
 	}
 
-	// Start Server
-	if port == "" {
-		port = "8080"
+	// Parent-only routes
+	parent := r.Group("/api/v1")
+	parent.Use(h.AuthMiddleware(), h.RequireRole("parent"), h.Idempotent())
+	{
+		parent.GET("/tasks/pending", h.GetPendingTasks)
+		parent.GET("/tasks", h.GetTasks)
+		parent.POST("/tasks/create", h.CreateTask)
+		parent.POST("/tasks/update", h.UpdateTask)
+		parent.POST("/tasks/archive", h.ArchiveTask)
+		parent.POST("/tasks/delete", h.DeleteTask)
+		parent.POST("/tasks/approve", h.ApproveTask)
+		parent.GET("/students", h.GetStudentList)
+		parent.POST("/family/invites", h.CreateFamilyInvite)
+		parent.POST("/family/settings", h.UpdateFamilySettings)
+		parent.POST("/family/members/remove", h.RemoveFamilyMember)
+
+		// Reward catalog
+		parent.POST("/rewards/create", h.CreateReward)
+		parent.POST("/rewards/update", h.UpdateReward)
+		parent.POST("/rewards/archive", h.ArchiveReward)
+		parent.POST("/rewards/restock", h.RestockReward)
+		parent.POST("/rewards/reorder", h.ReorderRewards)
+
+		parent.GET("/screen-time/sessions", h.GetScreenTimeSessions)
+
+		// Redemption fulfillment
+		parent.POST("/redemptions/approve", h.ApproveRedemption)
+		parent.POST("/redemptions/fulfill", h.FulfillRedemption)
+		parent.POST("/redemptions/reject", h.RejectRedemption)
+
+		// Webhooks
+		parent.GET("/webhooks", h.ListWebhooks)
+		parent.POST("/webhooks/create", h.CreateWebhook)
+		parent.POST("/webhooks/update", h.UpdateWebhook)
+		parent.POST("/webhooks/delete", h.DeleteWebhook)
+		parent.POST("/webhooks/test", h.TestWebhook)
+		parent.GET("/webhooks/deliveries", h.GetWebhookDeliveries)
+
+		// Devices switched with screen time over MQTT
+		parent.GET("/devices", h.ListDevices)
+		parent.POST("/devices/create", h.CreateDevice)
+		parent.POST("/devices/update", h.UpdateDevice)
+		parent.POST("/devices/delete", h.DeleteDevice)
+		parent.POST("/devices/test", h.TestDevice)
 	}
-	log.Printf("Server starting on port %s...", port)
-	log.Printf("Open http://localhost:%s/web to view the demo", port)
-	r.Run(":" + port)
+
+	// Admin-only routes (security.admin_usernames)
+	admin := r.Group("/api/v1/admin")
+	admin.Use(h.AuthMiddleware(), h.RequireAdmin(), h.Idempotent())
+	{
+		admin.GET("/configs", h.ListAppConfigs)
+		admin.POST("/configs", h.SaveAppConfig)
+		admin.POST("/configs/delete", h.DeleteAppConfig)
+		admin.GET("/flags", h.ListFeatureFlags)
+		admin.POST("/flags", h.SaveFeatureFlag)
+		admin.POST("/flags/override", h.SetFeatureOverride)
+	}
+
+	return r
 }
 
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Idempotency-Key, Last-Event-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Idempotent-Replayed")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
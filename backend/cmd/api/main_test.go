@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"study-quest-backend/internal/events"
+	"study-quest-backend/internal/handler"
+	"study-quest-backend/internal/password"
+	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Who may call a route
+const (
+	accessPublic  = "public"
+	accessAny     = "any" // any signed-in user
+	accessParent  = "parent"
+	accessStudent = "student"
+	accessAdmin   = "admin"
+)
+
+var apiRoutes = []struct {
+	method string
+	path   string
+	access string
+	body   string // "{}" when empty
+}{
+	{"GET", "/api/v1/config/init", accessPublic, ""},
+	{"POST", "/api/v1/auth/register", accessPublic, ""},
+	{"POST", "/api/v1/auth/login", accessPublic, `{"username":"student1","password":"123456"}`},
+	{"POST", "/api/v1/auth/logout", accessPublic, ""},
+
+	{"GET", "/api/v1/tasks/today", accessAny, ""},
+	{"POST", "/api/v1/tasks/submit", accessStudent, ""},
+	{"GET", "/api/v1/tasks/history", accessAny, ""},
+	{"GET", "/api/v1/tasks/comments", accessAny, ""},
+	{"POST", "/api/v1/tasks/comments", accessAny, ""},
+	{"GET", "/api/v1/profile", accessAny, ""},
+	{"POST", "/api/v1/profile/level-ups/ack", accessAny, ""},
+	{"GET", "/api/v1/levels", accessAny, ""},
+	{"GET", "/api/v1/badges", accessAny, ""},
+	{"GET", "/api/v1/events", accessAny, ""},
+	{"POST", "/api/v1/auth/password", accessAny, ""},
+	{"GET", "/api/v1/points/transactions", accessAny, ""},
+	{"GET", "/api/v1/ranking", accessAny, ""},
+	{"GET", "/api/v1/family", accessAny, ""},
+	{"POST", "/api/v1/family/join", accessAny, ""},
+	{"GET", "/api/v1/rewards", accessAny, ""},
+	{"GET", "/api/v1/rewards/categories", accessAny, ""},
+	{"POST", "/api/v1/rewards/redeem", accessStudent, ""},
+	{"GET", "/api/v1/screen-time", accessAny, ""},
+	{"POST", "/api/v1/screen-time/start", accessStudent, ""},
+	{"POST", "/api/v1/screen-time/pause", accessStudent, ""},
+	{"POST", "/api/v1/screen-time/stop", accessAny, ""},
+	{"GET", "/api/v1/redemptions", accessAny, ""},
+	{"POST", "/api/v1/redemptions/cancel", accessStudent, ""},
+
+	{"GET", "/api/v1/tasks/pending", accessParent, ""},
+	{"GET", "/api/v1/tasks", accessParent, ""},
+	{"POST", "/api/v1/tasks/create", accessParent, ""},
+	{"POST", "/api/v1/tasks/update", accessParent, ""},
+	{"POST", "/api/v1/tasks/archive", accessParent, ""},
+	{"POST", "/api/v1/tasks/delete", accessParent, ""},
+	{"POST", "/api/v1/tasks/approve", accessParent, ""},
+	{"GET", "/api/v1/students", accessParent, ""},
+	{"POST", "/api/v1/family/invites", accessParent, ""},
+	{"POST", "/api/v1/family/settings", accessParent, ""},
+	{"POST", "/api/v1/family/members/remove", accessParent, ""},
+	{"POST", "/api/v1/rewards/create", accessParent, ""},
+	{"POST", "/api/v1/rewards/update", accessParent, ""},
+	{"POST", "/api/v1/rewards/archive", accessParent, ""},
+	{"POST", "/api/v1/rewards/restock", accessParent, ""},
+	{"POST", "/api/v1/rewards/reorder", accessParent, ""},
+	{"GET", "/api/v1/screen-time/sessions", accessParent, ""},
+	{"POST", "/api/v1/redemptions/approve", accessParent, ""},
+	{"POST", "/api/v1/redemptions/fulfill", accessParent, ""},
+	{"POST", "/api/v1/redemptions/reject", accessParent, ""},
+	{"GET", "/api/v1/webhooks", accessParent, ""},
+	{"POST", "/api/v1/webhooks/create", accessParent, ""},
+	{"POST", "/api/v1/webhooks/update", accessParent, ""},
+	{"POST", "/api/v1/webhooks/delete", accessParent, ""},
+	{"POST", "/api/v1/webhooks/test", accessParent, ""},
+	{"GET", "/api/v1/webhooks/deliveries", accessParent, ""},
+	{"GET", "/api/v1/devices", accessParent, ""},
+	{"POST", "/api/v1/devices/create", accessParent, ""},
+	{"POST", "/api/v1/devices/update", accessParent, ""},
+	{"POST", "/api/v1/devices/delete", accessParent, ""},
+	{"POST", "/api/v1/devices/test", accessParent, ""},
+
+	{"GET", "/api/v1/admin/configs", accessAdmin, ""},
+	{"POST", "/api/v1/admin/configs", accessAdmin, ""},
+	{"POST", "/api/v1/admin/configs/delete", accessAdmin, ""},
+	{"GET", "/api/v1/admin/flags", accessAdmin, ""},
+	{"POST", "/api/v1/admin/flags", accessAdmin, ""},
+	{"POST", "/api/v1/admin/flags/override", accessAdmin, ""},
+}
+
+// TestRouteRoles calls every API route as a parent, a student and without
+// a token, and checks that the role checks let exactly the right callers
+// through. Requests carry an empty body, so allowed calls usually end in a
+// validation error; what matters is that they are not 401 or 403.
+func TestRouteRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := newTestApp(t)
+	router := newRouter(app.handler, nil)
+
+	usernames := map[string]string{"parent": "parent1", "student": "student1", "anonymous": ""}
+
+	for _, route := range apiRoutes {
+		for caller, username := range usernames {
+			want := expectedAccess(route.access, caller)
+			t.Run(caller+" "+route.method+" "+route.path, func(t *testing.T) {
+				// A fresh session each time: /auth/logout ends the one it gets
+				var token string
+				if username != "" {
+					var err error
+					if _, token, err = app.auth.Login(username, "123456"); err != nil {
+						t.Fatalf("login %s: %v", username, err)
+					}
+				}
+				status, body := call(router, route.method, route.path, route.body, token)
+				switch want {
+				case http.StatusOK:
+					if status == http.StatusUnauthorized || status == http.StatusForbidden {
+						t.Errorf("got %d %s, want the request to be let through", status, body)
+					}
+				default:
+					if status != want {
+						t.Errorf("got %d %s, want %d", status, body, want)
+					}
+				}
+			})
+		}
+	}
+}
+
+// TestRouteTableIsComplete makes sure new API routes are added to the
+// table above
+func TestRouteTableIsComplete(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := newTestApp(t)
+	known := make(map[string]bool, len(apiRoutes))
+	for _, route := range apiRoutes {
+		known[route.method+" "+route.path] = true
+	}
+	for _, route := range newRouter(app.handler, nil).Routes() {
+		if strings.HasPrefix(route.Path, "/api/") && !known[route.Method+" "+route.Path] {
+			t.Errorf("%s %s is missing from apiRoutes", route.Method, route.Path)
+		}
+	}
+}
+
+// TestEventStreamEndsWhenLeavingFamily makes sure a student who is removed
+// from their family stops receiving its events on an open stream
+func TestEventStreamEndsWhenLeavingFamily(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	app := newTestApp(t)
+	server := httptest.NewServer(newRouter(app.handler, nil))
+	defer server.Close()
+
+	_, token, err := app.auth.Login("student1", "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/events", nil)
+	req.Header.Set("Authorization", token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	// next returns the next event type on the stream, or "" once it ends
+	next := func() string {
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					return ""
+				}
+				if strings.HasPrefix(line, "event: ") {
+					return strings.TrimPrefix(line, "event: ")
+				}
+			case <-timeout:
+				t.Fatal("timed out waiting for the stream")
+			}
+		}
+	}
+
+	// The stream starts with a retry hint once it has subscribed
+	if line := <-lines; !strings.HasPrefix(line, "retry:") {
+		t.Fatalf("first line = %q, want the retry hint", line)
+	}
+	app.bus.Publish(events.Event{Type: events.PointsChanged, FamilyID: 1, StudentID: 1})
+	if got := next(); got != events.PointsChanged {
+		t.Fatalf("first event = %q, want %s", got, events.PointsChanged)
+	}
+
+	if err := app.family.RemoveMember(2, 1); err != nil {
+		t.Fatal(err)
+	}
+	app.bus.Publish(events.Event{Type: events.RedemptionUpdated, FamilyID: 1, StudentID: 1})
+	if got := next(); got != "" {
+		t.Fatalf("got %q after leaving the family, want the stream to end", got)
+	}
+}
+
+// expectedAccess is http.StatusOK when caller may use a route with the
+// given access, otherwise the status the role checks answer with
+func expectedAccess(access string, caller string) int {
+	switch {
+	case access == accessPublic:
+		return http.StatusOK
+	case caller == "anonymous":
+		return http.StatusUnauthorized
+	case access == accessAny || access == caller:
+		return http.StatusOK
+	}
+	return http.StatusForbidden
+}
+
+func call(router http.Handler, method string, path string, body string, token string) (int, string) {
+	var req *http.Request
+	if method == http.MethodPost {
+		if body == "" {
+			body = "{}"
+		}
+		req = httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req = httptest.NewRequest(method, path, nil)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	// The event stream stays open until the client leaves
+	ctx, cancel := context.WithTimeout(req.Context(), 200*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req.WithContext(ctx))
+	return w.Code, strings.TrimSpace(w.Body.String())
+}
+
+type testApp struct {
+	handler *handler.Handler
+	auth    *service.AuthService
+	family  *service.FamilyService
+	bus     *events.Bus
+}
+
+// newTestApp wires the handler to the in-memory repositories, which come
+// with the demo family (parent1 and student1, password 123456)
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	hasher := password.NewHasher(password.AlgorithmBcrypt, 4)
+	levels, err := service.NewLevelCurve(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := events.NewBus(100)
+	proofService := service.NewProofService(nil, 1<<20, time.Minute)
+
+	taskRepo := repository.NewMemoryTaskRepository()
+	userRepo := repository.NewMemoryUserRepository(hasher)
+	sessionRepo := repository.NewMemorySessionRepository()
+	redemptionRepo := repository.NewMemoryRedemptionRepository(userRepo)
+	rewardRepo := repository.NewMemoryRewardRepository()
+	pointRepo := repository.NewMemoryPointRepository(taskRepo, userRepo, redemptionRepo, rewardRepo)
+	familyRepo := repository.NewMemoryFamilyRepository()
+	screenTimeRepo := repository.NewMemoryScreenTimeRepository(userRepo, redemptionRepo)
+
+	taskService := service.NewTaskService(taskRepo, userRepo, familyRepo, redemptionRepo, rewardRepo, pointRepo, repository.NewMemoryBadgeRepository(), proofService, levels, bus)
+	familyService := service.NewFamilyService(familyRepo, userRepo, rewardRepo, taskRepo)
+	authService := service.NewAuthService(userRepo, sessionRepo, familyService, hasher, 8, nil)
+	h := handler.NewHandler(
+		taskService,
+		authService,
+		familyService,
+		service.NewRewardService(rewardRepo, userRepo),
+		service.NewScreenTimeService(screenTimeRepo, userRepo, bus),
+		service.NewConfigService(repository.NewMemoryAppConfigRepository(), time.Minute),
+		service.NewFeatureService(repository.NewMemoryFeatureFlagRepository(), time.Minute),
+		proofService,
+		service.NewIdempotencyService(repository.NewMemoryIdempotencyRepository()),
+		service.NewWebhookService(repository.NewMemoryWebhookRepository(), userRepo, time.Second, 1, time.Second, time.Hour, false),
+		service.NewDeviceService(repository.NewMemoryDeviceRepository(), userRepo, screenTimeRepo, nil, service.DeviceOptions{}),
+		bus,
+		time.Minute,
+	)
+	return &testApp{handler: h, auth: authService, family: familyService, bus: bus}
+}
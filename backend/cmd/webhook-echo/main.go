@@ -0,0 +1,67 @@
+// Command webhook-echo is a local stand-in for a webhook receiver. It prints
+// every delivery, checks its signature and can fail on purpose to exercise
+// the retries:
+//
+//	go run ./cmd/webhook-echo -addr :9090 -secret whsec_... -fail 2
+package main
+
+import (
+	"crypto/hmac"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"study-quest-backend/internal/service"
+	"sync"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "address to listen on")
+	secret := flag.String("secret", "", "webhook secret used to check signatures; empty skips the check")
+	fail := flag.Int("fail", 0, "answer this many deliveries with 500 before accepting")
+	flag.Parse()
+
+	var mu sync.Mutex
+	failures := *fail
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		valid := "unchecked"
+		if *secret != "" {
+			expected := "sha256=" + service.SignWebhook(*secret, r.Header.Get(service.WebhookTimestampHeader), body)
+			valid = "invalid"
+			if hmac.Equal([]byte(expected), []byte(r.Header.Get(service.WebhookSignatureHeader))) {
+				valid = "valid"
+			}
+		}
+		log.Printf("%s %s event=%s delivery=%s signature=%s\n%s",
+			r.Method, r.URL.Path,
+			r.Header.Get(service.WebhookEventHeader),
+			r.Header.Get(service.WebhookDeliveryHeader),
+			valid, strings.TrimSpace(string(body)))
+
+		if valid == "invalid" {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		failing := failures > 0
+		if failing {
+			failures--
+		}
+		mu.Unlock()
+		if failing {
+			http.Error(w, "failing on purpose", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Printf("Webhook echo listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
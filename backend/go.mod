@@ -7,6 +7,7 @@ toolchain go1.24.4
 require (
 	github.com/gin-gonic/gin v1.9.1
 	github.com/spf13/viper v1.21.0
+	golang.org/x/crypto v0.9.0
 	gorm.io/driver/mysql v1.6.0
 	gorm.io/gorm v1.30.0
 )
@@ -43,7 +44,6 @@ require (
 	github.com/ugorji/go/codec v1.2.11 // indirect
 	go.yaml.in/yaml/v3 v3.0.4 // indirect
 	golang.org/x/arch v0.3.0 // indirect
-	golang.org/x/crypto v0.9.0 // indirect
 	golang.org/x/net v0.10.0 // indirect
 	golang.org/x/sys v0.29.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
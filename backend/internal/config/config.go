@@ -2,12 +2,30 @@ package config
 
 import (
 	"os"
+	"time"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
+	Server    ServerConfig
+	Database  DatabaseConfig
+	Scheduler SchedulerConfig
+	Security  SecurityConfig
+	Remote    RemoteConfig `mapstructure:"remote_config"`
+	Storage   StorageConfig
+	Events    EventsConfig
+	Webhooks  WebhooksConfig
+	MQTT      MQTTConfig
+	// Levels is the level curve; the built-in curve is used when empty
+	Levels []LevelConfig
+}
+
+// LevelConfig is one step of the level curve, reached once a student has
+// earned Threshold points in total
+type LevelConfig struct {
+	Threshold int
+	Title     string
+	Icon      string
 }
 
 type ServerConfig struct {
@@ -18,9 +36,100 @@ type DatabaseConfig struct {
 	DSN string // Data Source Name
 }
 
+type SecurityConfig struct {
+	PasswordAlgorithm string `mapstructure:"password_algorithm"` // 'bcrypt' or 'argon2id'
+	BcryptCost        int    `mapstructure:"bcrypt_cost"`
+	PasswordMinLength int    `mapstructure:"password_min_length"`
+	// AdminUsernames may edit app-wide settings such as review mode
+	AdminUsernames []string `mapstructure:"admin_usernames"`
+}
+
+type StorageConfig struct {
+	Driver      string        // 'local' or 's3'
+	LocalDir    string        `mapstructure:"local_dir"`
+	PublicURL   string        `mapstructure:"public_url"`  // URL prefix the local driver serves files under
+	SigningKey  string        `mapstructure:"signing_key"` // HMAC key for local signed URLs
+	URLTTL      time.Duration `mapstructure:"url_ttl"`
+	MaxUploadMB int           `mapstructure:"max_upload_mb"`
+	S3          S3Config
+}
+
+type S3Config struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string `mapstructure:"access_key"`
+	SecretKey string `mapstructure:"secret_key"`
+}
+
+type EventsConfig struct {
+	HistorySize int           `mapstructure:"history_size"` // Events kept per family for clients resuming with Last-Event-ID
+	Heartbeat   time.Duration // Comment sent on idle streams so proxies keep them open
+}
+
+type WebhooksConfig struct {
+	Interval    time.Duration // How often due deliveries are sent
+	Timeout     time.Duration // Per request
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	RetryDelay  time.Duration `mapstructure:"retry_delay"` // Delay before the first retry; doubled after every failure
+	Retention   time.Duration // How long finished deliveries are kept in the log
+	// AllowPrivateNetworks lets webhooks reach loopback and private
+	// addresses; for local development only
+	AllowPrivateNetworks bool `mapstructure:"allow_private_networks"`
+}
+
+// MQTTConfig is the broker the device commands are published to; device
+// control is off while Broker is empty
+type MQTTConfig struct {
+	Broker        string        // e.g. "tcp://127.0.0.1:1883" or "tls://broker.example.com:8883"
+	ClientID      string        `mapstructure:"client_id"`
+	Username      string
+	Password      string
+	TopicTemplate string        `mapstructure:"topic_template"` // Topic of devices without their own; may use {family_id}, {device_id}, {student_id}
+	QoS           int           `mapstructure:"qos"`            // 0 or 1
+	Retain        bool          // Keep the latest command on the broker for devices that reconnect
+	Format        string        // 'json' or 'plain' ("ON"/"OFF")
+	Timeout       time.Duration // Connecting and waiting for acknowledgements
+	KeepAlive     time.Duration `mapstructure:"keep_alive"`
+	RetryInterval time.Duration `mapstructure:"retry_interval"` // How often commands that could not be sent are retried
+}
+
+type RemoteConfig struct {
+	CacheTTL time.Duration `mapstructure:"cache_ttl"` // How long app_configs are cached in-process
+}
+
+type SchedulerConfig struct {
+	Interval time.Duration // How often recurring tasks are materialized
+}
+
 func LoadConfig() (*Config, error) {
 	// Set defaults
 	viper.SetDefault("server.port", "8080")
+	viper.SetDefault("scheduler.interval", "10m")
+	viper.SetDefault("security.password_algorithm", "bcrypt")
+	viper.SetDefault("security.bcrypt_cost", 10)
+	viper.SetDefault("security.password_min_length", 8)
+	viper.SetDefault("remote_config.cache_ttl", "1m")
+	viper.SetDefault("storage.driver", "local")
+	viper.SetDefault("storage.local_dir", "./uploads")
+	viper.SetDefault("storage.public_url", "/files")
+	viper.SetDefault("storage.url_ttl", "15m")
+	viper.SetDefault("storage.max_upload_mb", 5)
+	viper.SetDefault("storage.s3.region", "us-east-1")
+	viper.SetDefault("events.history_size", 200)
+	viper.SetDefault("events.heartbeat", "25s")
+	viper.SetDefault("webhooks.interval", "5s")
+	viper.SetDefault("webhooks.timeout", "10s")
+	viper.SetDefault("webhooks.max_attempts", 6)
+	viper.SetDefault("webhooks.retry_delay", "30s")
+	viper.SetDefault("webhooks.retention", "720h")
+	viper.SetDefault("mqtt.client_id", "study-quest")
+	viper.SetDefault("mqtt.qos", 1)
+	viper.SetDefault("mqtt.retain", true)
+	viper.SetDefault("mqtt.format", "json")
+	viper.SetDefault("mqtt.timeout", "10s")
+	viper.SetDefault("mqtt.keep_alive", "60s")
+	viper.SetDefault("mqtt.retry_interval", "1m")
 	
 	// Get DSN from environment or use default
 	dsn := os.Getenv("MYSQL_DSN")
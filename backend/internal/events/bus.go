@@ -0,0 +1,184 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published by the services
+const (
+	TaskSubmitted  = "task.submitted"
+	TaskApproved   = "task.approved"
+	TaskRejected   = "task.rejected"
+	RewardRedeemed = "reward.redeemed"
+	// RedemptionUpdated follows a redemption through approval, fulfilment,
+	// rejection or cancellation
+	RedemptionUpdated = "redemption.updated"
+	PointsChanged     = "points.changed"
+	// ScreenTimeStarted and ScreenTimeEnded follow the clock of a screen
+	// time session: started or resumed, and paused, stopped or used up
+	ScreenTimeStarted = "screen_time.started"
+	ScreenTimeEnded   = "screen_time.ended"
+	// Ping is only sent to test a webhook
+	Ping = "ping"
+)
+
+// Types lists the event types clients may filter on
+var Types = []string{TaskSubmitted, TaskApproved, TaskRejected, RewardRedeemed, RedemptionUpdated, PointsChanged, ScreenTimeStarted, ScreenTimeEnded}
+
+// Event is something that happened in a family. StudentID is the student it
+// is about; students only receive their own events, parents all of them.
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      string      `json:"type"`
+	FamilyID  uint        `json:"family_id"`
+	StudentID uint        `json:"student_id,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind before
+// it is dropped and has to resume from its last event ID
+const subscriberBuffer = 64
+
+// Bus fans events out to the subscribers of a family and keeps the latest
+// events of every family so that clients can resume after a reconnect. It
+// lives in the process: events are not shared between instances and are
+// gone after a restart.
+type Bus struct {
+	mu          sync.Mutex
+	firstID     uint64
+	nextID      uint64
+	historySize int
+	families    map[uint]*family
+	listeners   []func(Event)
+}
+
+type family struct {
+	history     []Event
+	dropped     uint64 // ID of the newest event that fell out of history
+	subscribers map[*Subscription]bool
+}
+
+// Subscription receives the live events of one family. C is closed when the
+// subscriber fell too far behind or was unsubscribed.
+type Subscription struct {
+	C <-chan Event
+	// LastID is the ID of the last event published before the subscription
+	// started; a client that has to reload can resume from it
+	LastID   uint64
+	ch       chan Event
+	familyID uint
+}
+
+// NewBus keeps the last historySize events of every family. IDs start at
+// the current time in microseconds, so IDs from before a restart are always
+// older than any new event.
+func NewBus(historySize int) *Bus {
+	if historySize <= 0 {
+		historySize = 200
+	}
+	first := uint64(time.Now().UnixMicro())
+	return &Bus{
+		firstID:     first,
+		nextID:      first,
+		historySize: historySize,
+		families:    make(map[uint]*family),
+	}
+}
+
+func (b *Bus) family(familyID uint) *family {
+	f, ok := b.families[familyID]
+	if !ok {
+		f = &family{subscribers: make(map[*Subscription]bool)}
+		b.families[familyID] = f
+	}
+	return f
+}
+
+// Listen registers fn to be called with every event of every family, such
+// as the webhook queue. It must be called before events are published; fn
+// runs on the publisher's goroutine after the subscribers got the event.
+func (b *Bus) Listen(fn func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners = append(b.listeners, fn)
+}
+
+// Publish assigns the event its ID and time and delivers it. It never
+// blocks on subscribers: one whose buffer is full is dropped. Publishing on
+// a nil bus does nothing.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	event = b.fanOut(event)
+	for _, listen := range b.listeners {
+		listen(event)
+	}
+}
+
+func (b *Bus) fanOut(event Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event.ID = b.nextID
+	b.nextID++
+	event.CreatedAt = time.Now()
+
+	f := b.family(event.FamilyID)
+	f.history = append(f.history, event)
+	if over := len(f.history) - b.historySize; over > 0 {
+		f.dropped = f.history[over-1].ID
+		f.history = append([]Event(nil), f.history[over:]...)
+	}
+	for sub := range f.subscribers {
+		select {
+		case sub.ch <- event:
+		default:
+			delete(f.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+	return event
+}
+
+// Subscribe starts receiving the family's events. With a lastID from an
+// earlier stream it also returns the events published after it. complete is
+// false when some of those are no longer known (too old, or from before a
+// restart); then nothing is returned and the client should reload its data
+// instead.
+func (b *Bus) Subscribe(familyID uint, lastID uint64) (sub *Subscription, missed []Event, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: ch, LastID: b.nextID - 1, ch: ch, familyID: familyID}
+	f := b.family(familyID)
+	f.subscribers[sub] = true
+
+	if lastID == 0 {
+		return sub, nil, true
+	}
+	if lastID+1 < b.firstID || lastID < f.dropped || lastID >= b.nextID {
+		return sub, nil, false
+	}
+	for _, event := range f.history {
+		if event.ID > lastID {
+			missed = append(missed, event)
+		}
+	}
+	return sub, missed, true
+}
+
+// Unsubscribe stops the subscription; it is safe to call more than once
+func (b *Bus) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f := b.families[sub.familyID]
+	if f == nil || !f.subscribers[sub] {
+		return
+	}
+	delete(f.subscribers, sub)
+	close(sub.ch)
+}
@@ -0,0 +1,68 @@
+package feature
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"study-quest-backend/internal/model"
+)
+
+// Context is what a flag is evaluated against. FamilyID is 0 for callers
+// that are not logged in.
+type Context struct {
+	Platform string
+	FamilyID uint
+}
+
+// Enabled evaluates flag for ctx:
+//
+//  1. a disabled flag is off for everyone (kill switch)
+//  2. a flag limited to some platforms is off on all others
+//  3. a family override wins over the rollout
+//  4. otherwise the family is on when its bucket is below Percentage
+//
+// Anonymous callers only see flags rolled out to 100%.
+func Enabled(flag *model.FeatureFlag, ctx Context) bool {
+	if !flag.Enabled {
+		return false
+	}
+	if !matchesPlatform(flag.Platforms, ctx.Platform) {
+		return false
+	}
+	if ctx.FamilyID != 0 {
+		for _, o := range flag.Overrides {
+			if o.FamilyID == ctx.FamilyID {
+				return o.Enabled
+			}
+		}
+	}
+	if flag.Percentage >= 100 {
+		return true
+	}
+	if ctx.FamilyID == 0 || flag.Percentage <= 0 {
+		return false
+	}
+	return Bucket(flag.Key, ctx.FamilyID) < flag.Percentage
+}
+
+// Bucket maps a family to 0-99 for a flag. The hash includes the flag key
+// so that each flag rolls out to a different set of families, and it is
+// stable so raising the percentage only ever adds families.
+func Bucket(key string, familyID uint) int {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%d", key, familyID)
+	return int(h.Sum32() % 100)
+}
+
+func matchesPlatform(platforms, platform string) bool {
+	if strings.TrimSpace(platforms) == "" {
+		return true
+	}
+	platform = strings.ToLower(strings.TrimSpace(platform))
+	for _, p := range strings.Split(platforms, ",") {
+		if strings.ToLower(strings.TrimSpace(p)) == platform {
+			return true
+		}
+	}
+	return false
+}
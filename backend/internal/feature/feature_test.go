@@ -0,0 +1,105 @@
+package feature
+
+import (
+	"testing"
+
+	"study-quest-backend/internal/model"
+)
+
+// The buckets are part of the rollout contract: changing the hash would
+// move families in and out of every partial rollout
+func TestBucket(t *testing.T) {
+	tests := []struct {
+		key      string
+		familyID uint
+		want     int
+	}{
+		{"mall", 1, 6},
+		{"mall", 2, 87},
+		{"mall", 42, 13},
+		{"screen_time", 1, 42},
+		{"screen_time", 7, 80},
+		{"new_ui", 1000, 11},
+	}
+	for _, tt := range tests {
+		if got := Bucket(tt.key, tt.familyID); got != tt.want {
+			t.Errorf("Bucket(%q, %d) = %d, want %d", tt.key, tt.familyID, got, tt.want)
+		}
+	}
+}
+
+func TestBucketRange(t *testing.T) {
+	for familyID := uint(1); familyID <= 1000; familyID++ {
+		if b := Bucket("mall", familyID); b < 0 || b > 99 {
+			t.Fatalf("Bucket(mall, %d) = %d, want 0-99", familyID, b)
+		}
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	overrides := []model.FeatureFlagOverride{
+		{FamilyID: 2, Enabled: true},   // bucket 87: allowed although outside the rollout
+		{FamilyID: 42, Enabled: false}, // bucket 13: denied although inside it
+	}
+	tests := []struct {
+		name string
+		flag model.FeatureFlag
+		ctx  Context
+		want bool
+	}{
+		// Kill switch and platforms come first, even before overrides
+		{"disabled", model.FeatureFlag{Key: "mall", Percentage: 100}, Context{FamilyID: 1}, false},
+		{"disabled with allow override", model.FeatureFlag{Key: "mall", Percentage: 100, Overrides: overrides}, Context{FamilyID: 2}, false},
+		{"other platform", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 100, Platforms: "ios,android"}, Context{Platform: "web", FamilyID: 1}, false},
+		{"other platform with allow override", model.FeatureFlag{Key: "mall", Enabled: true, Platforms: "ios", Overrides: overrides}, Context{Platform: "web", FamilyID: 2}, false},
+		{"listed platform", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 100, Platforms: "ios, Android"}, Context{Platform: "android", FamilyID: 1}, true},
+		{"no platform given", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 100, Platforms: "ios"}, Context{FamilyID: 1}, false},
+		{"all platforms", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 100, Platforms: " "}, Context{Platform: "web", FamilyID: 1}, true},
+
+		// Percentage boundaries
+		{"0%", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 0}, Context{FamilyID: 1}, false},
+		{"negative", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: -5}, Context{FamilyID: 1}, false},
+		{"100%", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 100}, Context{FamilyID: 2}, true},
+		{"over 100", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 150}, Context{FamilyID: 2}, true},
+		{"bucket equal to percentage", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 13}, Context{FamilyID: 42}, false},
+		{"bucket one below percentage", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 14}, Context{FamilyID: 42}, true},
+		{"bucket 87 at 99%", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 99}, Context{FamilyID: 2}, true},
+
+		// Anonymous callers only get full rollouts
+		{"anonymous at 100%", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 100}, Context{}, true},
+		{"anonymous at 99%", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 99}, Context{}, false},
+
+		// Overrides beat the rollout in both directions
+		{"allow override at 0%", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 0, Overrides: overrides}, Context{FamilyID: 2}, true},
+		{"deny override at 100%", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 100, Overrides: overrides}, Context{FamilyID: 42}, false},
+		{"deny override inside rollout", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 50, Overrides: overrides}, Context{FamilyID: 42}, false},
+		{"no override falls back to rollout", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 50, Overrides: overrides}, Context{FamilyID: 1}, true},
+		{"overrides ignored for anonymous", model.FeatureFlag{Key: "mall", Enabled: true, Percentage: 0, Overrides: []model.FeatureFlagOverride{{FamilyID: 0, Enabled: true}}}, Context{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Enabled(&tt.flag, tt.ctx); got != tt.want {
+				t.Errorf("Enabled = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Raising the percentage only ever adds families
+func TestRolloutIsMonotonic(t *testing.T) {
+	flag := model.FeatureFlag{Key: "mall", Enabled: true}
+	for familyID := uint(1); familyID <= 200; familyID++ {
+		on := false
+		for percentage := 0; percentage <= 100; percentage++ {
+			flag.Percentage = percentage
+			enabled := Enabled(&flag, Context{FamilyID: familyID})
+			if on && !enabled {
+				t.Fatalf("family %d was dropped when raising the rollout to %d%%", familyID, percentage)
+			}
+			on = enabled
+		}
+		if !on {
+			t.Fatalf("family %d is off at 100%%", familyID)
+		}
+	}
+}
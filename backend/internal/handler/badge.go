@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"study-quest-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBadges lists the badge catalog with what the student has unlocked and
+// the progress on the rest. Students see their own; parents pass
+// ?student_id= for a child of their family. ?status=earned or locked
+// narrows the list.
+func (h *Handler) GetBadges(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	targetID := userID.(uint)
+	if sid := c.Query("student_id"); sid != "" {
+		id, err := strconv.ParseUint(sid, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student_id"})
+			return
+		}
+		targetID = uint(id)
+	}
+	status := c.Query("status")
+	if status != "" && status != "earned" && status != "locked" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be earned or locked"})
+		return
+	}
+
+	badges, err := h.taskService.GetBadges(userID.(uint), targetID)
+	if errors.Is(err, service.ErrPermissionDenied) {
+		abortForbidden(c)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting badges: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get badges"})
+		return
+	}
+
+	earned := 0
+	listed := make([]service.BadgeProgress, 0, len(badges))
+	for _, badge := range badges {
+		if badge.Unlocked {
+			earned++
+		}
+		if status == "" || (status == "earned") == badge.Unlocked {
+			listed = append(listed, badge)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"badges": listed, "earned": earned, "total": len(badges)})
+}
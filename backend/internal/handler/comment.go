@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTaskComments returns the conversation on a task log (?log_id=)
+func (h *Handler) GetTaskComments(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	logID, err := strconv.ParseUint(c.Query("log_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid log_id"})
+		return
+	}
+
+	comments, err := h.taskService.GetTaskComments(userID.(uint), uint(logID))
+	if err != nil {
+		respondTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"comments": comments})
+}
+
+func (h *Handler) AddTaskComment(c *gin.Context) {
+	var req struct {
+		LogID   uint   `json:"log_id"`
+		Content string `json:"content"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	comment, err := h.taskService.AddTaskComment(userID.(uint), req.LogID, req.Content)
+	if err != nil {
+		respondTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, comment)
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"study-quest-backend/internal/feature"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAppConfig returns the app config resolved for the calling client's
+// X-Platform and X-App-Version headers
+func (h *Handler) GetAppConfig(c *gin.Context) {
+	config, err := h.configService.Resolve(service.ClientInfo{
+		Platform: c.GetHeader("X-Platform"),
+		Version:  c.GetHeader("X-App-Version"),
+	})
+	if err != nil {
+		log.Printf("Error resolving app config: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get config"})
+		return
+	}
+
+	// The endpoint is public; a valid token additionally enables the
+	// family's rollouts and overrides
+	ctx := feature.Context{Platform: c.GetHeader("X-Platform")}
+	if token := c.GetHeader("Authorization"); token != "" {
+		if user, err := h.authService.ValidateSession(token); err == nil {
+			ctx.FamilyID = user.FamilyID
+		}
+	}
+	features, err := h.featureService.EnabledFeatures(ctx)
+	if err != nil {
+		log.Printf("Error evaluating feature flags: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get config"})
+		return
+	}
+	config["features"] = features
+
+	c.JSON(http.StatusOK, config)
+}
+
+func (h *Handler) ListAppConfigs(c *gin.Context) {
+	configs, err := h.configService.ListConfigs()
+	if err != nil {
+		log.Printf("Error listing app configs: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get configs"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"configs": configs})
+}
+
+// SaveAppConfig creates or updates one config row. value is any JSON value,
+// e.g. { "key": "review_mode", "value": true, "platform": "ios" }.
+func (h *Handler) SaveAppConfig(c *gin.Context) {
+	var req struct {
+		Key        string          `json:"key"`
+		Value      json.RawMessage `json:"value"`
+		Platform   string          `json:"platform"`
+		MinVersion string          `json:"min_version"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	config := &model.AppConfig{
+		Key:        req.Key,
+		Value:      string(req.Value),
+		Platform:   req.Platform,
+		MinVersion: req.MinVersion,
+	}
+	err := h.configService.SaveConfig(config)
+	if errors.Is(err, service.ErrInvalidConfig) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving app config: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save config"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"config": config})
+}
+
+func (h *Handler) DeleteAppConfig(c *gin.Context) {
+	var req struct {
+		ID uint `json:"id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	err := h.configService.DeleteConfig(req.ID)
+	if errors.Is(err, repository.ErrConfigNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting app config: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete config"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
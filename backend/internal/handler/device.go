@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListDevices returns the family's devices and whether device control is
+// configured on this server
+func (h *Handler) ListDevices(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	devices, err := h.deviceService.ListDevices(userID.(uint))
+	if err != nil {
+		respondDeviceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"devices": devices, "control_enabled": h.deviceService.ControlEnabled()})
+}
+
+func (h *Handler) CreateDevice(c *gin.Context) {
+	var req service.DeviceInput
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	device, err := h.deviceService.CreateDevice(userID.(uint), req)
+	if err != nil {
+		respondDeviceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"device": device})
+}
+
+func (h *Handler) UpdateDevice(c *gin.Context) {
+	var req struct {
+		DeviceID uint `json:"device_id"`
+		service.DeviceInput
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	device, err := h.deviceService.UpdateDevice(userID.(uint), req.DeviceID, req.DeviceInput)
+	if err != nil {
+		respondDeviceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"device": device})
+}
+
+func (h *Handler) DeleteDevice(c *gin.Context) {
+	var req struct {
+		DeviceID uint `json:"device_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.deviceService.DeleteDevice(userID.(uint), req.DeviceID); err != nil {
+		respondDeviceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// TestDevice sends an on or off command to the device right away and
+// returns the device with the outcome in last_error
+func (h *Handler) TestDevice(c *gin.Context) {
+	var req struct {
+		DeviceID uint   `json:"device_id"`
+		Command  string `json:"command"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	device, err := h.deviceService.TestDevice(userID.(uint), req.DeviceID, req.Command)
+	if err != nil {
+		respondDeviceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"device": device})
+}
+
+func respondDeviceError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrPermissionDenied):
+		abortForbidden(c)
+	case errors.Is(err, service.ErrInvalidDevice):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrDeviceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrDeviceControlDisabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error handling device: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process device"})
+	}
+}
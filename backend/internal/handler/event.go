@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"study-quest-backend/internal/events"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StreamEvents streams the family's events as Server-Sent Events: parents
+// get every event of the family, students only their own. A client that
+// reconnects with the Last-Event-ID header (or ?last_event_id=) first gets
+// the events it missed; when those are no longer known it gets a "reset"
+// event and should reload its data. The stream ends once the session ends
+// or the user leaves the family, so that they stop seeing its events.
+func (h *Handler) StreamEvents(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	familyID := c.GetUint("family_id")
+	role := c.GetString("user_role")
+	isParent := role == "parent"
+	token := c.GetHeader("Authorization")
+	// stillMember re-reads the user: membership may change while streaming
+	stillMember := func() bool {
+		user, err := h.authService.ValidateSession(token)
+		return err == nil && user.FamilyID == familyID && user.Role == role
+	}
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+			return
+		}
+		lastID = id
+	}
+
+	sub, missed, complete := h.bus.Subscribe(familyID, lastID)
+	defer h.bus.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !complete {
+		fmt.Fprintf(w, "id: %d\nevent: reset\ndata: {}\n\n", sub.LastID)
+	}
+	visible := func(event events.Event) bool {
+		return isParent || event.StudentID == userID.(uint)
+	}
+	for _, event := range missed {
+		if visible(event) {
+			writeEvent(w, event)
+		}
+	}
+	w.Flush()
+
+	heartbeat := h.heartbeat
+	if heartbeat <= 0 {
+		heartbeat = 25 * time.Second
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+			if !stillMember() {
+				return
+			}
+			fmt.Fprint(w, ": ping\n\n")
+			w.Flush()
+		case event, ok := <-sub.C:
+			if !ok {
+				// Fell behind; the client reconnects and resumes
+				return
+			}
+			if !visible(event) {
+				continue
+			}
+			if !stillMember() {
+				return
+			}
+			writeEvent(w, event)
+			w.Flush()
+		}
+	}
+}
+
+func writeEvent(w io.Writer, event events.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetFamily returns the current user's family and its members
+func (h *Handler) GetFamily(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	family, members, err := h.familyService.GetFamily(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get family"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"family": family, "members": members})
+}
+
+// UpdateFamilySettings sets the family's award limits and late penalties
+// (parent only); omitted fields keep their value
+func (h *Handler) UpdateFamilySettings(c *gin.Context) {
+	var req service.FamilySettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	family, err := h.familyService.UpdateSettings(userID.(uint), req)
+	if errors.Is(err, service.ErrPermissionDenied) {
+		abortForbidden(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"family": family})
+}
+
+// CreateFamilyInvite generates an expiring invite code (parent only)
+func (h *Handler) CreateFamilyInvite(c *gin.Context) {
+	var req struct {
+		Role     string `json:"role"`      // 'parent', 'student' 或空（不限）
+		TTLHours int    `json:"ttl_hours"` // 有效期，默认 72 小时
+		MaxUses  int    `json:"max_uses"`  // 0 为不限次数
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	invite, err := h.familyService.CreateInvite(userID.(uint), req.Role, time.Duration(req.TTLHours)*time.Hour, req.MaxUses)
+	if errors.Is(err, service.ErrPermissionDenied) {
+		abortForbidden(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invite":     invite,
+		"qr_payload": service.InviteQRPayload(invite.Code),
+	})
+}
+
+// JoinFamily moves the current user into the family of an invite code
+func (h *Handler) JoinFamily(c *gin.Context) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	family, err := h.familyService.JoinFamily(userID.(uint), req.Code)
+	if errors.Is(err, repository.ErrInviteInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join family"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"family": family})
+}
+
+// RemoveFamilyMember removes a member from the parent's family
+func (h *Handler) RemoveFamilyMember(c *gin.Context) {
+	var req struct {
+		UserID uint `json:"user_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	err := h.familyService.RemoveMember(userID.(uint), req.UserID)
+	if errors.Is(err, service.ErrPermissionDenied) {
+		abortForbidden(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "removed"})
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"study-quest-backend/internal/feature"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireFeature rejects the request when the flag key is off for the
+// caller's family and platform. It must run after AuthMiddleware.
+func (h *Handler) RequireFeature(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enabled, err := h.featureService.IsEnabled(key, feature.Context{
+			Platform: c.GetHeader("X-Platform"),
+			FamilyID: c.GetUint("family_id"),
+		})
+		if err != nil {
+			log.Printf("Error evaluating feature %s: %v", key, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check feature"})
+			return
+		}
+		if !enabled {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": service.ErrFeatureDisabled.Error(), "code": "FEATURE_DISABLED", "feature": key})
+			return
+		}
+		c.Next()
+	}
+}
+
+func (h *Handler) ListFeatureFlags(c *gin.Context) {
+	flags, err := h.featureService.ListFlags()
+	if err != nil {
+		log.Printf("Error listing feature flags: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get feature flags"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"flags": flags})
+}
+
+// SaveFeatureFlag creates or updates a flag, e.g.
+// { "key": "mall", "enabled": true, "percentage": 20, "platforms": "ios" }
+func (h *Handler) SaveFeatureFlag(c *gin.Context) {
+	var req struct {
+		Key         string `json:"key"`
+		Description string `json:"description"`
+		Enabled     bool   `json:"enabled"`
+		Platforms   string `json:"platforms"`
+		Percentage  int    `json:"percentage"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	flag := &model.FeatureFlag{
+		Key:         req.Key,
+		Description: req.Description,
+		Enabled:     req.Enabled,
+		Platforms:   req.Platforms,
+		Percentage:  req.Percentage,
+	}
+	if err := h.featureService.SaveFlag(flag); err != nil {
+		respondFeatureError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"flag": flag})
+}
+
+// SetFeatureOverride forces a flag on or off for one family. Sending
+// "enabled": null removes the override.
+func (h *Handler) SetFeatureOverride(c *gin.Context) {
+	var req struct {
+		Key      string `json:"key"`
+		FamilyID uint   `json:"family_id"`
+		Enabled  *bool  `json:"enabled"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if err := h.featureService.SetOverride(req.Key, req.FamilyID, req.Enabled); err != nil {
+		respondFeatureError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "updated"})
+}
+
+func respondFeatureError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrInvalidFlag):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrFlagNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error saving feature flag: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save feature flag"})
+	}
+}
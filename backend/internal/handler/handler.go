@@ -1,22 +1,52 @@
 package handler
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"study-quest-backend/internal/events"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/scheduler"
 	"study-quest-backend/internal/service"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
-	taskService *service.TaskService
-	authService *service.AuthService
+	taskService        *service.TaskService
+	authService        *service.AuthService
+	familyService      *service.FamilyService
+	rewardService      *service.RewardService
+	screenTimeService  *service.ScreenTimeService
+	configService      *service.ConfigService
+	featureService     *service.FeatureService
+	proofService       *service.ProofService
+	idempotencyService *service.IdempotencyService
+	webhookService     *service.WebhookService
+	deviceService      *service.DeviceService
+	bus                *events.Bus
+	heartbeat          time.Duration
 }
 
-func NewHandler(ts *service.TaskService, as *service.AuthService) *Handler {
+func NewHandler(ts *service.TaskService, as *service.AuthService, fs *service.FamilyService, rs *service.RewardService, sts *service.ScreenTimeService, cs *service.ConfigService, fts *service.FeatureService, ps *service.ProofService, is *service.IdempotencyService, ws *service.WebhookService, ds *service.DeviceService, bus *events.Bus, heartbeat time.Duration) *Handler {
 	return &Handler{
-		taskService: ts,
-		authService: as,
+		taskService:        ts,
+		authService:        as,
+		familyService:      fs,
+		rewardService:      rs,
+		screenTimeService:  sts,
+		configService:      cs,
+		featureService:     fts,
+		proofService:       ps,
+		idempotencyService: is,
+		webhookService:     ws,
+		deviceService:      ds,
+		bus:                bus,
+		heartbeat:          heartbeat,
 	}
 }
 
@@ -40,15 +70,41 @@ func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 		// Set user info in context
 		c.Set("user_id", user.ID)
 		c.Set("user_role", user.Role)
+		c.Set("family_id", user.FamilyID)
+		c.Set("is_admin", h.authService.IsAdmin(user))
 		c.Next()
 	}
 }
 
-func (h *Handler) GetAppConfig(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"review_mode": false,
-		"theme":       "default",
-	})
+// RequireRole only lets users with one of the given roles through. It must
+// run after AuthMiddleware.
+func (h *Handler) RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("user_role")
+		for _, r := range roles {
+			if role == r {
+				c.Next()
+				return
+			}
+		}
+		abortForbidden(c)
+	}
+}
+
+// RequireAdmin only lets users listed in security.admin_usernames through.
+// It must run after AuthMiddleware.
+func (h *Handler) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("is_admin") {
+			abortForbidden(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortForbidden(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
 }
 
 func (h *Handler) GetTodayTasks(c *gin.Context) {
@@ -59,54 +115,73 @@ func (h *Handler) GetTodayTasks(c *gin.Context) {
 		return
 	}
 	
-	tasks, _ := h.taskService.GetTodayTasks(userID.(uint))
+	filter, ok := parseTaskFilter(c)
+	if !ok {
+		return
+	}
+	tasks, err := h.taskService.GetTodayTasks(userID.(uint), filter)
+	if err != nil {
+		respondTaskError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, tasks)
 }
 
-func (h *Handler) GetPendingTasks(c *gin.Context) {
-	tasks, _ := h.taskService.GetPendingTasks()
-	c.JSON(http.StatusOK, tasks)
+// parseTaskFilter reads ?type=study|chore|habit, ?subject=math and
+// ?overdue=1; it answers 400 and returns false on a bad type
+func parseTaskFilter(c *gin.Context) (repository.TaskFilter, bool) {
+	filter := repository.TaskFilter{
+		Subject: strings.ToLower(strings.TrimSpace(c.Query("subject"))),
+		Overdue: c.Query("overdue") == "1",
+	}
+	if value := c.Query("type"); value != "" {
+		taskType, ok := model.ParseTaskType(strings.ToLower(value))
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "type must be study, chore or habit"})
+			return filter, false
+		}
+		filter.Type = taskType
+	}
+	return filter, true
 }
 
-func (h *Handler) CreateTask(c *gin.Context) {
-	var req struct {
-		Title  string `json:"title"`
-		Points int    `json:"points"`
-	}
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-		return
-	}
-	
-	// Get current user (parent)
-	userID, exists := c.Get("user_id")
+func (h *Handler) GetPendingTasks(c *gin.Context) {
+	familyID, exists := c.Get("family_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
-	
-	// Get user info to find family ID
-	user, err := h.taskService.GetUserProfile(userID.(uint))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+
+	filter, ok := parseTaskFilter(c)
+	if !ok {
 		return
 	}
-	
-	// Create task and assign to family students
-	err = h.taskService.CreateTask(req.Title, req.Points, user.FamilyID)
+	tasks, err := h.taskService.GetPendingTasks(familyID.(uint), filter)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create task"})
+		respondTaskError(c, err)
 		return
 	}
-	
-	c.JSON(http.StatusOK, gin.H{"status": "created"})
+	c.JSON(http.StatusOK, tasks)
 }
 
+// SubmitTask accepts either JSON { task_id } or multipart/form-data with a
+// task_id field and up to three "proof" image files
 func (h *Handler) SubmitTask(c *gin.Context) {
 	var req struct {
-		TaskID uint `json:"task_id"` // This is actually task_log ID from frontend
+		TaskID uint `json:"task_id" form:"task_id"` // This is actually task_log ID from frontend
 	}
-	if err := c.BindJSON(&req); err != nil {
+	var uploads []service.ProofUpload
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		var err error
+		if uploads, err = h.readProofUploads(c); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PROOF"})
+			return
+		}
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	} else if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
@@ -117,33 +192,89 @@ func (h *Handler) SubmitTask(c *gin.Context) {
 		return
 	}
 	
-	log.Printf("Submitting task_log ID %d for user %d", req.TaskID, userID.(uint))
+	log.Printf("Submitting task_log ID %d for user %d with %d proof images", req.TaskID, userID.(uint), len(uploads))
 	
-	err := h.taskService.SubmitTaskByLogID(req.TaskID, userID.(uint))
+	err := h.taskService.SubmitTaskByLogID(c.Request.Context(), req.TaskID, userID.(uint), uploads)
 	if err != nil {
-		log.Printf("Error submitting task: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondTaskError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"status": "submitted"})
 }
 
+// ApproveTask approves or rejects a pending submission. Approval may award
+// a custom amount (awarded_points) within the family's limits; rejecting
+// requires a reason, which the student sees on the task and in its comments.
 func (h *Handler) ApproveTask(c *gin.Context) {
 	var req struct {
-		LogID  uint   `json:"log_id"`
-		Action string `json:"action"`
+		LogID         uint   `json:"log_id"`
+		Action        string `json:"action"`
+		Reason        string `json:"reason"`
+		AwardedPoints *int   `json:"awarded_points"`
 	}
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 	
-	if req.Action == "approve" {
-		h.taskService.ApproveTask(req.LogID)
-	} else {
-		h.taskService.RejectTask(req.LogID)
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var err error
+	var status string
+	var approval *service.Approval
+	switch req.Action {
+	case "approve":
+		approval, err = h.taskService.ApproveTask(req.LogID, userID.(uint), req.AwardedPoints)
+		status = "approved"
+	case "reject":
+		err = h.taskService.RejectTask(req.LogID, userID.(uint), req.Reason)
+		status = "rejected"
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action must be approve or reject"})
+		return
+	}
+	if err != nil {
+		respondTaskError(c, err)
+		return
+	}
+	response := gin.H{"status": status}
+	if approval != nil && approval.LevelUp != nil {
+		response["level_up"] = approval.LevelUp
+	}
+	if approval != nil && len(approval.Badges) > 0 {
+		response["badges"] = approval.Badges
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func respondTaskError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrPermissionDenied):
+		abortForbidden(c)
+	case errors.Is(err, service.ErrReasonRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "REASON_REQUIRED"})
+	case errors.Is(err, service.ErrAwardOutOfRange):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "AWARD_OUT_OF_RANGE"})
+	case errors.Is(err, service.ErrInvalidComment):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidProof):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_PROOF"})
+	case errors.Is(err, service.ErrInvalidTask), errors.Is(err, scheduler.ErrInvalidRecurrence):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrTaskNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "TASK_NOT_FOUND"})
+	case errors.Is(err, repository.ErrTaskLogNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "TASK_NOT_FOUND"})
+	case errors.Is(err, repository.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "INVALID_STATUS"})
+	default:
+		log.Printf("Error handling task: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process task"})
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "processed"})
 }
 
 func (h *Handler) GetProfile(c *gin.Context) {
@@ -153,15 +284,17 @@ func (h *Handler) GetProfile(c *gin.Context) {
 		return
 	}
 	
-	user, _ := h.taskService.GetUserProfile(userID.(uint))
-	c.JSON(http.StatusOK, user)
+	profile, err := h.taskService.GetProfile(userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get profile"})
+		return
+	}
+	c.JSON(http.StatusOK, profile)
 }
 
 func (h *Handler) RedeemReward(c *gin.Context) {
 	var req struct {
-		RewardID    uint   `json:"reward_id"`
-		RewardTitle string `json:"reward_title"`
-		Cost        int    `json:"cost"`
+		RewardID uint `json:"reward_id"`
 	}
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
@@ -174,58 +307,105 @@ func (h *Handler) RedeemReward(c *gin.Context) {
 		return
 	}
 
-	err := h.taskService.RedeemReward(userID.(uint), req.RewardID, req.RewardTitle, req.Cost)
-	if err != nil {
+	redemption, badges, err := h.taskService.RedeemReward(userID.(uint), req.RewardID)
+	switch {
+	case errors.Is(err, repository.ErrRewardNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "REWARD_NOT_FOUND"})
+		return
+	case errors.Is(err, repository.ErrOutOfStock):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "OUT_OF_STOCK"})
+		return
+	case errors.Is(err, repository.ErrInsufficientPoints):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INSUFFICIENT_POINTS"})
+		return
+	case err != nil:
 		log.Printf("Error redeeming reward: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to redeem reward"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"status": "redeemed"})
+	response := gin.H{"status": "redeemed", "redemption_id": redemption.ID, "redemption_status": redemption.Status, "cost": redemption.Cost}
+	if len(badges) > 0 {
+		response["badges"] = badges
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-func (h *Handler) GetRedemptions(c *gin.Context) {
-	familyID, exists := c.Get("family_id")
+// GetPointTransactions returns the points ledger. Students see their own
+// history; parents pass ?student_id= to inspect a child of their family.
+func (h *Handler) GetPointTransactions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	redemptions, err := h.taskService.GetRedemptionsByFamily(familyID.(uint))
+	targetID := userID.(uint)
+	if sid := c.Query("student_id"); sid != "" {
+		id, err := strconv.ParseUint(sid, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student_id"})
+			return
+		}
+		targetID = uint(id)
+	}
+
+	transactions, err := h.taskService.GetPointTransactions(userID.(uint), targetID, 100)
+	if errors.Is(err, service.ErrPermissionDenied) {
+		abortForbidden(c)
+		return
+	}
 	if err != nil {
-		log.Printf("Error getting redemptions: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get redemptions"})
+		log.Printf("Error getting point transactions: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get point transactions"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"redemptions": redemptions})
+	c.JSON(http.StatusOK, gin.H{"transactions": transactions})
 }
 
-func (h *Handler) GetRewards(c *gin.Context) {
-	rewards, err := h.taskService.GetAllRewards()
-	if err != nil {
-		log.Printf("Error getting rewards: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get rewards"})
+// GetTaskHistory returns reviewed tasks with the points awarded. Students
+// see their own; parents pass ?student_id= for a child of their family.
+func (h *Handler) GetTaskHistory(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"rewards": rewards})
+	targetID := userID.(uint)
+	if sid := c.Query("student_id"); sid != "" {
+		id, err := strconv.ParseUint(sid, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student_id"})
+			return
+		}
+		targetID = uint(id)
+	}
+
+	logs, err := h.taskService.GetTaskHistory(userID.(uint), targetID, 100)
+	if err != nil {
+		respondTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tasks": logs})
 }
 
 // Auth Handlers
 func (h *Handler) Register(c *gin.Context) {
 	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		Role     string `json:"role"`
-		RealName string `json:"real_name"`
-		Grade    int    `json:"grade"`
+		Username   string `json:"username"`
+		Password   string `json:"password"`
+		Role       string `json:"role"`
+		RealName   string `json:"real_name"`
+		Grade      int    `json:"grade"`
+		InviteCode string `json:"invite_code"` // 可选：凭邀请码加入已有家庭
 	}
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
-	user, err := h.authService.Register(req.Username, req.Password, req.Role, req.RealName, req.Grade)
+	user, err := h.authService.Register(req.Username, req.Password, req.Role, req.RealName, req.Grade, req.InviteCode)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -253,6 +433,31 @@ func (h *Handler) Login(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"user": user, "token": token})
 }
 
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var req struct {
+		OldPassword string `json:"old_password"`
+		NewPassword string `json:"new_password"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	err := h.authService.ChangePassword(userID.(uint), c.GetHeader("Authorization"), req.OldPassword, req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
 func (h *Handler) Logout(c *gin.Context) {
 	token := c.GetHeader("Authorization")
 	if token == "" {
@@ -289,8 +494,14 @@ func (h *Handler) GetStudentList(c *gin.Context) {
 }
 
 func (h *Handler) GetRanking(c *gin.Context) {
+	familyID, exists := c.Get("family_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
 	limit := 10 // Top 10 by default
-	students, err := h.taskService.GetTopStudents(limit)
+	students, err := h.taskService.GetTopStudents(familyID.(uint), limit)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get ranking"})
 		return
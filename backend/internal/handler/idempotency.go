@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"study-quest-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxIdempotencyKeyLength = 255
+
+// responseRecorder keeps a copy of everything written to the client
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// stripBoundary removes the multipart boundary from body, as clients pick a
+// new random one for every attempt of the same upload
+func stripBoundary(contentType string, body []byte) []byte {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return body
+	}
+	return bytes.ReplaceAll(body, []byte(params["boundary"]), nil)
+}
+
+// Idempotent makes write requests carrying an Idempotency-Key header safe to
+// retry: the first response is stored per user and key, and a retry of the
+// same request gets that response again (with Idempotent-Replayed: true)
+// instead of being executed twice. It must run after AuthMiddleware.
+func (h *Handler) Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		method := c.Request.Method
+		if key == "" || method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions {
+			c.Next()
+			return
+		}
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		// Hash the request so a key cannot be reused for a different one.
+		// Bodies are bounded by the largest allowed proof upload.
+		maxBody := int64(service.MaxProofImages*h.proofService.MaxBytes() + 64<<10)
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBody+1))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request"})
+			return
+		}
+		if int64(len(body)) > maxBody {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request is too large"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.New()
+		io.WriteString(sum, method+" "+c.Request.URL.Path+"\n")
+		sum.Write(stripBoundary(c.GetHeader("Content-Type"), body))
+
+		record, replay, err := h.idempotencyService.Begin(userID.(uint), key, hex.EncodeToString(sum.Sum(nil)))
+		switch {
+		case errors.Is(err, service.ErrIdempotencyInProgress):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "IDEMPOTENCY_IN_PROGRESS"})
+			return
+		case errors.Is(err, service.ErrIdempotencyKeyReused):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "IDEMPOTENCY_KEY_REUSED"})
+			return
+		case err != nil:
+			log.Printf("Error reserving Idempotency-Key: %v", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+			return
+		}
+		if replay {
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.StatusCode, record.ContentType, record.Response)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		completed := false
+		// Release the key if a handler panics so the client can retry
+		defer func() {
+			if !completed {
+				h.idempotencyService.Abort(record)
+			}
+		}()
+		c.Next()
+		h.idempotencyService.Complete(record, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		completed = true
+	}
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLevels returns the level curve
+func (h *Handler) GetLevels(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"levels": h.taskService.Levels()})
+}
+
+// AcknowledgeLevelUps clears the level-ups listed on /profile once the app
+// has shown them
+func (h *Handler) AcknowledgeLevelUps(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.taskService.AcknowledgeLevelUps(userID.(uint)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update level-ups"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
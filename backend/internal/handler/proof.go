@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"study-quest-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readProofUploads reads the "proof" files of a multipart submission,
+// enforcing the per-file size limit while reading
+func (h *Handler) readProofUploads(c *gin.Context) ([]service.ProofUpload, error) {
+	maxBytes := h.proofService.MaxBytes()
+	// Cap the whole body: every file plus some room for the form fields
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(service.MaxProofImages*maxBytes+64<<10))
+
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload: %v", err)
+	}
+	files := form.File["proof"]
+	if len(files) > service.MaxProofImages {
+		return nil, fmt.Errorf("at most %d proof images", service.MaxProofImages)
+	}
+
+	var uploads []service.ProofUpload
+	for _, fh := range files {
+		if fh.Size > int64(maxBytes) {
+			return nil, fmt.Errorf("%s is larger than %d bytes", fh.Filename, maxBytes)
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(f, int64(maxBytes)+1))
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxBytes {
+			return nil, fmt.Errorf("%s is larger than %d bytes", fh.Filename, maxBytes)
+		}
+		uploads = append(uploads, service.ProofUpload{Filename: fh.Filename, Data: data})
+	}
+	return uploads, nil
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRedemptions lists redemptions: the whole family for parents, their own
+// for students. ?status= filters by lifecycle status.
+func (h *Handler) GetRedemptions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	redemptions, err := h.taskService.GetRedemptions(userID.(uint), c.Query("status"))
+	if err != nil {
+		respondRedemptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"redemptions": redemptions})
+}
+
+func (h *Handler) ApproveRedemption(c *gin.Context) {
+	h.handleRedemption(c, "approved", func(userID uint, id uint, _ string) error {
+		return h.taskService.ApproveRedemption(userID, id)
+	})
+}
+
+func (h *Handler) FulfillRedemption(c *gin.Context) {
+	h.handleRedemption(c, "fulfilled", func(userID uint, id uint, _ string) error {
+		return h.taskService.FulfillRedemption(userID, id)
+	})
+}
+
+// RejectRedemption declines a redemption; the points are refunded
+func (h *Handler) RejectRedemption(c *gin.Context) {
+	h.handleRedemption(c, model.RedemptionRejected, h.taskService.RejectRedemption)
+}
+
+// CancelRedemption lets a student withdraw a pending request; the points
+// are refunded
+func (h *Handler) CancelRedemption(c *gin.Context) {
+	h.handleRedemption(c, model.RedemptionCancelled, func(userID uint, id uint, _ string) error {
+		return h.taskService.CancelRedemption(userID, id)
+	})
+}
+
+func (h *Handler) handleRedemption(c *gin.Context, status string, action func(userID uint, redemptionID uint, reason string) error) {
+	var req struct {
+		RedemptionID uint   `json:"redemption_id"`
+		Reason       string `json:"reason"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := action(userID.(uint), req.RedemptionID, req.Reason); err != nil {
+		respondRedemptionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
+
+func respondRedemptionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrPermissionDenied):
+		abortForbidden(c)
+	case errors.Is(err, repository.ErrRedemptionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "REDEMPTION_NOT_FOUND"})
+	case errors.Is(err, repository.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "INVALID_STATUS"})
+	case errors.Is(err, service.ErrInvalidRedemptionStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error handling redemption: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process redemption"})
+	}
+}
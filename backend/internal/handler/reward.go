@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRewards lists the family's reward catalog. Parents may pass
+// ?include_archived=1 to also see rewards taken off the shelf.
+func (h *Handler) GetRewards(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	rewards, err := h.rewardService.GetRewards(userID.(uint), c.Query("include_archived") == "1")
+	if err != nil {
+		log.Printf("Error getting rewards: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get rewards"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rewards": rewards})
+}
+
+func (h *Handler) GetRewardCategories(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"categories": service.RewardCategories})
+}
+
+func (h *Handler) CreateReward(c *gin.Context) {
+	var req service.RewardInput
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	reward, err := h.rewardService.CreateReward(userID.(uint), req)
+	if err != nil {
+		respondRewardError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reward": reward})
+}
+
+func (h *Handler) UpdateReward(c *gin.Context) {
+	var req struct {
+		RewardID uint `json:"reward_id"`
+		service.RewardInput
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	reward, err := h.rewardService.UpdateReward(userID.(uint), req.RewardID, req.RewardInput)
+	if err != nil {
+		respondRewardError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reward": reward})
+}
+
+// ArchiveReward takes a reward off the shelf; {"restore": true} puts it back
+func (h *Handler) ArchiveReward(c *gin.Context) {
+	var req struct {
+		RewardID uint `json:"reward_id"`
+		Restore  bool `json:"restore"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.rewardService.ArchiveReward(userID.(uint), req.RewardID, !req.Restore); err != nil {
+		respondRewardError(c, err)
+		return
+	}
+	status := "archived"
+	if req.Restore {
+		status = "restored"
+	}
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
+
+func (h *Handler) RestockReward(c *gin.Context) {
+	var req struct {
+		RewardID uint `json:"reward_id"`
+		Amount   int  `json:"amount"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.rewardService.RestockReward(userID.(uint), req.RewardID, req.Amount); err != nil {
+		respondRewardError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "restocked"})
+}
+
+func (h *Handler) ReorderRewards(c *gin.Context) {
+	var req struct {
+		RewardIDs []uint `json:"reward_ids"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.rewardService.ReorderRewards(userID.(uint), req.RewardIDs); err != nil {
+		respondRewardError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "reordered"})
+}
+
+func respondRewardError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrPermissionDenied):
+		abortForbidden(c)
+	case errors.Is(err, repository.ErrRewardNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
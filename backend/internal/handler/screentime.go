@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetScreenTime returns the remaining screen time and open session. Parents
+// pass ?student_id= to look at a child of their family.
+func (h *Handler) GetScreenTime(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	studentID := userID.(uint)
+	if sid := c.Query("student_id"); sid != "" {
+		id, err := strconv.ParseUint(sid, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid student_id"})
+			return
+		}
+		studentID = uint(id)
+	}
+
+	status, err := h.screenTimeService.GetStatus(userID.(uint), studentID)
+	if err != nil {
+		respondScreenTimeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func (h *Handler) StartScreenTime(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	status, err := h.screenTimeService.Start(userID.(uint))
+	if err != nil {
+		respondScreenTimeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+func (h *Handler) PauseScreenTime(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	status, err := h.screenTimeService.Pause(userID.(uint))
+	if err != nil {
+		respondScreenTimeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// StopScreenTime ends the open session. Students stop their own; parents
+// send { student_id } to stop a child's session.
+func (h *Handler) StopScreenTime(c *gin.Context) {
+	var req struct {
+		StudentID uint `json:"student_id"`
+	}
+	// The body is optional for students
+	c.ShouldBindJSON(&req)
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	studentID := req.StudentID
+	if studentID == 0 {
+		studentID = userID.(uint)
+	}
+	status, err := h.screenTimeService.Stop(userID.(uint), studentID)
+	if err != nil {
+		respondScreenTimeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// GetScreenTimeSessions lists the family's open sessions for the parent view
+func (h *Handler) GetScreenTimeSessions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	sessions, err := h.screenTimeService.GetFamilySessions(userID.(uint))
+	if err != nil {
+		respondScreenTimeError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+func respondScreenTimeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrPermissionDenied):
+		abortForbidden(c)
+	case errors.Is(err, service.ErrNoScreenTime):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "NO_SCREEN_TIME"})
+	case errors.Is(err, service.ErrNoOpenSession), errors.Is(err, service.ErrSessionNotRunning),
+		errors.Is(err, repository.ErrSessionOpen), errors.Is(err, repository.ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "INVALID_SESSION_STATE"})
+	default:
+		log.Printf("Error handling screen time: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process screen time"})
+	}
+}
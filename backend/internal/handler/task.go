@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"net/http"
+	"study-quest-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTasks lists the family's tasks for parents. ?include_archived=1 also
+// returns archived tasks.
+func (h *Handler) GetTasks(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	tasks, err := h.taskService.GetFamilyTasks(userID.(uint), c.Query("include_archived") == "1")
+	if err != nil {
+		respondTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"tasks": tasks})
+}
+
+// CreateTask creates a task and assigns it to the chosen children, or to all
+// children of the family when assignee_ids is empty
+func (h *Handler) CreateTask(c *gin.Context) {
+	var req service.TaskInput
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	task, err := h.taskService.CreateTask(userID.(uint), req)
+	if err != nil {
+		respondTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "created", "task": task})
+}
+
+func (h *Handler) UpdateTask(c *gin.Context) {
+	var req struct {
+		TaskID uint `json:"task_id"`
+		service.TaskInput
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	task, err := h.taskService.UpdateTask(userID.(uint), req.TaskID, req.TaskInput)
+	if err != nil {
+		respondTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"task": task})
+}
+
+// ArchiveTask stops a task from recurring; {"restore": true} resumes it.
+// {"cancel_open_logs": true} also cancels the children's unfinished logs.
+func (h *Handler) ArchiveTask(c *gin.Context) {
+	var req struct {
+		TaskID         uint `json:"task_id"`
+		Restore        bool `json:"restore"`
+		CancelOpenLogs bool `json:"cancel_open_logs"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.taskService.ArchiveTask(userID.(uint), req.TaskID, !req.Restore, req.CancelOpenLogs); err != nil {
+		respondTaskError(c, err)
+		return
+	}
+	status := "archived"
+	if req.Restore {
+		status = "restored"
+	}
+	c.JSON(http.StatusOK, gin.H{"status": status})
+}
+
+// DeleteTask removes a task; unfinished logs are cancelled
+func (h *Handler) DeleteTask(c *gin.Context) {
+	var req struct {
+		TaskID uint `json:"task_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.taskService.DeleteTask(userID.(uint), req.TaskID); err != nil {
+		respondTaskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
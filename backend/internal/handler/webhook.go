@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"study-quest-backend/internal/events"
+	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListWebhooks returns the family's webhooks and the event types they can
+// subscribe to
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	webhooks, err := h.webhookService.ListWebhooks(userID.(uint))
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks, "event_types": events.Types})
+}
+
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	var req service.WebhookInput
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	webhook, err := h.webhookService.CreateWebhook(userID.(uint), req)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+	// The secret is only ever shown here and after a rotation
+	c.JSON(http.StatusOK, gin.H{"webhook": webhook, "secret": webhook.Secret})
+}
+
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	var req struct {
+		WebhookID uint `json:"webhook_id"`
+		service.WebhookInput
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	webhook, err := h.webhookService.UpdateWebhook(userID.(uint), req.WebhookID, req.WebhookInput)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+	if req.RotateSecret {
+		c.JSON(http.StatusOK, gin.H{"webhook": webhook, "secret": webhook.Secret})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"webhook": webhook})
+}
+
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	var req struct {
+		WebhookID uint `json:"webhook_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if err := h.webhookService.DeleteWebhook(userID.(uint), req.WebhookID); err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "deleted"})
+}
+
+// TestWebhook sends a ping to the webhook and returns how it went
+func (h *Handler) TestWebhook(c *gin.Context) {
+	var req struct {
+		WebhookID uint `json:"webhook_id"`
+	}
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	delivery, err := h.webhookService.TestWebhook(userID.(uint), req.WebhookID)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"delivery": delivery})
+}
+
+// GetWebhookDeliveries returns the delivery log of ?webhook_id=, newest
+// first (?limit=, default 50, at most 200)
+func (h *Handler) GetWebhookDeliveries(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	webhookID, err := strconv.ParseUint(c.Query("webhook_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook_id"})
+		return
+	}
+	limit := 50
+	if l := c.Query("limit"); l != "" {
+		if limit, err = strconv.Atoi(l); err != nil || limit <= 0 || limit > 200 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 200"})
+			return
+		}
+	}
+
+	deliveries, err := h.webhookService.GetDeliveries(userID.(uint), uint(webhookID), limit)
+	if err != nil {
+		respondWebhookError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+func respondWebhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrPermissionDenied):
+		abortForbidden(c)
+	case errors.Is(err, service.ErrInvalidWebhook):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrWebhookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error handling webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
+	}
+}
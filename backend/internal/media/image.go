@@ -0,0 +1,112 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+
+	// Register decoders for image.Decode
+	_ "image/gif"
+	_ "image/png"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrImageTooLarge   = errors.New("image dimensions too large")
+)
+
+// maxPixels guards against decompression bombs: a tiny file that decodes
+// into a huge bitmap
+const maxPixels = 50_000_000
+
+// AllowedTypes are the content types accepted for uploads
+var AllowedTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// DetectImage sniffs the content type of data (ignoring whatever the client
+// claimed) and checks that it is an allowed, decodable image of sane size
+func DetectImage(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := AllowedTypes[contentType]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnsupportedType, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return "", ErrImageTooLarge
+	}
+	return contentType, nil
+}
+
+// Thumbnail decodes data and returns a JPEG whose longer side is at most
+// maxSide pixels. Smaller images are only re-encoded.
+func Thumbnail(data []byte, maxSide int) ([]byte, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > maxSide || h > maxSide {
+		if w >= h {
+			h = max(1, h*maxSide/w)
+			w = maxSide
+		} else {
+			w = max(1, w*maxSide/h)
+			h = maxSide
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(src, w, h), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// downscale resizes src to w x h by averaging a grid of up to 4x4 source
+// samples per destination pixel. Transparent areas are flattened onto
+// white since JPEG has no alpha channel.
+func downscale(src image.Image, w, h int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sx := float64(b.Dx()) / float64(w)
+	sy := float64(b.Dy()) / float64(h)
+	samplesX := min(4, max(1, int(sx)))
+	samplesY := min(4, max(1, int(sy)))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var r, g, bl, n uint32
+			for j := 0; j < samplesY; j++ {
+				py := b.Min.Y + int((float64(y)+(float64(j)+0.5)/float64(samplesY))*sy)
+				for i := 0; i < samplesX; i++ {
+					px := b.Min.X + int((float64(x)+(float64(i)+0.5)/float64(samplesX))*sx)
+					cr, cg, cb, ca := src.At(px, py).RGBA()
+					// Composite over white: c + (1 - a)
+					r += cr + 0xffff - ca
+					g += cg + 0xffff - ca
+					bl += cb + 0xffff - ca
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
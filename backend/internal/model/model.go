@@ -1,6 +1,9 @@
 package model
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -13,21 +16,194 @@ type User struct {
 	Password  string     `json:"-"` // 不在 JSON 中返回
 	Role      string     `json:"role"` // 'parent', 'student'
 	Points    int        `json:"points"`
+	TotalPointsEarned int `gorm:"default:0" json:"total_points_earned"` // 累计获得的积分，兑换不减少，用于等级计算
 	Avatar    string     `json:"avatar"`
 	FamilyID  uint       `json:"family_id"` // 家庭组ID
 	Grade     int        `json:"grade"` // 年级（学生）
 	RealName  string     `json:"real_name"` // 真实姓名
 }
 
+type Family struct {
+	ID        uint       `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+	Name      string     `json:"name"`
+	// 审核时可发放积分的范围，按任务积分的百分比：低于 100 为部分完成，高于 100 为额外奖励
+	MinAwardPercent int `gorm:"default:0" json:"min_award_percent"`
+	MaxAwardPercent int `gorm:"default:150" json:"max_award_percent"`
+	// 逾期惩罚：逾期提交的任务审核通过时少发的百分比，以及截止时仍未提交时扣除的积分
+	LatePenaltyPercent int `gorm:"default:0" json:"late_penalty_percent"`
+	MissedTaskPenalty  int `gorm:"default:0" json:"missed_task_penalty"`
+	// 连续完成：按家庭时区划分日期；StreakSkipDays 为不中断连续记录的日子，
+	// 写法同任务的 recurrence（如 weekends）；StreakMilestones 为空时使用默认奖励
+	Timezone         string           `gorm:"type:varchar(64)" json:"timezone"` // IANA 时区，空为服务器时区
+	StreakSkipDays   string           `gorm:"type:varchar(64)" json:"streak_skip_days"`
+	StreakMilestones StreakMilestones `gorm:"type:json" json:"streak_milestones"`
+}
+
+// Default award limits of a new family
+const (
+	DefaultMinAwardPercent = 0
+	DefaultMaxAwardPercent = 150
+)
+
+// Location returns the family's time zone, falling back to the server's
+func (f *Family) Location() *time.Location {
+	if f.Timezone != "" {
+		if loc, err := time.LoadLocation(f.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// Milestones returns the family's streak bonuses, or the defaults when the
+// family has not configured any
+func (f *Family) Milestones() StreakMilestones {
+	if f.StreakMilestones == nil {
+		return DefaultStreakMilestones
+	}
+	return f.StreakMilestones
+}
+
+// StreakMilestone 连续完成 Days 天时发放 Points 积分
+type StreakMilestone struct {
+	Days   int `json:"days"`
+	Points int `json:"points"`
+}
+
+// StreakMilestones 以 JSON 数组存储，按天数升序
+type StreakMilestones []StreakMilestone
+
+// DefaultStreakMilestones are used by families without their own
+var DefaultStreakMilestones = StreakMilestones{{Days: 7, Points: 20}, {Days: 30, Points: 100}}
+
+func (m StreakMilestones) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+func (m *StreakMilestones) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	default:
+		return fmt.Errorf("cannot scan %T into StreakMilestones", value)
+	}
+}
+
+// StreakBonus 已发放的连续完成奖励，同一段连续记录（按开始日期区分）的每个里程碑只发一次
+type StreakBonus struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	StudentID uint      `gorm:"uniqueIndex:idx_streak_bonus,priority:1" json:"student_id"`
+	Days      int       `gorm:"uniqueIndex:idx_streak_bonus,priority:2" json:"days"`
+	StartDate string    `gorm:"type:varchar(10);uniqueIndex:idx_streak_bonus,priority:3" json:"start_date"` // 连续记录开始的日期
+	Points    int       `json:"points"`
+}
+
+// FamilyInvite 家庭邀请码，第二位家长或孩子凭码加入家庭
+type FamilyInvite struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Code      string    `gorm:"type:varchar(16);uniqueIndex" json:"code"`
+	FamilyID  uint      `gorm:"index" json:"family_id"`
+	CreatorID uint      `json:"creator_id"`
+	Role      string    `json:"role"`     // 限定加入者角色：'parent', 'student'，空为不限
+	MaxUses   int       `json:"max_uses"` // 0 为不限次数
+	Uses      int       `json:"uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 type Task struct {
 	ID         uint       `gorm:"primarykey" json:"id"`
 	CreatedAt  time.Time  `json:"created_at"`
 	UpdatedAt  time.Time  `json:"updated_at"`
-	DeletedAt  *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+	DeletedAt  *time.Time `gorm:"index" json:"deleted_at,omitempty"` // 非空表示已删除
+	ArchivedAt *time.Time `json:"archived_at"`                        // 非空表示已停用，可恢复
 	Title      string     `json:"title"`
 	Points     int        `json:"points"`
-	Type       int        `json:"type"` // 1:Study, 2:Chore, 3:Habit
-	Recurrence string     `json:"recurrence"`
+	Type       int        `json:"type"` // 见 TaskType* 常量
+	Subject    string     `gorm:"type:varchar(32);index" json:"subject"` // 学科，如 math、chinese、english，学习任务使用
+	Description string    `gorm:"type:text" json:"description"`
+	EstimatedMinutes int  `json:"estimated_minutes"` // 预计用时（分钟），0 为未设置
+	Difficulty int        `json:"difficulty"`        // 难度 1-5，0 为未设置
+	DueTime    string     `gorm:"type:varchar(5)" json:"due_time"` // 当天截止时间 HH:MM，空为不限
+	DueDate    string     `gorm:"type:varchar(10)" json:"due_date"` // 单次任务的截止日期 YYYY-MM-DD，空为不限
+	Recurrence string     `json:"recurrence"` // '' (one-off), 'daily', 'weekdays', 'weekly:mon,wed' or cron
+	FamilyID   uint       `gorm:"index" json:"family_id"`
+	AssigneeIDs UintList  `gorm:"type:json" json:"assignee_ids"` // 指定的孩子，为空表示家庭中的所有孩子
+}
+
+// Task types
+const (
+	TaskTypeStudy = 1
+	TaskTypeChore = 2
+	TaskTypeHabit = 3
+)
+
+// TaskTypeNames maps the task types to the names used by the API
+var TaskTypeNames = map[int]string{
+	TaskTypeStudy: "study",
+	TaskTypeChore: "chore",
+	TaskTypeHabit: "habit",
+}
+
+// ParseTaskType accepts a task type by name ("study") or number ("1")
+func ParseTaskType(value string) (int, bool) {
+	for taskType, name := range TaskTypeNames {
+		if value == name || value == fmt.Sprint(taskType) {
+			return taskType, true
+		}
+	}
+	return 0, false
+}
+
+// IsAssigned reports whether the task is assigned to studentID
+func (t *Task) IsAssigned(studentID uint) bool {
+	if len(t.AssigneeIDs) == 0 {
+		return true
+	}
+	for _, id := range t.AssigneeIDs {
+		if id == studentID {
+			return true
+		}
+	}
+	return false
+}
+
+// UintList 以 JSON 数组存储的 ID 列表
+type UintList []uint
+
+func (l UintList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(l)
+	return string(data), err
+}
+
+func (l *UintList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	default:
+		return fmt.Errorf("cannot scan %T into UintList", value)
+	}
 }
 
 type TaskLog struct {
@@ -35,25 +211,116 @@ type TaskLog struct {
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
 	DeletedAt   *time.Time `gorm:"index" json:"deleted_at,omitempty"`
-	StudentID   uint       `json:"student_id"`
-	TaskID      uint       `json:"task_id"`
-	Status      int        `json:"status"` // 0:InProgress, 1:Pending, 2:Done, 3:Rejected
+	StudentID   uint       `gorm:"uniqueIndex:idx_task_student_date,priority:2" json:"student_id"`
+	TaskID      uint       `gorm:"uniqueIndex:idx_task_student_date,priority:1" json:"task_id"`
+	// OccurrenceDate is the day (YYYY-MM-DD) this log was scheduled for
+	OccurrenceDate string  `gorm:"type:varchar(10);uniqueIndex:idx_task_student_date,priority:3" json:"occurrence_date"`
+	Status      int        `json:"status"` // 见 TaskStatus* 常量
 	SubmittedAt *time.Time `json:"submitted_at"`
 	ApprovedAt  *time.Time `json:"approved_at"`
+	DueAt       *time.Time `gorm:"index" json:"due_at"`     // 截止时间，空为不限
+	OverdueAt   *time.Time `json:"overdue_at"`              // 截止时仍未提交（逾期未交或逾期提交）时记录，非空表示已逾期
+	AwardedPoints *int      `json:"awarded_points"` // 审核通过时实际发放的积分
+	Attempts     int        `json:"attempts"`      // 提交次数，被驳回后重新提交时加一
+	RejectReason string     `json:"reject_reason"` // 最近一次驳回的原因
+	RejectedAt   *time.Time `json:"rejected_at"`
+	ProofImg    ProofImages `gorm:"type:json" json:"-"`         // 凭证图片在存储中的位置
+	Proofs      []ProofLink `gorm:"-" json:"proofs,omitempty"` // 签名后的访问地址，由服务层填充
 	Task        Task       `json:"task" gorm:"foreignKey:TaskID"` // Preload
 }
 
+// TaskLog statuses. Allowed changes: todo -> pending, pending -> done,
+// pending -> rejected, rejected -> pending (resubmission), and todo or
+// rejected -> cancelled when the task is archived, deleted or reassigned.
+const (
+	TaskStatusTodo      = 0
+	TaskStatusPending   = 1
+	TaskStatusDone      = 2
+	TaskStatusRejected  = 3
+	TaskStatusCancelled = 4
+)
+
+// TaskComment 任务记录下的留言，家长和学生围绕一次提交的对话
+type TaskComment struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LogID      uint      `gorm:"index" json:"log_id"`
+	AuthorID   uint      `json:"author_id"`
+	AuthorRole string    `gorm:"type:varchar(16)" json:"author_role"` // 'parent', 'student'
+	Kind       string    `gorm:"type:varchar(16)" json:"kind"`
+	Attempt    int       `json:"attempt"` // 留言时所针对的第几次提交
+	Content    string    `gorm:"type:text" json:"content"`
+}
+
+// Task comment kinds
+const (
+	TaskCommentMessage   = "message"
+	TaskCommentRejection = "rejection" // 驳回时自动记录的原因
+)
+
+// ProofImage 一张凭证图片及其缩略图的存储 key
+type ProofImage struct {
+	Key          string `json:"key"`
+	ThumbnailKey string `json:"thumbnail_key"`
+	ContentType  string `json:"content_type"`
+	Size         int    `json:"size"`
+}
+
+// ProofImages 以 JSON 数组存储在 task_logs.proof_img 中
+type ProofImages []ProofImage
+
+func (p ProofImages) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(p)
+	return string(data), err
+}
+
+func (p *ProofImages) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
+		return fmt.Errorf("cannot scan %T into ProofImages", value)
+	}
+}
+
+// ProofLink 凭证图片的临时访问地址
+type ProofLink struct {
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
 type Reward struct {
-	ID        uint      `gorm:"primarykey" json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
-	Title    string `json:"title"`
-	Cost     int    `json:"cost"`
-	Category int    `json:"category"` // 1:Time, 2:Item
-	Stock    int    `json:"stock"`
+	ID          uint       `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	DeletedAt   *time.Time `gorm:"index" json:"deleted_at,omitempty"` // 非空表示已下架
+	Title       string     `json:"title"`
+	Cost        int        `json:"cost"`
+	Category    int        `json:"category"`               // 1:Time, 2:Item, 3:Privilege, 4:Activity
+	Stock       int        `json:"stock"`                  // -1 为无限库存
+	Minutes     int        `json:"minutes"`                // 娱乐时间类奖励兑换后获得的分钟数
+	FamilyID    uint       `gorm:"index" json:"family_id"` // 0: 所有家庭共享的默认奖励
+	Description string     `json:"description"`
+	ImageURL    string     `json:"image_url"`
+	SortOrder   int        `json:"sort_order"`
 }
 
+// Reward categories
+const (
+	RewardCategoryTime      = 1 // 娱乐时间，如看电视 30 分钟
+	RewardCategoryItem      = 2 // 实物奖励
+	RewardCategoryPrivilege = 3 // 特权，如晚睡半小时、选周末晚餐
+	RewardCategoryActivity  = 4 // 亲子活动，如去游乐园
+)
+
 type Redemption struct {
 	ID          uint       `gorm:"primarykey" json:"id"`
 	CreatedAt   time.Time  `json:"created_at"`
@@ -63,15 +330,252 @@ type Redemption struct {
 	RewardID    uint       `json:"reward_id"`
 	RewardTitle string     `json:"reward_title"` // Store title for display
 	Cost        int        `json:"cost"`
+	Minutes     int        `json:"minutes"` // 获得的娱乐时间（分钟）
+	Status      string     `gorm:"type:varchar(16);index;default:fulfilled" json:"status"`
+	Note        string     `json:"note"`       // 驳回原因等
+	HandledBy   uint       `json:"handled_by"` // 最后处理的家长
+	ApprovedAt  *time.Time `json:"approved_at"`
+	FulfilledAt *time.Time `json:"fulfilled_at"`
+	RefundedAt  *time.Time `json:"refunded_at"`
 	Student     User       `json:"student" gorm:"foreignKey:StudentID"`
 	Reward      Reward     `json:"reward" gorm:"foreignKey:RewardID"`
 }
 
+// Redemption statuses: requested -> approved -> fulfilled, or
+// requested/approved -> rejected by a parent, or requested -> cancelled by
+// the student. Rejected and cancelled redemptions are refunded (RefundedAt,
+// plus a refund entry on the ledger).
+const (
+	RedemptionRequested = "requested"
+	RedemptionApproved  = "approved"
+	RedemptionFulfilled = "fulfilled"
+	RedemptionRejected  = "rejected"
+	RedemptionCancelled = "cancelled"
+	// RedemptionRefunded is what rejected and cancelled redemptions were
+	// stored as before the two were told apart
+	RedemptionRefunded = "refunded"
+)
+
+// IsRefunded reports whether the redemption's points were given back
+func (r *Redemption) IsRefunded() bool {
+	return r.Status == RedemptionRejected || r.Status == RedemptionCancelled || r.Status == RedemptionRefunded
+}
+
+// ScreenTimeSession 一次娱乐时间的使用记录。剩余时间由服务端根据余额、
+// 已用秒数和最近一次开始/恢复的时间计算。
+type ScreenTimeSession struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	StudentID   uint       `gorm:"index" json:"student_id"`
+	Status      string     `gorm:"type:varchar(16);index" json:"status"`
+	UsedSeconds int        `json:"used_seconds"` // 截至 ResumedAt 已用的秒数
+	StartedAt   time.Time  `json:"started_at"`
+	ResumedAt   *time.Time `json:"resumed_at"` // 计时中时为本段开始时间
+	EndedAt     *time.Time `json:"ended_at"`
+	Student     User       `json:"student" gorm:"foreignKey:StudentID"`
+}
+
+// Screen time session statuses
+const (
+	ScreenTimeActive  = "active"
+	ScreenTimePaused  = "paused"
+	ScreenTimeStopped = "stopped"
+	ScreenTimeExpired = "expired"
+)
+
+// PointTransaction 积分流水：每一次积分余额变动都对应一条记录
+type PointTransaction struct {
+	ID           uint      `gorm:"primarykey" json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UserID       uint      `gorm:"index" json:"user_id"`
+	SourceType   string    `gorm:"type:varchar(32);index:idx_point_source" json:"source_type"` // 'task', 'redemption'
+	SourceID     uint      `gorm:"index:idx_point_source" json:"source_id"`
+	Delta        int       `json:"delta"`
+	BalanceAfter int       `json:"balance_after"`
+	ActorID      uint      `json:"actor_id"` // 触发变动的用户（审核的家长 / 兑换的学生）
+	Remark       string    `json:"remark"`
+}
+
+// IsEarning reports whether the entry counts towards the lifetime points:
+// credits for tasks and streaks, but not refunds of spent points
+func (t *PointTransaction) IsEarning() bool {
+	return t.Delta > 0 && (t.SourceType == PointSourceTask || t.SourceType == PointSourceStreak)
+}
+
+// LevelUp 学生升级记录，每个等级只记录一次；SeenAt 为空表示学生还没看到升级提示
+type LevelUp struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StudentID   uint       `gorm:"uniqueIndex:idx_level_up,priority:1" json:"student_id"`
+	Level       int        `gorm:"uniqueIndex:idx_level_up,priority:2" json:"level"`
+	FromLevel   int        `json:"from_level"`
+	Title       string     `json:"title"`
+	Icon        string     `json:"icon"`
+	TotalPoints int        `json:"total_points"` // 升级时的累计积分
+	SeenAt      *time.Time `json:"seen_at"`
+}
+
+// Badge 成就徽章目录。Rule 决定统计什么，达到 Target 即解锁；TaskType、
+// Subject 和 WindowDays 只对 tasks_approved 生效
+type Badge struct {
+	ID          uint   `gorm:"primarykey" json:"id"`
+	Code        string `gorm:"type:varchar(64);uniqueIndex" json:"code"`
+	Name        string `gorm:"type:varchar(64)" json:"name"`
+	Description string `json:"description"`
+	Icon        string `gorm:"type:varchar(16)" json:"icon"`
+	Rule        string `gorm:"type:varchar(32)" json:"rule"` // 见 BadgeRule* 常量
+	Target      int    `json:"target"`
+	TaskType    int    `json:"task_type,omitempty"`                      // 0 表示任意类型
+	Subject     string `gorm:"type:varchar(32)" json:"subject,omitempty"` // 空表示任意学科
+	WindowDays  int    `json:"window_days,omitempty"`                    // 只统计最近几天（含今天）审核通过的任务，0 表示不限
+	SortOrder   int    `json:"sort_order"`
+}
+
+// Badge rules
+const (
+	BadgeRuleTasksApproved  = "tasks_approved"  // 审核通过的任务数
+	BadgeRulePointsBalance  = "points_balance"  // 当前积分余额
+	BadgeRuleLifetimePoints = "lifetime_points" // 累计获得积分
+	BadgeRuleRedemptions    = "redemptions"     // 兑换次数（不含已退回的）
+	BadgeRuleStreakDays     = "streak_days"     // 最长连续完成天数
+)
+
+// BadgeUnlock 学生解锁的徽章，每个徽章只解锁一次；Source 记录触发解锁的
+// 任务记录或兑换
+type BadgeUnlock struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	StudentID  uint      `gorm:"uniqueIndex:idx_badge_unlock,priority:1" json:"student_id"`
+	BadgeID    uint      `gorm:"uniqueIndex:idx_badge_unlock,priority:2" json:"badge_id"`
+	SourceType string    `gorm:"type:varchar(32)" json:"source_type"` // 'task', 'redemption'
+	SourceID   uint      `json:"source_id"`
+}
+
+// Webhook 家庭的事件推送地址。事件以 JSON POST 到 URL，并用 Secret 做
+// HMAC-SHA256 签名
+type Webhook struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	FamilyID    uint      `gorm:"index" json:"family_id"`
+	URL         string    `gorm:"type:varchar(512)" json:"url"`
+	Secret      string    `gorm:"type:varchar(64)" json:"-"` // 只在创建和更换时返回一次
+	Events      string    `gorm:"type:varchar(255)" json:"events"` // 逗号分隔的事件类型，如 'task.submitted,task.approved'；为空表示全部
+	Description string    `json:"description"`
+	Enabled     bool      `json:"enabled"`
+}
+
+// WebhookDelivery 一次事件推送及其重试情况，同时作为推送日志
+type WebhookDelivery struct {
+	ID             uint       `gorm:"primarykey" json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	WebhookID      uint       `gorm:"index" json:"webhook_id"`
+	EventID        uint64     `json:"event_id"`
+	EventType      string     `gorm:"type:varchar(32)" json:"event_type"`
+	Payload        string     `gorm:"type:text" json:"payload"`
+	Status         string     `gorm:"type:varchar(16);index:idx_delivery_due,priority:1" json:"status"` // 见 WebhookDelivery* 常量
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  *time.Time `gorm:"index:idx_delivery_due,priority:2" json:"next_attempt_at"`
+	LastStatusCode int        `json:"last_status_code"` // 最近一次的 HTTP 状态码，0 表示没有收到响应
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	Webhook        Webhook    `json:"-" gorm:"foreignKey:WebhookID"`
+}
+
+// Webhook delivery statuses: pending until a 2xx response, failed once the
+// retries are used up
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Device 家庭登记的受控设备（电视、智能插座等），通过家庭网关订阅的 MQTT
+// Topic 接收开关命令：孩子的娱乐时间开始时打开，暂停、结束或用完时关闭
+type Device struct {
+	ID            uint       `gorm:"primarykey" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	FamilyID      uint       `gorm:"index" json:"family_id"`
+	StudentID     uint       `json:"student_id"` // 跟随的孩子；0 表示家里任一孩子在计时就打开
+	Name          string     `gorm:"type:varchar(64)" json:"name"`
+	Topic         string     `gorm:"type:varchar(255)" json:"topic"` // 为空时使用配置中的 mqtt.topic_template
+	Enabled       bool       `json:"enabled"`
+	LastCommand   string     `gorm:"type:varchar(8)" json:"last_command"` // 最近一次发送的命令 'on' / 'off'
+	LastCommandAt *time.Time `json:"last_command_at"`
+	LastError     string     `json:"last_error"` // 最近一次发送失败的原因，成功后清空
+	ControlTopic  string     `gorm:"-" json:"control_topic"` // 实际使用的 Topic，由服务端填写
+}
+
+// Device commands
+const (
+	DeviceCommandOn  = "on"
+	DeviceCommandOff = "off"
+)
+
+// Point transaction source types
+const (
+	PointSourceTask       = "task"
+	PointSourceRedemption = "redemption"
+	PointSourceRefund     = "refund"
+	PointSourcePenalty    = "penalty"
+	PointSourceStreak     = "streak"
+)
+
+// AppConfig 动态配置。同一个 key 可以有多条记录，按平台和最低版本选出
+// 最匹配的一条；Value 为 JSON
 type AppConfig struct {
-	Key        string `gorm:"primaryKey" json:"key"`
-	Value      string `json:"value"`
-	Platform   string `json:"platform"`
-	MinVersion string `json:"min_version"`
+	ID         uint      `gorm:"primarykey" json:"id"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Key        string    `gorm:"type:varchar(64);uniqueIndex:idx_config_target,priority:1" json:"key"`
+	Value      string    `gorm:"type:text" json:"value"`
+	Platform   string    `gorm:"type:varchar(10);uniqueIndex:idx_config_target,priority:2" json:"platform"` // 'ios', 'android', 'all'
+	MinVersion string    `gorm:"type:varchar(16);uniqueIndex:idx_config_target,priority:3" json:"min_version"`
+}
+
+const ConfigPlatformAll = "all"
+
+// FeatureFlag 功能开关。Enabled 为总开关；开启后按平台、家庭覆盖和按家庭
+// 灰度百分比依次判断
+type FeatureFlag struct {
+	ID          uint                  `gorm:"primarykey" json:"id"`
+	UpdatedAt   time.Time             `json:"updated_at"`
+	Key         string                `gorm:"type:varchar(64);uniqueIndex" json:"key"`
+	Description string                `json:"description"`
+	Enabled     bool                  `json:"enabled"`
+	Platforms   string                `gorm:"type:varchar(64)" json:"platforms"` // 逗号分隔，如 'ios,android'；为空表示所有平台
+	Percentage  int                   `json:"percentage"`                         // 0-100，按家庭灰度
+	Overrides   []FeatureFlagOverride `gorm:"foreignKey:FlagID" json:"overrides"`
+}
+
+// FeatureFlagOverride 针对单个家庭强制开启或关闭某个功能
+type FeatureFlagOverride struct {
+	ID       uint `gorm:"primarykey" json:"id"`
+	FlagID   uint `gorm:"uniqueIndex:idx_flag_family,priority:1" json:"flag_id"`
+	FamilyID uint `gorm:"uniqueIndex:idx_flag_family,priority:2" json:"family_id"`
+	Enabled  bool `json:"enabled"`
+}
+
+// Feature flag keys checked by the server
+const (
+	FeatureMall       = "mall"
+	FeatureGameCenter = "game_center"
+)
+
+// IdempotencyKey 记录带 Idempotency-Key 请求头的写请求及其响应。同一用户
+// 重试相同的 key 时直接返回保存的响应，不会重复执行。
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UserID      uint      `gorm:"uniqueIndex:idx_idempotency_user_key,priority:1" json:"user_id"`
+	Key         string    `gorm:"column:idempotency_key;type:varchar(255);uniqueIndex:idx_idempotency_user_key,priority:2" json:"key"`
+	RequestHash string    `gorm:"type:char(64)" json:"request_hash"` // 方法、路径和请求体的 SHA-256
+	StatusCode  int       `json:"status_code"`                       // 0 表示请求仍在处理中
+	ContentType string    `json:"content_type"`
+	Response    []byte    `gorm:"type:mediumblob" json:"-"`
+	ExpiresAt   time.Time `gorm:"index" json:"expires_at"`
 }
 
 type Session struct {
@@ -0,0 +1,371 @@
+// Package mqtt is a small MQTT 3.1.1 client that only publishes. It is
+// enough to send commands to home gateways (Home Assistant, Node-RED, a
+// Tasmota plug...) through a broker such as Mosquitto.
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Control packet types, already shifted into the high nibble
+const (
+	packetConnect    = 1 << 4
+	packetConnack    = 2 << 4
+	packetPublish    = 3 << 4
+	packetPuback     = 4 << 4
+	packetPingreq    = 12 << 4
+	packetPingresp   = 13 << 4
+	packetDisconnect = 14 << 4
+)
+
+const maxRemainingLength = 268435455
+
+var ErrInvalidTopic = errors.New("invalid mqtt topic")
+
+// Options configures a Client
+type Options struct {
+	// Broker is "tcp://host:1883" or "tls://host:8883" ("mqtt://", "ssl://"
+	// and "mqtts://" work too); a bare "host:port" means tcp
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive is announced to the broker; an idle connection is pinged
+	// before the next publish and replaced when the ping goes unanswered
+	KeepAlive time.Duration
+	// Timeout bounds connecting and waiting for the broker's answers
+	Timeout time.Duration
+}
+
+// Client publishes messages over a single connection that is opened on the
+// first publish and reopened after an error. It is safe for concurrent use;
+// publishes are sent one at a time.
+type Client struct {
+	opts     Options
+	scheme   string
+	host     string
+	mu       sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+	lastUsed time.Time
+	packetID uint16
+	// dial replaces dialing the broker; tests set it to talk over a pipe
+	dial func() (net.Conn, error)
+}
+
+// NewClient checks the options; it does not connect yet
+func NewClient(opts Options) (*Client, error) {
+	broker := opts.Broker
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid mqtt broker %q", opts.Broker)
+	}
+	scheme := u.Scheme
+	switch scheme {
+	case "tcp", "mqtt":
+		scheme = "tcp"
+	case "tls", "ssl", "mqtts":
+		scheme = "tls"
+	default:
+		return nil, fmt.Errorf("unsupported mqtt broker scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		port := "1883"
+		if scheme == "tls" {
+			port = "8883"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.KeepAlive < 0 || opts.KeepAlive > 65535*time.Second {
+		return nil, fmt.Errorf("mqtt keep alive must be between 0 and 65535s")
+	}
+	return &Client{opts: opts, scheme: scheme, host: host}, nil
+}
+
+// ValidTopic reports whether topic can be published to: not empty, at most
+// 65535 bytes, without wildcards or NUL characters
+func ValidTopic(topic string) bool {
+	return topic != "" && len(topic) <= 65535 && !strings.ContainsAny(topic, "+#\x00")
+}
+
+// Publish sends payload to topic. With qos 1 it waits until the broker has
+// acknowledged the message. When the connection turns out to be broken the
+// message is sent once more over a new one.
+func (c *Client) Publish(topic string, qos byte, retain bool, payload []byte) error {
+	if !ValidTopic(topic) {
+		return ErrInvalidTopic
+	}
+	if qos > 1 {
+		return fmt.Errorf("mqtt qos %d is not supported", qos)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fresh := c.conn == nil
+	if err := c.ensureConnected(); err != nil {
+		return err
+	}
+	err := c.publish(topic, qos, retain, payload)
+	if err != nil && !fresh {
+		c.closeConn()
+		if err = c.ensureConnected(); err != nil {
+			return err
+		}
+		err = c.publish(topic, qos, retain, payload)
+	}
+	if err != nil {
+		c.closeConn()
+		return err
+	}
+	c.lastUsed = time.Now()
+	return nil
+}
+
+// Close disconnects from the broker
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.opts.Timeout))
+	_, err := c.conn.Write([]byte{packetDisconnect, 0})
+	c.closeConn()
+	return err
+}
+
+// ensureConnected connects when there is no connection and checks an idle
+// one with a ping, replacing it when the broker does not answer
+func (c *Client) ensureConnected() error {
+	if c.conn != nil && c.opts.KeepAlive > 0 && time.Since(c.lastUsed) >= c.opts.KeepAlive {
+		if err := c.ping(); err != nil {
+			c.closeConn()
+		}
+	}
+	if c.conn != nil {
+		return nil
+	}
+	return c.connect()
+}
+
+func (c *Client) connect() error {
+	dialer := &net.Dialer{Timeout: c.opts.Timeout}
+	var conn net.Conn
+	var err error
+	switch {
+	case c.dial != nil:
+		conn, err = c.dial()
+	case c.scheme == "tls":
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.host, &tls.Config{ServerName: hostname(c.host)})
+	default:
+		conn, err = dialer.Dial("tcp", c.host)
+	}
+	if err != nil {
+		return fmt.Errorf("connect to mqtt broker: %w", err)
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+
+	// Variable header: protocol name, level 4 (3.1.1), flags, keep alive
+	var body []byte
+	body = appendString(body, "MQTT")
+	flags := byte(0x02) // clean session
+	if c.opts.Username != "" {
+		flags |= 0x80
+		if c.opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(c.opts.KeepAlive/time.Second))
+	body = appendString(body, c.opts.ClientID)
+	if c.opts.Username != "" {
+		body = appendString(body, c.opts.Username)
+		if c.opts.Password != "" {
+			body = appendString(body, c.opts.Password)
+		}
+	}
+	if err := c.write(packetConnect, body); err != nil {
+		c.closeConn()
+		return err
+	}
+
+	packetType, ack, err := c.read()
+	if err != nil {
+		c.closeConn()
+		return err
+	}
+	if packetType != packetConnack || len(ack) != 2 {
+		c.closeConn()
+		return fmt.Errorf("mqtt broker answered connect with packet type %d", packetType>>4)
+	}
+	if ack[1] != 0 {
+		c.closeConn()
+		return fmt.Errorf("mqtt broker refused the connection: %s", connackReason(ack[1]))
+	}
+	c.lastUsed = time.Now()
+	return nil
+}
+
+func (c *Client) publish(topic string, qos byte, retain bool, payload []byte) error {
+	header := byte(packetPublish) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+	body := appendString(nil, topic)
+	var id uint16
+	if qos > 0 {
+		c.packetID++
+		if c.packetID == 0 {
+			c.packetID = 1
+		}
+		id = c.packetID
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+	if err := c.write(header, body); err != nil {
+		return err
+	}
+	if qos == 0 {
+		return nil
+	}
+
+	for {
+		packetType, ack, err := c.read()
+		if err != nil {
+			return err
+		}
+		if packetType == packetPuback && len(ack) == 2 && binary.BigEndian.Uint16(ack) == id {
+			return nil
+		}
+		// Anything else (a late PINGRESP, an ack of an abandoned publish) is skipped
+	}
+}
+
+func (c *Client) ping() error {
+	if err := c.write(packetPingreq, nil); err != nil {
+		return err
+	}
+	for {
+		packetType, _, err := c.read()
+		if err != nil {
+			return err
+		}
+		if packetType == packetPingresp {
+			return nil
+		}
+	}
+}
+
+func (c *Client) write(header byte, body []byte) error {
+	if len(body) > maxRemainingLength {
+		return errors.New("mqtt packet too large")
+	}
+	packet := append([]byte{header}, remainingLength(len(body))...)
+	packet = append(packet, body...)
+	c.conn.SetWriteDeadline(time.Now().Add(c.opts.Timeout))
+	_, err := c.conn.Write(packet)
+	return err
+}
+
+// read returns the next packet's type (high nibble of the fixed header) and
+// its body
+func (c *Client) read() (byte, []byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.opts.Timeout))
+	header, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("malformed mqtt remaining length")
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xf0, body, nil
+}
+
+func (c *Client) closeConn() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn = nil
+	c.reader = nil
+}
+
+// remainingLength encodes n as the variable-length integer of the fixed
+// header
+func remainingLength(n int) []byte {
+	var out []byte
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			return out
+		}
+	}
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func hostname(hostport string) string {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return hostport
+	}
+	return host
+}
+
+func connackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("return code %d", code)
+}
@@ -0,0 +1,309 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRemainingLength(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{maxRemainingLength, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+	for _, tt := range tests {
+		if got := remainingLength(tt.n); !bytes.Equal(got, tt.want) {
+			t.Errorf("remainingLength(%d) = % x, want % x", tt.n, got, tt.want)
+		}
+
+		// read must decode what remainingLength encodes
+		packet := append([]byte{packetPublish}, tt.want...)
+		if tt.n <= 16384 {
+			packet = append(packet, make([]byte, tt.n)...)
+			c := &Client{opts: Options{Timeout: time.Second}, reader: bufio.NewReader(bytes.NewReader(packet)), conn: nopConn{}}
+			_, body, err := c.read()
+			if err != nil || len(body) != tt.n {
+				t.Errorf("read of a %d byte body = %d bytes, %v", tt.n, len(body), err)
+			}
+		}
+	}
+}
+
+func TestValidTopic(t *testing.T) {
+	tests := map[string]bool{
+		"studyquest/1/devices/2/control": true,
+		"":                               false,
+		"studyquest/+/devices":           false,
+		"studyquest/#":                   false,
+		"a\x00b":                         false,
+		strings.Repeat("a", 65535):       true,
+		strings.Repeat("a", 65536):       false,
+	}
+	for topic, want := range tests {
+		if got := ValidTopic(topic); got != want {
+			t.Errorf("ValidTopic(%.20q) = %v, want %v", topic, got, want)
+		}
+	}
+}
+
+func TestPublishFraming(t *testing.T) {
+	client, broker := pipeClient(t, Options{ClientID: "study-quest", Username: "user", Password: "secret", KeepAlive: 30 * time.Second})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Publish("studyquest/1/devices/2/control", 1, true, []byte(`{"command":"on"}`))
+	}()
+
+	header, body := broker.expect(t, packetConnect)
+	if header != packetConnect {
+		t.Fatalf("CONNECT flags = %#x, want 0", header&0x0f)
+	}
+	var want []byte
+	want = appendString(want, "MQTT")
+	want = append(want, 4, 0xc2) // level 4; user name, password and clean session
+	want = binary.BigEndian.AppendUint16(want, 30)
+	want = appendString(want, "study-quest")
+	want = appendString(want, "user")
+	want = appendString(want, "secret")
+	if !bytes.Equal(body, want) {
+		t.Fatalf("CONNECT body = % x, want % x", body, want)
+	}
+	broker.send(t, packetConnack, []byte{0, 0})
+
+	header, body = broker.expect(t, packetPublish)
+	if flags := header & 0x0f; flags != 0x03 {
+		t.Fatalf("PUBLISH flags = %#x, want qos 1 and retain (0x3)", flags)
+	}
+	want = appendString(nil, "studyquest/1/devices/2/control")
+	want = append(want, 0, 1) // first packet id
+	want = append(want, `{"command":"on"}`...)
+	if !bytes.Equal(body, want) {
+		t.Fatalf("PUBLISH body = % x, want % x", body, want)
+	}
+
+	// An unrelated packet and an ack of another id are skipped
+	broker.send(t, packetPingresp, nil)
+	broker.send(t, packetPuback, []byte{0, 7})
+	broker.send(t, packetPuback, []byte{0, 1})
+	if err := waitErr(t, done); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	// QoS 0 reuses the connection and does not wait for an answer
+	go func() {
+		done <- client.Publish("studyquest/1/devices/2/control", 0, false, []byte("OFF"))
+	}()
+	header, body = broker.expect(t, packetPublish)
+	if err := waitErr(t, done); err != nil {
+		t.Fatalf("Publish qos 0: %v", err)
+	}
+	if flags := header & 0x0f; flags != 0 {
+		t.Fatalf("PUBLISH qos 0 flags = %#x, want 0", flags)
+	}
+	if want := append(appendString(nil, "studyquest/1/devices/2/control"), "OFF"...); !bytes.Equal(body, want) {
+		t.Fatalf("PUBLISH qos 0 body = % x, want % x", body, want)
+	}
+}
+
+func TestPublishRefusedConnection(t *testing.T) {
+	client, broker := pipeClient(t, Options{ClientID: "study-quest"})
+
+	done := make(chan error, 1)
+	go func() { done <- client.Publish("a/b", 1, false, nil) }()
+	broker.expect(t, packetConnect)
+	broker.send(t, packetConnack, []byte{0, 5})
+
+	err := waitErr(t, done)
+	if err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Fatalf("Publish = %v, want a not authorized error", err)
+	}
+	if client.conn != nil {
+		t.Fatal("refused connection was kept")
+	}
+}
+
+func TestPublishRejectsBadInput(t *testing.T) {
+	client, _ := pipeClient(t, Options{})
+	if err := client.Publish("a/#", 0, false, nil); err != ErrInvalidTopic {
+		t.Errorf("Publish to a wildcard topic = %v, want ErrInvalidTopic", err)
+	}
+	if err := client.Publish("a/b", 2, false, nil); err == nil {
+		t.Error("Publish with qos 2 succeeded")
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		broker string
+		host   string
+		scheme string
+	}{
+		{"127.0.0.1", "127.0.0.1:1883", "tcp"},
+		{"mqtt://broker.local", "broker.local:1883", "tcp"},
+		{"tcp://broker.local:1884", "broker.local:1884", "tcp"},
+		{"mqtts://broker.local", "broker.local:8883", "tls"},
+		{"ssl://broker.local:9883", "broker.local:9883", "tls"},
+	}
+	for _, tt := range tests {
+		c, err := NewClient(Options{Broker: tt.broker})
+		if err != nil {
+			t.Errorf("NewClient(%q): %v", tt.broker, err)
+			continue
+		}
+		if c.host != tt.host || c.scheme != tt.scheme {
+			t.Errorf("NewClient(%q) = %s %s, want %s %s", tt.broker, c.scheme, c.host, tt.scheme, tt.host)
+		}
+	}
+	for _, broker := range []string{"ws://broker.local", "tcp://"} {
+		if _, err := NewClient(Options{Broker: broker}); err == nil {
+			t.Errorf("NewClient(%q) succeeded", broker)
+		}
+	}
+}
+
+// TestBroker publishes a retained message to a real broker and reads it
+// back with a subscription. It runs when MQTT_TEST_BROKER is set, e.g. to
+// tcp://127.0.0.1:1883 with a local Mosquitto.
+func TestBroker(t *testing.T) {
+	address := os.Getenv("MQTT_TEST_BROKER")
+	if address == "" {
+		t.Skip("MQTT_TEST_BROKER is not set")
+	}
+	topic := "studyquest/test/" + time.Now().Format("150405.000000")
+	payload := []byte(`{"command":"on"}`)
+
+	publisher, err := NewClient(Options{Broker: address, ClientID: "study-quest-test-pub", KeepAlive: 10 * time.Second, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Close()
+	if err := publisher.Publish(topic, 1, true, payload); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	subscriber, err := NewClient(Options{Broker: address, ClientID: "study-quest-test-sub", Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscriber.Close()
+	if err := subscriber.connect(); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	body := binary.BigEndian.AppendUint16(nil, 1)
+	body = appendString(body, topic)
+	body = append(body, 1)
+	if err := subscriber.write(0x82, body); err != nil { // SUBSCRIBE
+		t.Fatal(err)
+	}
+	for {
+		packetType, body, err := subscriber.read()
+		if err != nil {
+			t.Fatalf("waiting for the retained message: %v", err)
+		}
+		if packetType != packetPublish {
+			continue
+		}
+		size := int(binary.BigEndian.Uint16(body))
+		if got := string(body[2 : 2+size]); got != topic {
+			t.Fatalf("received topic %q, want %q", got, topic)
+		}
+		// QoS 1 delivery: a packet id follows the topic
+		if got := body[2+size+2:]; !bytes.Equal(got, payload) {
+			t.Fatalf("received payload %q, want %q", got, payload)
+		}
+		break
+	}
+
+	// Clear the retained message
+	if err := publisher.Publish(topic, 1, true, nil); err != nil {
+		t.Fatalf("clearing the retained message: %v", err)
+	}
+}
+
+// fakeBroker is the broker side of a pipe; it reuses the client's framing
+type fakeBroker struct {
+	*Client
+}
+
+func pipeClient(t *testing.T, opts Options) (*Client, *fakeBroker) {
+	t.Helper()
+	opts.Broker = "tcp://broker.test"
+	if opts.Timeout == 0 {
+		opts.Timeout = 2 * time.Second
+	}
+	client, err := NewClient(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientConn, brokerConn := net.Pipe()
+	dialed := false
+	client.dial = func() (net.Conn, error) {
+		if dialed {
+			t.Error("client dialed twice")
+		}
+		dialed = true
+		return clientConn, nil
+	}
+	t.Cleanup(func() {
+		clientConn.Close()
+		brokerConn.Close()
+	})
+	broker := &Client{opts: Options{Timeout: 2 * time.Second}, conn: brokerConn, reader: bufio.NewReader(brokerConn)}
+	return client, &fakeBroker{broker}
+}
+
+// expect reads the next packet and returns its full first byte and body
+func (b *fakeBroker) expect(t *testing.T, packetType byte) (byte, []byte) {
+	t.Helper()
+	b.conn.SetReadDeadline(time.Now().Add(b.opts.Timeout))
+	header, err := b.reader.Peek(1)
+	if err != nil {
+		t.Fatalf("waiting for packet type %d: %v", packetType>>4, err)
+	}
+	first := header[0]
+	got, body, err := b.read()
+	if err != nil {
+		t.Fatalf("reading packet type %d: %v", packetType>>4, err)
+	}
+	if got != packetType {
+		t.Fatalf("got packet type %d, want %d", got>>4, packetType>>4)
+	}
+	return first, body
+}
+
+func (b *fakeBroker) send(t *testing.T, header byte, body []byte) {
+	t.Helper()
+	if err := b.write(header, body); err != nil {
+		t.Fatalf("sending packet type %d: %v", header>>4, err)
+	}
+}
+
+func waitErr(t *testing.T, done <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Publish did not return")
+		return nil
+	}
+}
+
+// nopConn lets read be called on an in-memory reader
+type nopConn struct{ net.Conn }
+
+func (nopConn) SetReadDeadline(time.Time) error { return nil }
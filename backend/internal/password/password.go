@@ -0,0 +1,165 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// argon2id parameters for new hashes; existing hashes keep the parameters
+// encoded in them and are rehashed on login when these change
+const (
+	argonMemory  = 64 * 1024 // KiB
+	argonTime    = 3
+	argonThreads = 2
+	argonKeyLen  = 32
+	argonSaltLen = 16
+)
+
+// maxLength is bcrypt's input limit; longer passwords would be truncated
+const maxLength = 72
+
+var commonPasswords = map[string]bool{
+	"12345678": true, "123456789": true, "1234567890": true, "11111111": true,
+	"00000000": true, "88888888": true, "password": true, "password1": true,
+	"qwerty123": true, "abc12345": true, "a1234567": true, "iloveyou": true,
+}
+
+// Hasher hashes and verifies passwords with the configured algorithm
+type Hasher struct {
+	algorithm  string
+	bcryptCost int
+}
+
+func NewHasher(algorithm string, bcryptCost int) *Hasher {
+	if algorithm != AlgorithmArgon2id {
+		algorithm = AlgorithmBcrypt
+	}
+	if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+		bcryptCost = bcrypt.DefaultCost
+	}
+	return &Hasher{algorithm: algorithm, bcryptCost: bcryptCost}
+}
+
+// Hash returns an encoded hash of plain using the configured algorithm
+func (h *Hasher) Hash(plain string) (string, error) {
+	if h.algorithm == AlgorithmArgon2id {
+		salt := make([]byte, argonSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(plain), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, argonMemory, argonTime, argonThreads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), h.bcryptCost)
+	return string(hash), err
+}
+
+// Verify reports whether plain matches stored. needsRehash is true when the
+// stored value is a legacy plaintext password or was produced with another
+// algorithm or cost than the one currently configured.
+func (h *Hasher) Verify(stored, plain string) (ok bool, needsRehash bool) {
+	switch {
+	case strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$"):
+		if bcrypt.CompareHashAndPassword([]byte(stored), []byte(plain)) != nil {
+			return false, false
+		}
+		cost, _ := bcrypt.Cost([]byte(stored))
+		return true, h.algorithm != AlgorithmBcrypt || cost != h.bcryptCost
+
+	case strings.HasPrefix(stored, "$argon2id$"):
+		ok, current := verifyArgon2id(stored, plain)
+		if !ok {
+			return false, false
+		}
+		return true, h.algorithm != AlgorithmArgon2id || !current
+
+	default:
+		// Legacy rows stored the password as plaintext
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(plain)) != 1 {
+			return false, false
+		}
+		return true, true
+	}
+}
+
+// verifyArgon2id checks an encoded argon2id hash and reports whether it uses
+// the current parameters
+func verifyArgon2id(encoded, plain string) (ok bool, current bool) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false
+	}
+	var version int
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false
+	}
+
+	actual := argon2.IDKey([]byte(plain), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(actual, key) != 1 {
+		return false, false
+	}
+	current = memory == argonMemory && time == argonTime && threads == argonThreads && len(key) == argonKeyLen
+	return true, current
+}
+
+// Validate enforces the password strength rules for new passwords
+func Validate(plain, username string, minLength int) error {
+	if len(plain) < minLength {
+		return fmt.Errorf("password must be at least %d characters", minLength)
+	}
+	if len(plain) > maxLength {
+		return fmt.Errorf("password must be at most %d characters", maxLength)
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range plain {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return errors.New("password must contain both letters and digits")
+	}
+
+	lower := strings.ToLower(plain)
+	if commonPasswords[lower] {
+		return errors.New("password is too common")
+	}
+	if username != "" && strings.Contains(lower, strings.ToLower(username)) {
+		return errors.New("password must not contain the username")
+	}
+	return nil
+}
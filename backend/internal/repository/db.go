@@ -5,6 +5,8 @@ import (
 	"log"
 	"study-quest-backend/internal/config"
 	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/password"
+	"time"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 )
@@ -18,18 +20,88 @@ func InitDB(cfg config.DatabaseConfig) (*gorm.DB, error) {
 }
 
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	// app_configs used to be keyed by `key` alone; drop that primary key so
+	// the table can hold one row per key, platform and version
+	migrator := db.Migrator()
+	if migrator.HasTable(&model.AppConfig{}) && !migrator.HasColumn(&model.AppConfig{}, "ID") {
+		if err := db.Exec("ALTER TABLE app_configs DROP PRIMARY KEY").Error; err != nil {
+			return fmt.Errorf("failed to migrate app_configs: %w", err)
+		}
+	}
+
+	// total_points_earned is new: existing users start from what the ledger
+	// shows they earned, and at least their current balance
+	backfillEarned := migrator.HasTable(&model.User{}) && !migrator.HasColumn(&model.User{}, "TotalPointsEarned")
+
+	err := db.AutoMigrate(
 		&model.User{},
 		&model.Task{},
 		&model.TaskLog{},
+		&model.TaskComment{},
 		&model.Reward{},
 		&model.Redemption{},
 		&model.AppConfig{},
 		&model.Session{},
+		&model.IdempotencyKey{},
+		&model.PointTransaction{},
+		&model.StreakBonus{},
+		&model.LevelUp{},
+		&model.Badge{},
+		&model.BadgeUnlock{},
+		&model.Webhook{},
+		&model.WebhookDelivery{},
+		&model.Device{},
+		&model.Family{},
+		&model.FamilyInvite{},
+		&model.ScreenTimeSession{},
+		&model.FeatureFlag{},
+		&model.FeatureFlagOverride{},
 	)
+	if err != nil || !backfillEarned {
+		return err
+	}
+	err = db.Exec(`UPDATE users SET total_points_earned = GREATEST(points, (
+		SELECT COALESCE(SUM(delta), 0) FROM point_transactions
+		WHERE point_transactions.user_id = users.id AND delta > 0 AND source_type IN ?))`,
+		[]string{model.PointSourceTask, model.PointSourceStreak}).Error
+	if err != nil {
+		return fmt.Errorf("failed to backfill total_points_earned: %w", err)
+	}
+	return nil
+}
+
+// DefaultRewards is the starter catalog every new family receives
+func DefaultRewards() []model.Reward {
+	return []model.Reward{
+		{Title: "看电视 30分钟", Cost: 50, Category: model.RewardCategoryTime, Stock: -1, Minutes: 30, SortOrder: 0},
+		{Title: "玩手机 15分钟", Cost: 30, Category: model.RewardCategoryTime, Stock: -1, Minutes: 15, SortOrder: 1},
+		{Title: "吃冰淇淋", Cost: 40, Category: model.RewardCategoryItem, Stock: 10, SortOrder: 2},
+		{Title: "去游乐园", Cost: 200, Category: model.RewardCategoryActivity, Stock: 5, SortOrder: 3},
+	}
 }
 
-func SeedData(db *gorm.DB) error {
+// DefaultBadges is the built-in badge catalog. New codes are added to
+// existing catalogs on startup; badges already there are not overwritten.
+func DefaultBadges() []model.Badge {
+	return []model.Badge{
+		{Code: "first_homework", Name: "第一份作业", Description: "第一次完成学习任务并通过审核", Icon: "📝", Rule: model.BadgeRuleTasksApproved, Target: 1, TaskType: model.TaskTypeStudy, SortOrder: 0},
+		{Code: "homework_50", Name: "作业小能手", Description: "累计完成 50 个学习任务", Icon: "📚", Rule: model.BadgeRuleTasksApproved, Target: 50, TaskType: model.TaskTypeStudy, SortOrder: 1},
+		{Code: "chores_week_10", Name: "家务小帮手", Description: "7 天内完成 10 个家务任务", Icon: "🧹", Rule: model.BadgeRuleTasksApproved, Target: 10, TaskType: model.TaskTypeChore, WindowDays: 7, SortOrder: 2},
+		{Code: "tasks_100", Name: "任务达人", Description: "累计完成 100 个任务", Icon: "✅", Rule: model.BadgeRuleTasksApproved, Target: 100, SortOrder: 3},
+		{Code: "streak_7", Name: "坚持一周", Description: "连续 7 天完成任务", Icon: "🔥", Rule: model.BadgeRuleStreakDays, Target: 7, SortOrder: 4},
+		{Code: "streak_30", Name: "月度坚持", Description: "连续 30 天完成任务", Icon: "🌙", Rule: model.BadgeRuleStreakDays, Target: 30, SortOrder: 5},
+		{Code: "saver_500", Name: "小小储蓄家", Description: "积分余额达到 500", Icon: "🐷", Rule: model.BadgeRulePointsBalance, Target: 500, SortOrder: 6},
+		{Code: "earned_1000", Name: "千分俱乐部", Description: "累计获得 1000 积分", Icon: "💎", Rule: model.BadgeRuleLifetimePoints, Target: 1000, SortOrder: 7},
+		{Code: "first_redemption", Name: "第一次兑换", Description: "第一次用积分兑换奖励", Icon: "🎁", Rule: model.BadgeRuleRedemptions, Target: 1, SortOrder: 8},
+	}
+}
+
+// SeedBadges adds the built-in badges missing from the catalog
+func SeedBadges(db *gorm.DB) error {
+	return NewMySQLBadgeRepository(db).EnsureBadges(DefaultBadges())
+}
+
+func SeedData(db *gorm.DB, hasher *password.Hasher) error {
 	// Check if data already exists
 	var count int64
 	db.Model(&model.User{}).Count(&count)
@@ -40,20 +112,30 @@ func SeedData(db *gorm.DB) error {
 
 	log.Println("Seeding initial data...")
 
+	// Create demo family
+	if err := db.Create(&model.Family{ID: 1, Name: "李妈妈的家庭"}).Error; err != nil {
+		return fmt.Errorf("failed to create family: %w", err)
+	}
+
 	// Create demo users
+	demoPassword, err := hasher.Hash("123456")
+	if err != nil {
+		return fmt.Errorf("failed to hash demo password: %w", err)
+	}
 	users := []model.User{
 		{
 			Username: "student1",
-			Password: "123456",
+			Password: demoPassword,
 			Role:     "student",
 			Points:   100,
+			TotalPointsEarned: 100,
 			FamilyID: 1,
 			RealName: "小明",
 			Grade:    3,
 		},
 		{
 			Username: "parent1",
-			Password: "123456",
+			Password: demoPassword,
 			Role:     "parent",
 			Points:   0,
 			FamilyID: 1,
@@ -68,14 +150,8 @@ func SeedData(db *gorm.DB) error {
 	}
 
 	// Create demo rewards
-	rewards := []model.Reward{
-		{Title: "看电视 30分钟", Cost: 50, Category: 1, Stock: 999},
-		{Title: "玩手机 15分钟", Cost: 30, Category: 1, Stock: 999},
-		{Title: "吃冰淇淋", Cost: 40, Category: 2, Stock: 10},
-		{Title: "去游乐园", Cost: 200, Category: 2, Stock: 5},
-	}
-
-	for _, reward := range rewards {
+	for _, reward := range DefaultRewards() {
+		reward.FamilyID = 1
 		if err := db.Create(&reward).Error; err != nil {
 			return fmt.Errorf("failed to create reward: %w", err)
 		}
@@ -83,8 +159,8 @@ func SeedData(db *gorm.DB) error {
 
 	// Create demo tasks
 	tasks := []model.Task{
-		{Title: "完成数学作业", Points: 30, Type: 1},
-		{Title: "整理房间", Points: 20, Type: 2},
+		{Title: "完成数学作业", Points: 30, Type: model.TaskTypeStudy, Subject: "math", FamilyID: 1},
+		{Title: "整理房间", Points: 20, Type: model.TaskTypeChore, FamilyID: 1},
 	}
 
 	for _, task := range tasks {
@@ -95,9 +171,10 @@ func SeedData(db *gorm.DB) error {
 		// Assign to student1
 		// Use map to avoid zero-value datetime issues
 		if err := db.Model(&model.TaskLog{}).Create(map[string]interface{}{
-			"student_id": 1,
-			"task_id":    task.ID,
-			"status":     0,
+			"student_id":      1,
+			"task_id":         task.ID,
+			"occurrence_date": time.Now().Format("2006-01-02"),
+			"status":          0,
 		}).Error; err != nil {
 			return fmt.Errorf("failed to create task log: %w", err)
 		}
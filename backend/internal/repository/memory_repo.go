@@ -2,56 +2,316 @@ package repository
 
 import (
 	"errors"
+	"fmt"
+	"sort"
 	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/password"
 	"sync"
 	"time"
 )
 
 // Interfaces
 type ITaskRepository interface {
-	GetTodayTasks(studentID uint) ([]model.TaskLog, error)
-	GetPendingTasks() ([]model.TaskLog, error)
+	// GetTodayTasks returns the student's logs of familyID's tasks scheduled
+	// for date plus one-off logs that are still open (todo, pending or
+	// rejected). With filter.Overdue it returns the open overdue logs of any
+	// day instead.
+	GetTodayTasks(studentID uint, familyID uint, date string, filter TaskFilter) ([]model.TaskLog, error)
+	// GetPendingTasks returns the pending logs of the family's tasks
+	GetPendingTasks(familyID uint, filter TaskFilter) ([]model.TaskLog, error)
 	GetTaskLog(logID uint) (*model.TaskLog, error)
+	// GetTaskHistory returns the student's reviewed logs, newest first
+	GetTaskHistory(studentID uint, limit int) ([]model.TaskLog, error)
+	// GetLogsByStudent returns all of the student's logs that were not
+	// cancelled, ordered by occurrence date
+	GetLogsByStudent(studentID uint) ([]model.TaskLog, error)
 	CreateTask(task *model.Task) error
-	AssignTaskToStudent(studentID uint, taskID uint) error
+	// GetTask returns a task that has not been deleted
+	GetTask(id uint) (*model.Task, error)
+	// GetTasksByFamily returns the family's tasks, newest first; archived
+	// ones only when includeArchived
+	GetTasksByFamily(familyID uint, includeArchived bool) ([]model.Task, error)
+	// UpdateTask saves the editable fields (title, points, type and details,
+	// due date and time, recurrence, assignees)
+	UpdateTask(task *model.Task) error
+	SetTaskArchived(id uint, archived bool) error
+	// DeleteTask soft-deletes a task via DeletedAt
+	DeleteTask(id uint) error
+	// CancelOpenLogs cancels the task's todo and rejected logs, only those of
+	// studentIDs unless it is nil, and reports how many were cancelled
+	CancelOpenLogs(taskID uint, studentIDs []uint) (int, error)
+	// CancelStudentLogs cancels all of the student's todo, pending and
+	// rejected logs, e.g. when they leave their family
+	CancelStudentLogs(studentID uint) (int, error)
+	// RescheduleOpenLogs sets the deadline of the task's todo and rejected
+	// logs to dueAt(occurrence date) and reports how many changed. Logs
+	// already marked overdue keep theirs, as their penalty has been applied.
+	RescheduleOpenLogs(taskID uint, dueAt func(date string) *time.Time) (int, error)
+	// GetRecurringTasks returns the recurring tasks that are neither
+	// archived nor deleted
+	GetRecurringTasks() ([]model.Task, error)
+	// AssignTaskToStudent creates the log for date, due at dueAt, unless it
+	// already exists, reporting whether a new log was created
+	AssignTaskToStudent(studentID uint, taskID uint, date string, dueAt *time.Time) (bool, error)
+	// GetNewlyOverdueLogs returns the todo and rejected logs whose deadline
+	// is before now and that have not been marked overdue yet
+	GetNewlyOverdueLogs(now time.Time) ([]model.TaskLog, error)
 	SubmitTask(studentID uint, taskID uint) error
-	SubmitTaskByLogID(logID uint) error
-	ApproveTask(logID uint) error
-	RejectTask(logID uint) error
+	// SubmitTaskByLogID moves a todo or rejected log to pending and counts
+	// the attempt. A nil proof keeps the proof of the previous attempt. A
+	// submission after the deadline marks the log overdue.
+	SubmitTaskByLogID(logID uint, proof model.ProofImages) error
+	// RejectTask moves a pending log to rejected, storing comment.Content as
+	// the reason and adding comment to the log's thread
+	RejectTask(logID uint, comment *model.TaskComment) error
+	CreateComment(comment *model.TaskComment) error
+	// GetComments returns the thread of a log, oldest first
+	GetComments(logID uint) ([]model.TaskComment, error)
+}
+
+// TaskFilter narrows task queries; zero fields match everything
+type TaskFilter struct {
+	Type    int
+	Subject string
+	// Overdue keeps only logs marked overdue
+	Overdue bool
+}
+
+// Matches reports whether task passes the filter
+func (f TaskFilter) Matches(task *model.Task) bool {
+	return (f.Type == 0 || task.Type == f.Type) && (f.Subject == "" || task.Subject == f.Subject)
+}
+
+// MatchesLog reports whether log and its task pass the filter
+func (f TaskFilter) MatchesLog(log *model.TaskLog, task *model.Task) bool {
+	return f.Matches(task) && (!f.Overdue || log.OverdueAt != nil)
 }
 
 type IUserRepository interface {
 	GetUser(id uint) (*model.User, error)
 	GetUserByUsername(username string) (*model.User, error)
 	CreateUser(user *model.User) error
+	UpdatePassword(userID uint, hash string) error
 	AddPoints(userID uint, points int) error
 	GetStudentsByFamily(familyID uint) ([]model.User, error)
-	GetTopStudents(limit int) ([]model.User, error)
+	GetMembersByFamily(familyID uint) ([]model.User, error)
+	SetFamily(userID uint, familyID uint) error
+	GetTopStudents(familyID uint, limit int) ([]model.User, error)
+	// CreateLevelUp records a level-up unless the student already reached
+	// that level, reporting whether it was recorded
+	CreateLevelUp(levelUp *model.LevelUp) (bool, error)
+	// GetUnseenLevelUps returns the level-ups the student has not
+	// acknowledged yet, oldest first
+	GetUnseenLevelUps(studentID uint) ([]model.LevelUp, error)
+	MarkLevelUpsSeen(studentID uint, now time.Time) error
 }
 
 type ISessionRepository interface {
 	CreateSession(session *model.Session) error
 	GetSession(token string) (*model.Session, error)
 	DeleteSession(token string) error
+	// DeleteUserSessions logs a user out everywhere except exceptToken
+	DeleteUserSessions(userID uint, exceptToken string) error
+}
+
+type IIdempotencyRepository interface {
+	// ReserveKey inserts record unless the user already has an unexpired
+	// record with the same key, which is returned instead
+	ReserveKey(record *model.IdempotencyKey, now time.Time) (*model.IdempotencyKey, error)
+	// CompleteKey stores the response of a reserved key
+	CompleteKey(id uint, statusCode int, contentType string, response []byte) error
+	DeleteKey(id uint) error
+	DeleteExpiredKeys(now time.Time) error
 }
 
 type IRedemptionRepository interface {
 	CreateRedemption(redemption *model.Redemption) error
-	GetRedemptionsByFamily(familyID uint) ([]model.Redemption, error)
-	GetRedemptionsByStudent(studentID uint) ([]model.Redemption, error)
+	GetRedemption(id uint) (*model.Redemption, error)
+	// GetRedemptionsByFamily / ByStudent filter by status unless it is empty
+	GetRedemptionsByFamily(familyID uint, status string) ([]model.Redemption, error)
+	GetRedemptionsByStudent(studentID uint, status string) ([]model.Redemption, error)
+	// UpdateRedemptionStatus moves a redemption to status only if it is
+	// currently in one of from; it reports false when no row matched
+	UpdateRedemptionStatus(id uint, from []string, status string, handledBy uint) (bool, error)
 }
 
+var ErrRedemptionNotFound = errors.New("redemption not found")
+
 type IRewardRepository interface {
-	GetAllRewards() ([]model.Reward, error)
+	// GetRewardsByFamily returns the family's own rewards plus the shared
+	// ones, ordered by SortOrder; archived rewards only when includeArchived
+	GetRewardsByFamily(familyID uint, includeArchived bool) ([]model.Reward, error)
 	GetReward(id uint) (*model.Reward, error)
+	CreateReward(reward *model.Reward) error
+	// UpdateReward saves the editable fields (title, cost, category, stock,
+	// minutes, description, image)
+	UpdateReward(reward *model.Reward) error
+	// SetRewardArchived soft-deletes or restores a reward via DeletedAt
+	SetRewardArchived(id uint, archived bool) error
+	// AddStock adds amount to a limited stock; unlimited (-1) stays unlimited
+	AddStock(id uint, amount int) error
+	// ReorderRewards sets SortOrder to the position of each ID in ids
+	ReorderRewards(familyID uint, ids []uint) error
+}
+
+type IFamilyRepository interface {
+	CreateFamily(family *model.Family) error
+	GetFamily(id uint) (*model.Family, error)
+	// UpdateSettings saves the family's award limits and penalties
+	UpdateSettings(family *model.Family) error
+	CreateInvite(invite *model.FamilyInvite) error
+	// UseInvite consumes one use of a valid, unexpired invite open to role
+	UseInvite(code string, role string, now time.Time) (*model.FamilyInvite, error)
+	// ReleaseInvite gives back one use of an invite, e.g. when the account
+	// it was used for could not be created
+	ReleaseInvite(code string) error
+}
+
+var ErrInviteInvalid = errors.New("invite code is invalid or expired")
+
+// IPointRepository changes point balances together with the business record
+// that caused the change, writing a PointTransaction in the same transaction.
+type IPointRepository interface {
+	// ApproveTask marks a pending log as done and applies entry to
+	// entry.UserID; any other status fails with ErrInvalidTransition
+	ApproveTask(logID uint, entry *model.PointTransaction) error
+	// MarkOverdue marks a todo or rejected log overdue and, unless entry is
+	// nil, deducts -entry.Delta points from entry.UserID, at most the current
+	// balance. It reports false when the log was already marked or is no
+	// longer open.
+	MarkOverdue(logID uint, now time.Time, entry *model.PointTransaction) (bool, error)
+	// AwardStreakBonus records bonus and credits entry (source ID filled in)
+	// unless the student already received the milestone for a streak that
+	// started on or after bonus.StartDate; it reports whether it was awarded
+	AwardStreakBonus(bonus *model.StreakBonus, entry *model.PointTransaction) (bool, error)
+	// Redeem locks redemption.RewardID, checks its stock and the user's
+	// balance, inserts the redemption priced from the locked reward, decrements
+	// limited stock and applies the matching negative entry. Cost, title,
+	// delta and source ID are filled in by the repository.
+	Redeem(redemption *model.Redemption, entry *model.PointTransaction) error
+	// Refund moves a redemption that is in one of from to status (rejected
+	// or cancelled), puts limited stock back and credits the cost via entry
+	// (delta filled in)
+	Refund(redemptionID uint, from []string, status string, note string, entry *model.PointTransaction) error
+	GetTransactionsByUser(userID uint, limit int) ([]model.PointTransaction, error)
+}
+
+// IScreenTimeRepository stores screen time sessions. The balance is derived
+// from fulfilled time redemptions, so granting minutes needs no extra write.
+type IScreenTimeRepository interface {
+	// GetBalanceSeconds returns the granted screen time minus the time used
+	// by finished sessions; an open session is not deducted
+	GetBalanceSeconds(studentID uint) (int, error)
+	// GetOpenSession returns the active or paused session, or nil
+	GetOpenSession(studentID uint) (*model.ScreenTimeSession, error)
+	// CreateSession fails with ErrSessionOpen when the student already has an
+	// open session
+	CreateSession(session *model.ScreenTimeSession) error
+	// UpdateSession saves session only if its stored status is still from
+	UpdateSession(session *model.ScreenTimeSession, from string) (bool, error)
+	GetOpenSessionsByFamily(familyID uint) ([]model.ScreenTimeSession, error)
+	GetActiveSessions() ([]model.ScreenTimeSession, error)
 }
 
+var ErrSessionOpen = errors.New("a screen time session is already open")
+
+type IAppConfigRepository interface {
+	GetAllConfigs() ([]model.AppConfig, error)
+	// SaveConfig inserts the entry or overwrites the value of the existing
+	// entry with the same key, platform and min version
+	SaveConfig(config *model.AppConfig) error
+	DeleteConfig(id uint) error
+}
+
+var ErrConfigNotFound = errors.New("config not found")
+
+type IFeatureFlagRepository interface {
+	// GetAllFlags returns every flag with its family overrides
+	GetAllFlags() ([]model.FeatureFlag, error)
+	// SaveFlag creates the flag or updates the flag with the same key
+	SaveFlag(flag *model.FeatureFlag) error
+	// SetOverride forces the flag on or off for a family; nil removes the override
+	SetOverride(key string, familyID uint, enabled *bool) error
+}
+
+var ErrFlagNotFound = errors.New("feature flag not found")
+
+// IWebhookRepository stores the families' webhooks and their deliveries
+type IWebhookRepository interface {
+	CreateWebhook(webhook *model.Webhook) error
+	GetWebhook(id uint) (*model.Webhook, error)
+	GetWebhooksByFamily(familyID uint) ([]model.Webhook, error)
+	// UpdateWebhook saves the editable fields (URL, secret, events,
+	// description, enabled)
+	UpdateWebhook(webhook *model.Webhook) error
+	// DeleteWebhook removes the webhook together with its deliveries
+	DeleteWebhook(id uint) error
+	CreateDelivery(delivery *model.WebhookDelivery) error
+	// GetDueDeliveries returns pending deliveries whose next attempt is due,
+	// oldest first, with their webhook
+	GetDueDeliveries(now time.Time, limit int) ([]model.WebhookDelivery, error)
+	// ClaimDelivery pushes the next attempt of a due pending delivery to
+	// until so that no other worker picks it up meanwhile; it reports false
+	// when the delivery is no longer due
+	ClaimDelivery(id uint, now time.Time, until time.Time) (bool, error)
+	// UpdateDelivery saves the outcome of an attempt
+	UpdateDelivery(delivery *model.WebhookDelivery) error
+	// GetDeliveries returns the webhook's deliveries, newest first
+	GetDeliveries(webhookID uint, limit int) ([]model.WebhookDelivery, error)
+	// DeleteDeliveriesBefore removes finished deliveries created before cutoff
+	DeleteDeliveriesBefore(cutoff time.Time) error
+}
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// IDeviceRepository stores the devices families control over MQTT
+type IDeviceRepository interface {
+	CreateDevice(device *model.Device) error
+	GetDevice(id uint) (*model.Device, error)
+	GetDevicesByFamily(familyID uint) ([]model.Device, error)
+	// UpdateDevice saves the editable fields (name, student, topic, enabled)
+	UpdateDevice(device *model.Device) error
+	// UpdateDeviceState records the outcome of sending a command
+	UpdateDeviceState(device *model.Device) error
+	DeleteDevice(id uint) error
+	// GetFailedDevices returns the enabled devices whose last command could
+	// not be sent
+	GetFailedDevices() ([]model.Device, error)
+}
+
+var ErrDeviceNotFound = errors.New("device not found")
+
+// IBadgeRepository stores the badge catalog and the badges students unlocked
+type IBadgeRepository interface {
+	// GetBadges returns the catalog ordered by SortOrder
+	GetBadges() ([]model.Badge, error)
+	// EnsureBadges adds the badges whose code is not in the catalog yet;
+	// existing badges are left as they are
+	EnsureBadges(badges []model.Badge) error
+	// CreateUnlock records an unlock unless the student already has the
+	// badge, reporting whether it was recorded
+	CreateUnlock(unlock *model.BadgeUnlock) (bool, error)
+	GetUnlocksByStudent(studentID uint) ([]model.BadgeUnlock, error)
+}
+
+var (
+	ErrInsufficientPoints = errors.New("insufficient points")
+	ErrOutOfStock         = errors.New("reward is out of stock")
+	ErrRewardNotFound     = errors.New("reward not found")
+	// ErrInvalidTransition means the record is not in a state that allows the change
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrTaskLogNotFound   = errors.New("task log not found")
+	ErrTaskNotFound      = errors.New("task not found")
+)
+
 // Memory Implementation
 type MemoryTaskRepository struct {
 	tasks    map[uint]*model.Task
 	taskLogs map[uint]*model.TaskLog
+	comments []model.TaskComment
 	idCounter uint
 	logCounter uint
+	commentCounter uint
 	mu       sync.Mutex
 }
 
@@ -61,18 +321,20 @@ func NewMemoryTaskRepository() *MemoryTaskRepository {
 		taskLogs: make(map[uint]*model.TaskLog),
 		idCounter: 1,
 		logCounter: 1,
+		commentCounter: 1,
 	}
 	// Seed Data
-	repo.tasks[1] = &model.Task{ID: 1, Title: "完成数学作业", Points: 30, Type: 1, CreatedAt: time.Now()}
-	repo.tasks[2] = &model.Task{ID: 2, Title: "整理房间", Points: 20, Type: 2, CreatedAt: time.Now()}
+	repo.tasks[1] = &model.Task{ID: 1, Title: "完成数学作业", Points: 30, Type: model.TaskTypeStudy, Subject: "math", FamilyID: 1, CreatedAt: time.Now()}
+	repo.tasks[2] = &model.Task{ID: 2, Title: "整理房间", Points: 20, Type: model.TaskTypeChore, FamilyID: 1, CreatedAt: time.Now()}
 	
 	// Assign tasks to student (log w/ status 0)
+	today := time.Now().Format("2006-01-02")
 	repo.taskLogs[1] = &model.TaskLog{
-		ID: 1, StudentID: 1, TaskID: 1, Status: 0, 
+		ID: 1, StudentID: 1, TaskID: 1, Status: model.TaskStatusTodo, OccurrenceDate: today,
 		Task: *repo.tasks[1], CreatedAt: time.Now(),
 	}
 	repo.taskLogs[2] = &model.TaskLog{
-		ID: 2, StudentID: 1, TaskID: 2, Status: 0,
+		ID: 2, StudentID: 1, TaskID: 2, Status: model.TaskStatusTodo, OccurrenceDate: today,
 		Task: *repo.tasks[2], CreatedAt: time.Now(),
 	}
 	repo.logCounter = 3
@@ -81,31 +343,44 @@ func NewMemoryTaskRepository() *MemoryTaskRepository {
 	return repo
 }
 
-func (r *MemoryTaskRepository) GetTodayTasks(studentID uint) ([]model.TaskLog, error) {
+func (r *MemoryTaskRepository) GetTodayTasks(studentID uint, familyID uint, date string, filter TaskFilter) ([]model.TaskLog, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	var logs []model.TaskLog
 	for _, log := range r.taskLogs {
-		if log.StudentID == studentID {
+		if log.StudentID != studentID {
+			continue
+		}
+		t, ok := r.tasks[log.TaskID]
+		if !ok || t.FamilyID != familyID {
+			continue
+		}
+		if log.Status == model.TaskStatusCancelled || !filter.MatchesLog(log, t) {
+			continue
+		}
+		openOneOff := t.Recurrence == "" && log.Status != model.TaskStatusDone
+		if filter.Overdue {
+			openOneOff = log.Status == model.TaskStatusTodo || log.Status == model.TaskStatusRejected
+		}
+		if (log.OccurrenceDate == date && !filter.Overdue) || openOneOff {
 			// Reload task info
-			if t, ok := r.tasks[log.TaskID]; ok {
-				log.Task = *t
-			}
+			log.Task = *t
 			logs = append(logs, *log)
 		}
 	}
 	return logs, nil
 }
 
-func (r *MemoryTaskRepository) GetPendingTasks() ([]model.TaskLog, error) {
+func (r *MemoryTaskRepository) GetPendingTasks(familyID uint, filter TaskFilter) ([]model.TaskLog, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	var logs []model.TaskLog
 	for _, log := range r.taskLogs {
-		if log.Status == 1 { // Pending
-			if t, ok := r.tasks[log.TaskID]; ok {
-				log.Task = *t
-			}
+		if log.Status != model.TaskStatusPending {
+			continue
+		}
+		if t, ok := r.tasks[log.TaskID]; ok && t.FamilyID == familyID && filter.MatchesLog(log, t) {
+			log.Task = *t
 			logs = append(logs, *log)
 		}
 	}
@@ -122,7 +397,62 @@ func (r *MemoryTaskRepository) GetTaskLog(logID uint) (*model.TaskLog, error) {
 		}
 		return log, nil
 	}
-	return nil, errors.New("task log not found")
+	return nil, ErrTaskLogNotFound
+}
+
+func (r *MemoryTaskRepository) GetTaskHistory(studentID uint, limit int) ([]model.TaskLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var logs []model.TaskLog
+	for _, log := range r.taskLogs {
+		if log.StudentID != studentID || (log.Status != model.TaskStatusDone && log.Status != model.TaskStatusRejected) {
+			continue
+		}
+		if t, ok := r.tasks[log.TaskID]; ok {
+			log.Task = *t
+		}
+		logs = append(logs, *log)
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		return reviewedAt(&logs[i]).After(reviewedAt(&logs[j]))
+	})
+	if limit > 0 && len(logs) > limit {
+		logs = logs[:limit]
+	}
+	return logs, nil
+}
+
+// reviewedAt is when a done or rejected log was last reviewed
+func reviewedAt(log *model.TaskLog) time.Time {
+	if log.Status == model.TaskStatusDone && log.ApprovedAt != nil {
+		return *log.ApprovedAt
+	}
+	if log.RejectedAt != nil {
+		return *log.RejectedAt
+	}
+	return log.CreatedAt
+}
+
+func (r *MemoryTaskRepository) GetLogsByStudent(studentID uint) ([]model.TaskLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var logs []model.TaskLog
+	for _, log := range r.taskLogs {
+		if log.StudentID != studentID || log.Status == model.TaskStatusCancelled {
+			continue
+		}
+		if t, ok := r.tasks[log.TaskID]; ok {
+			log.Task = *t
+		}
+		logs = append(logs, *log)
+	}
+	sort.Slice(logs, func(i, j int) bool {
+		if logs[i].OccurrenceDate != logs[j].OccurrenceDate {
+			return logs[i].OccurrenceDate < logs[j].OccurrenceDate
+		}
+		return logs[i].ID < logs[j].ID
+	})
+	return logs, nil
 }
 
 func (r *MemoryTaskRepository) CreateTask(task *model.Task) error {
@@ -130,16 +460,178 @@ func (r *MemoryTaskRepository) CreateTask(task *model.Task) error {
 	defer r.mu.Unlock()
 	task.ID = r.idCounter
 	r.idCounter++
+	task.CreatedAt = time.Now()
 	r.tasks[task.ID] = task
 	return nil
 }
 
+func (r *MemoryTaskRepository) GetTask(id uint) (*model.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[id]
+	if !ok || task.DeletedAt != nil {
+		return nil, ErrTaskNotFound
+	}
+	copied := *task
+	return &copied, nil
+}
+
+func (r *MemoryTaskRepository) GetTasksByFamily(familyID uint, includeArchived bool) ([]model.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tasks []model.Task
+	for _, task := range r.tasks {
+		if task.FamilyID != familyID || task.DeletedAt != nil {
+			continue
+		}
+		if task.ArchivedAt != nil && !includeArchived {
+			continue
+		}
+		tasks = append(tasks, *task)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID > tasks[j].ID })
+	return tasks, nil
+}
+
+func (r *MemoryTaskRepository) UpdateTask(task *model.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.tasks[task.ID]
+	if !ok || existing.DeletedAt != nil {
+		return ErrTaskNotFound
+	}
+	existing.Title = task.Title
+	existing.Points = task.Points
+	existing.Type = task.Type
+	existing.Subject = task.Subject
+	existing.Description = task.Description
+	existing.EstimatedMinutes = task.EstimatedMinutes
+	existing.Difficulty = task.Difficulty
+	existing.DueTime = task.DueTime
+	existing.DueDate = task.DueDate
+	existing.Recurrence = task.Recurrence
+	existing.AssigneeIDs = task.AssigneeIDs
+	existing.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *MemoryTaskRepository) SetTaskArchived(id uint, archived bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[id]
+	if !ok || task.DeletedAt != nil {
+		return ErrTaskNotFound
+	}
+	task.ArchivedAt = nil
+	if archived {
+		now := time.Now()
+		task.ArchivedAt = &now
+	}
+	return nil
+}
+
+func (r *MemoryTaskRepository) DeleteTask(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	task, ok := r.tasks[id]
+	if !ok || task.DeletedAt != nil {
+		return ErrTaskNotFound
+	}
+	now := time.Now()
+	task.DeletedAt = &now
+	return nil
+}
+
+func (r *MemoryTaskRepository) CancelOpenLogs(taskID uint, studentIDs []uint) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cancelled := 0
+	for _, log := range r.taskLogs {
+		if log.TaskID != taskID || (log.Status != model.TaskStatusTodo && log.Status != model.TaskStatusRejected) {
+			continue
+		}
+		if studentIDs != nil && !containsID(studentIDs, log.StudentID) {
+			continue
+		}
+		log.Status = model.TaskStatusCancelled
+		log.UpdatedAt = time.Now()
+		cancelled++
+	}
+	return cancelled, nil
+}
+
+func (r *MemoryTaskRepository) RescheduleOpenLogs(taskID uint, dueAt func(date string) *time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := 0
+	for _, log := range r.taskLogs {
+		if log.TaskID != taskID || log.OverdueAt != nil || (log.Status != model.TaskStatusTodo && log.Status != model.TaskStatusRejected) {
+			continue
+		}
+		due := dueAt(log.OccurrenceDate)
+		if sameTime(log.DueAt, due) {
+			continue
+		}
+		log.DueAt = due
+		log.UpdatedAt = time.Now()
+		changed++
+	}
+	return changed, nil
+}
+
+func (r *MemoryTaskRepository) CancelStudentLogs(studentID uint) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cancelled := 0
+	for _, log := range r.taskLogs {
+		if log.StudentID != studentID {
+			continue
+		}
+		if log.Status != model.TaskStatusTodo && log.Status != model.TaskStatusPending && log.Status != model.TaskStatusRejected {
+			continue
+		}
+		log.Status = model.TaskStatusCancelled
+		log.UpdatedAt = time.Now()
+		cancelled++
+	}
+	return cancelled, nil
+}
+
+func containsID(ids []uint, id uint) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sameTime reports whether two optional deadlines are the same instant
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func (r *MemoryTaskRepository) GetRecurringTasks() ([]model.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var tasks []model.Task
+	for _, task := range r.tasks {
+		if task.Recurrence != "" && task.DeletedAt == nil && task.ArchivedAt == nil {
+			tasks = append(tasks, *task)
+		}
+	}
+	return tasks, nil
+}
+
 func (r *MemoryTaskRepository) SubmitTask(studentID uint, taskID uint) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	for _, log := range r.taskLogs {
-		if log.StudentID == studentID && log.ID == taskID && log.Status == 0 {
-			log.Status = 1 // Pending
+		if log.StudentID == studentID && log.ID == taskID && log.Status == model.TaskStatusTodo {
+			log.Status = model.TaskStatusPending
 			now := time.Now()
 			log.SubmittedAt = &now
 			return nil
@@ -148,74 +640,131 @@ func (r *MemoryTaskRepository) SubmitTask(studentID uint, taskID uint) error {
 	return errors.New("task not found or not in todo state")
 }
 
-func (r *MemoryTaskRepository) SubmitTaskByLogID(logID uint) error {
+func (r *MemoryTaskRepository) SubmitTaskByLogID(logID uint, proof model.ProofImages) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if log, ok := r.taskLogs[logID]; ok {
-		if log.Status != 0 {
-			return errors.New("task already submitted or completed")
+		if log.Status != model.TaskStatusTodo && log.Status != model.TaskStatusRejected {
+			return ErrInvalidTransition
 		}
-		log.Status = 1 // Pending
+		log.Status = model.TaskStatusPending
 		now := time.Now()
 		log.SubmittedAt = &now
+		log.Attempts++
+		if log.OverdueAt == nil && log.DueAt != nil && log.DueAt.Before(now) {
+			log.OverdueAt = &now
+		}
+		if proof != nil {
+			log.ProofImg = proof
+		}
 		return nil
 	}
-	return errors.New("task log not found")
+	return ErrTaskLogNotFound
 }
 
-func (r *MemoryTaskRepository) ApproveTask(logID uint) error {
+func (r *MemoryTaskRepository) RejectTask(logID uint, comment *model.TaskComment) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	if log, ok := r.taskLogs[logID]; ok {
-		log.Status = 2
+		if log.Status != model.TaskStatusPending {
+			return ErrInvalidTransition
+		}
+		log.Status = model.TaskStatusRejected
 		now := time.Now()
-		log.ApprovedAt = &now
+		log.RejectedAt = &now
+		log.RejectReason = comment.Content
+		r.createCommentLocked(comment)
 		return nil
 	}
-	return errors.New("log not found")
+	return ErrTaskLogNotFound
 }
 
-func (r *MemoryTaskRepository) RejectTask(logID uint) error {
+func (r *MemoryTaskRepository) CreateComment(comment *model.TaskComment) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if log, ok := r.taskLogs[logID]; ok {
-		log.Status = 3
-		return nil
+	r.createCommentLocked(comment)
+	return nil
+}
+
+func (r *MemoryTaskRepository) createCommentLocked(comment *model.TaskComment) {
+	comment.ID = r.commentCounter
+	r.commentCounter++
+	comment.CreatedAt = time.Now()
+	r.comments = append(r.comments, *comment)
+}
+
+func (r *MemoryTaskRepository) GetComments(logID uint) ([]model.TaskComment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var comments []model.TaskComment
+	for _, comment := range r.comments {
+		if comment.LogID == logID {
+			comments = append(comments, comment)
+		}
 	}
-	return errors.New("log not found")
+	return comments, nil
 }
 
-func (r *MemoryTaskRepository) AssignTaskToStudent(studentID uint, taskID uint) error {
+func (r *MemoryTaskRepository) AssignTaskToStudent(studentID uint, taskID uint, date string, dueAt *time.Time) (bool, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	
 	task, ok := r.tasks[taskID]
 	if !ok {
-		return errors.New("task not found")
+		return false, errors.New("task not found")
+	}
+
+	for _, existing := range r.taskLogs {
+		if existing.TaskID == taskID && existing.StudentID == studentID && existing.OccurrenceDate == date {
+			return false, nil
+		}
 	}
 	
 	log := &model.TaskLog{
-		ID:        r.logCounter,
-		StudentID: studentID,
-		TaskID:    taskID,
-		Status:    0, // Todo
-		Task:      *task,
-		CreatedAt: time.Now(),
+		ID:             r.logCounter,
+		StudentID:      studentID,
+		TaskID:         taskID,
+		OccurrenceDate: date,
+		Status:         model.TaskStatusTodo,
+		DueAt:          dueAt,
+		Task:           *task,
+		CreatedAt:      time.Now(),
 	}
 	r.taskLogs[r.logCounter] = log
 	r.logCounter++
-	return nil
+	return true, nil
+}
+
+func (r *MemoryTaskRepository) GetNewlyOverdueLogs(now time.Time) ([]model.TaskLog, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var logs []model.TaskLog
+	for _, log := range r.taskLogs {
+		if log.Status != model.TaskStatusTodo && log.Status != model.TaskStatusRejected {
+			continue
+		}
+		if log.DueAt == nil || !log.DueAt.Before(now) || log.OverdueAt != nil {
+			continue
+		}
+		if t, ok := r.tasks[log.TaskID]; ok {
+			log.Task = *t
+		}
+		logs = append(logs, *log)
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].ID < logs[j].ID })
+	return logs, nil
 }
 
 // Memory User Repo
 type MemoryUserRepository struct {
 	users map[uint]*model.User
 	usersByUsername map[string]*model.User
+	levelUps []model.LevelUp
 	idCounter uint
 	mu sync.Mutex
 }
 
-func NewMemoryUserRepository() *MemoryUserRepository {
+func NewMemoryUserRepository(hasher *password.Hasher) *MemoryUserRepository {
 	repo := &MemoryUserRepository{
 		users: make(map[uint]*model.User),
 		usersByUsername: make(map[string]*model.User),
@@ -223,12 +772,17 @@ func NewMemoryUserRepository() *MemoryUserRepository {
 	}
 	
 	// Seed data: Create demo users
+	demoPassword, err := hasher.Hash("123456")
+	if err != nil {
+		panic(err)
+	}
 	demoStudent := &model.User{
 		ID: 1,
 		Username: "student1", 
-		Password: "123456",
+		Password: demoPassword,
 		Role: "student",
 		Points: 100,
+		TotalPointsEarned: 100,
 		FamilyID: 1,
 		RealName: "小明",
 		Grade: 3,
@@ -237,7 +791,7 @@ func NewMemoryUserRepository() *MemoryUserRepository {
 	demoParent := &model.User{
 		ID: 2,
 		Username: "parent1", 
-		Password: "123456",
+		Password: demoPassword,
 		Role: "parent",
 		Points: 0,
 		FamilyID: 1,
@@ -254,6 +808,43 @@ func NewMemoryUserRepository() *MemoryUserRepository {
 	return repo
 }
 
+func (r *MemoryUserRepository) CreateLevelUp(levelUp *model.LevelUp) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.levelUps {
+		if existing.StudentID == levelUp.StudentID && existing.Level == levelUp.Level {
+			return false, nil
+		}
+	}
+	levelUp.ID = uint(len(r.levelUps) + 1)
+	levelUp.CreatedAt = time.Now()
+	r.levelUps = append(r.levelUps, *levelUp)
+	return true, nil
+}
+
+func (r *MemoryUserRepository) GetUnseenLevelUps(studentID uint) ([]model.LevelUp, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var levelUps []model.LevelUp
+	for _, levelUp := range r.levelUps {
+		if levelUp.StudentID == studentID && levelUp.SeenAt == nil {
+			levelUps = append(levelUps, levelUp)
+		}
+	}
+	return levelUps, nil
+}
+
+func (r *MemoryUserRepository) MarkLevelUpsSeen(studentID uint, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.levelUps {
+		if r.levelUps[i].StudentID == studentID && r.levelUps[i].SeenAt == nil {
+			r.levelUps[i].SeenAt = &now
+		}
+	}
+	return nil
+}
+
 func (r *MemoryUserRepository) GetUser(id uint) (*model.User, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -288,6 +879,16 @@ func (r *MemoryUserRepository) CreateUser(user *model.User) error {
 	return nil
 }
 
+func (r *MemoryUserRepository) UpdatePassword(userID uint, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.users[userID]; ok {
+		u.Password = hash
+		return nil
+	}
+	return errors.New("user not found")
+}
+
 func (r *MemoryUserRepository) AddPoints(userID uint, points int) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -310,13 +911,35 @@ func (r *MemoryUserRepository) GetStudentsByFamily(familyID uint) ([]model.User,
 	return students, nil
 }
 
-func (r *MemoryUserRepository) GetTopStudents(limit int) ([]model.User, error) {
+func (r *MemoryUserRepository) GetMembersByFamily(familyID uint) ([]model.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var members []model.User
+	for _, user := range r.users {
+		if user.FamilyID == familyID {
+			members = append(members, *user)
+		}
+	}
+	return members, nil
+}
+
+func (r *MemoryUserRepository) SetFamily(userID uint, familyID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if u, ok := r.users[userID]; ok {
+		u.FamilyID = familyID
+		return nil
+	}
+	return errors.New("user not found")
+}
+
+func (r *MemoryUserRepository) GetTopStudents(familyID uint, limit int) ([]model.User, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	
 	var students []model.User
 	for _, user := range r.users {
-		if user.Role == "student" {
+		if user.Role == "student" && user.FamilyID == familyID {
 			students = append(students, *user)
 		}
 	}
@@ -337,61 +960,244 @@ func (r *MemoryUserRepository) GetTopStudents(limit int) ([]model.User, error) {
 	return students, nil
 }
 
-// Memory Session Repo
-type MemorySessionRepository struct {
-	sessions map[string]*model.Session
-	mu sync.Mutex
+// Memory Family Repo
+type MemoryFamilyRepository struct {
+	families      map[uint]*model.Family
+	invites       map[string]*model.FamilyInvite
+	idCounter     uint
+	inviteCounter uint
+	mu            sync.Mutex
 }
 
-func NewMemorySessionRepository() *MemorySessionRepository {
-	return &MemorySessionRepository{
-		sessions: make(map[string]*model.Session),
+func NewMemoryFamilyRepository() *MemoryFamilyRepository {
+	repo := &MemoryFamilyRepository{
+		families:      make(map[uint]*model.Family),
+		invites:       make(map[string]*model.FamilyInvite),
+		idCounter:     1,
+		inviteCounter: 1,
+	}
+
+	// Seed data: the demo users' family
+	repo.families[1] = &model.Family{
+		ID: 1, Name: "李妈妈的家庭", CreatedAt: time.Now(),
+		MinAwardPercent: model.DefaultMinAwardPercent, MaxAwardPercent: model.DefaultMaxAwardPercent,
 	}
+	repo.idCounter = 2
+
+	return repo
 }
 
-func (r *MemorySessionRepository) CreateSession(session *model.Session) error {
+func (r *MemoryFamilyRepository) CreateFamily(family *model.Family) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.sessions[session.Token] = session
+	family.ID = r.idCounter
+	r.idCounter++
+	family.CreatedAt = time.Now()
+	r.families[family.ID] = family
 	return nil
 }
 
-func (r *MemorySessionRepository) GetSession(token string) (*model.Session, error) {
+func (r *MemoryFamilyRepository) GetFamily(id uint) (*model.Family, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	if s, ok := r.sessions[token]; ok {
-		// Check if expired
-		if time.Now().After(s.ExpiresAt) {
-			delete(r.sessions, token)
-			return nil, errors.New("session expired")
-		}
-		return s, nil
+	if f, ok := r.families[id]; ok {
+		family := *f
+		return &family, nil
 	}
-	return nil, errors.New("session not found")
+	return nil, errors.New("family not found")
 }
 
-func (r *MemorySessionRepository) DeleteSession(token string) error {
+func (r *MemoryFamilyRepository) UpdateSettings(family *model.Family) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	delete(r.sessions, token)
+	f, ok := r.families[family.ID]
+	if !ok {
+		return errors.New("family not found")
+	}
+	f.MinAwardPercent = family.MinAwardPercent
+	f.MaxAwardPercent = family.MaxAwardPercent
+	f.LatePenaltyPercent = family.LatePenaltyPercent
+	f.MissedTaskPenalty = family.MissedTaskPenalty
+	f.Timezone = family.Timezone
+	f.StreakSkipDays = family.StreakSkipDays
+	f.StreakMilestones = family.StreakMilestones
+	f.UpdatedAt = time.Now()
 	return nil
 }
 
-// MemoryRedemptionRepository
-type MemoryRedemptionRepository struct {
-	redemptions map[uint]*model.Redemption
-	idCounter   uint
-	mu          sync.Mutex
-}
-
-func NewMemoryRedemptionRepository() *MemoryRedemptionRepository {
-	return &MemoryRedemptionRepository{
-		redemptions: make(map[uint]*model.Redemption),
-		idCounter:   1,
+func (r *MemoryFamilyRepository) CreateInvite(invite *model.FamilyInvite) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.invites[invite.Code]; exists {
+		return errors.New("invite code already exists")
 	}
+	invite.ID = r.inviteCounter
+	r.inviteCounter++
+	invite.CreatedAt = time.Now()
+	r.invites[invite.Code] = invite
+	return nil
 }
 
-func (r *MemoryRedemptionRepository) CreateRedemption(redemption *model.Redemption) error {
+func (r *MemoryFamilyRepository) UseInvite(code string, role string, now time.Time) (*model.FamilyInvite, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	invite, ok := r.invites[code]
+	if !ok || !now.Before(invite.ExpiresAt) || (invite.MaxUses > 0 && invite.Uses >= invite.MaxUses) ||
+		(invite.Role != "" && invite.Role != role) {
+		return nil, ErrInviteInvalid
+	}
+	invite.Uses++
+	result := *invite
+	return &result, nil
+}
+
+func (r *MemoryFamilyRepository) ReleaseInvite(code string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if invite, ok := r.invites[code]; ok && invite.Uses > 0 {
+		invite.Uses--
+	}
+	return nil
+}
+
+// Memory Session Repo
+type MemorySessionRepository struct {
+	sessions map[string]*model.Session
+	mu sync.Mutex
+}
+
+// MemoryIdempotencyRepository keeps idempotency records keyed by user and key
+type MemoryIdempotencyRepository struct {
+	records   map[string]*model.IdempotencyKey
+	idCounter uint
+	mu        sync.Mutex
+}
+
+func NewMemoryIdempotencyRepository() *MemoryIdempotencyRepository {
+	return &MemoryIdempotencyRepository{
+		records:   make(map[string]*model.IdempotencyKey),
+		idCounter: 1,
+	}
+}
+
+func idempotencyMapKey(userID uint, key string) string {
+	return fmt.Sprintf("%d:%s", userID, key)
+}
+
+func (r *MemoryIdempotencyRepository) ReserveKey(record *model.IdempotencyKey, now time.Time) (*model.IdempotencyKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := idempotencyMapKey(record.UserID, record.Key)
+	if existing, ok := r.records[k]; ok && existing.ExpiresAt.After(now) {
+		copied := *existing
+		return &copied, nil
+	}
+	record.ID = r.idCounter
+	r.idCounter++
+	record.CreatedAt = now
+	stored := *record
+	r.records[k] = &stored
+	return nil, nil
+}
+
+func (r *MemoryIdempotencyRepository) CompleteKey(id uint, statusCode int, contentType string, response []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, record := range r.records {
+		if record.ID == id {
+			record.StatusCode = statusCode
+			record.ContentType = contentType
+			record.Response = response
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *MemoryIdempotencyRepository) DeleteKey(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, record := range r.records {
+		if record.ID == id {
+			delete(r.records, k)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryIdempotencyRepository) DeleteExpiredKeys(now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, record := range r.records {
+		if !record.ExpiresAt.After(now) {
+			delete(r.records, k)
+		}
+	}
+	return nil
+}
+
+func NewMemorySessionRepository() *MemorySessionRepository {
+	return &MemorySessionRepository{
+		sessions: make(map[string]*model.Session),
+	}
+}
+
+func (r *MemorySessionRepository) CreateSession(session *model.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[session.Token] = session
+	return nil
+}
+
+func (r *MemorySessionRepository) GetSession(token string) (*model.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.sessions[token]; ok {
+		// Check if expired
+		if time.Now().After(s.ExpiresAt) {
+			delete(r.sessions, token)
+			return nil, errors.New("session expired")
+		}
+		return s, nil
+	}
+	return nil, errors.New("session not found")
+}
+
+func (r *MemorySessionRepository) DeleteSession(token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sessions, token)
+	return nil
+}
+
+func (r *MemorySessionRepository) DeleteUserSessions(userID uint, exceptToken string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for token, s := range r.sessions {
+		if s.UserID == userID && token != exceptToken {
+			delete(r.sessions, token)
+		}
+	}
+	return nil
+}
+
+// MemoryRedemptionRepository
+type MemoryRedemptionRepository struct {
+	redemptions map[uint]*model.Redemption
+	userRepo    *MemoryUserRepository // Resolves the student's family
+	idCounter   uint
+	mu          sync.Mutex
+}
+
+func NewMemoryRedemptionRepository(userRepo *MemoryUserRepository) *MemoryRedemptionRepository {
+	return &MemoryRedemptionRepository{
+		redemptions: make(map[uint]*model.Redemption),
+		userRepo:    userRepo,
+		idCounter:   1,
+	}
+}
+
+func (r *MemoryRedemptionRepository) CreateRedemption(redemption *model.Redemption) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	redemption.ID = r.idCounter
@@ -401,30 +1207,94 @@ func (r *MemoryRedemptionRepository) CreateRedemption(redemption *model.Redempti
 	return nil
 }
 
-func (r *MemoryRedemptionRepository) GetRedemptionsByFamily(familyID uint) ([]model.Redemption, error) {
+func (r *MemoryRedemptionRepository) GetRedemption(id uint) (*model.Redemption, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	var result []model.Redemption
+	if redemption, ok := r.redemptions[id]; ok {
+		result := *redemption
+		return &result, nil
+	}
+	return nil, ErrRedemptionNotFound
+}
+
+func (r *MemoryRedemptionRepository) GetRedemptionsByFamily(familyID uint, status string) ([]model.Redemption, error) {
+	r.mu.Lock()
+	var all []model.Redemption
 	for _, redemption := range r.redemptions {
-		// We need to check if the student belongs to the family
-		// For now, we'll just return all redemptions and filter in service layer
-		result = append(result, *redemption)
+		if status == "" || redemption.Status == status {
+			all = append(all, *redemption)
+		}
+	}
+	// Release our lock before touching the user repository; the point
+	// repository takes the two locks in the opposite order
+	r.mu.Unlock()
+
+	var result []model.Redemption
+	for _, redemption := range all {
+		student, err := r.userRepo.GetUser(redemption.StudentID)
+		if err != nil || student.FamilyID != familyID {
+			continue
+		}
+		redemption.Student = *student
+		result = append(result, redemption)
 	}
+	sortRedemptions(result)
 	return result, nil
 }
 
-func (r *MemoryRedemptionRepository) GetRedemptionsByStudent(studentID uint) ([]model.Redemption, error) {
+func (r *MemoryRedemptionRepository) GetRedemptionsByStudent(studentID uint, status string) ([]model.Redemption, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	var result []model.Redemption
 	for _, redemption := range r.redemptions {
-		if redemption.StudentID == studentID {
+		if redemption.StudentID == studentID && (status == "" || redemption.Status == status) {
 			result = append(result, *redemption)
 		}
 	}
+	sortRedemptions(result)
 	return result, nil
 }
 
+func (r *MemoryRedemptionRepository) UpdateRedemptionStatus(id uint, from []string, status string, handledBy uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	redemption, ok := r.redemptions[id]
+	if !ok {
+		return false, ErrRedemptionNotFound
+	}
+	if !containsStatus(from, redemption.Status) {
+		return false, nil
+	}
+
+	now := time.Now()
+	redemption.Status = status
+	redemption.HandledBy = handledBy
+	redemption.UpdatedAt = now
+	switch status {
+	case model.RedemptionApproved:
+		redemption.ApprovedAt = &now
+	case model.RedemptionFulfilled:
+		redemption.FulfilledAt = &now
+	}
+	return true, nil
+}
+
+// sortRedemptions orders newest first, like the MySQL queries
+func sortRedemptions(redemptions []model.Redemption) {
+	sort.Slice(redemptions, func(i, j int) bool {
+		return redemptions[i].ID > redemptions[j].ID
+	})
+}
+
+func containsStatus(statuses []string, status string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
 // MemoryRewardRepository
 type MemoryRewardRepository struct {
 	rewards   map[uint]*model.Reward
@@ -438,17 +1308,11 @@ func NewMemoryRewardRepository() *MemoryRewardRepository {
 		idCounter: 1,
 	}
 	
-	// Initialize with default rewards
-	defaultRewards := []model.Reward{
-		{Title: "看电视 30分钟", Cost: 50, Category: 1, Stock: 999},
-		{Title: "玩手机 15分钟", Cost: 30, Category: 1, Stock: 999},
-		{Title: "吃冰淇淋", Cost: 40, Category: 2, Stock: 10},
-		{Title: "去游乐园", Cost: 200, Category: 2, Stock: 5},
-	}
-	
-	for _, reward := range defaultRewards {
+	// Initialize the demo family's catalog with default rewards
+	for _, reward := range DefaultRewards() {
 		reward.ID = repo.idCounter
 		repo.idCounter++
+		reward.FamilyID = 1
 		reward.CreatedAt = time.Now()
 		repo.rewards[reward.ID] = &reward
 	}
@@ -456,13 +1320,24 @@ func NewMemoryRewardRepository() *MemoryRewardRepository {
 	return repo
 }
 
-func (r *MemoryRewardRepository) GetAllRewards() ([]model.Reward, error) {
+func (r *MemoryRewardRepository) GetRewardsByFamily(familyID uint, includeArchived bool) ([]model.Reward, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	var result []model.Reward
 	for _, reward := range r.rewards {
-		result = append(result, *reward)
+		if reward.DeletedAt != nil && !includeArchived {
+			continue
+		}
+		if reward.FamilyID == 0 || reward.FamilyID == familyID {
+			result = append(result, *reward)
+		}
 	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].SortOrder != result[j].SortOrder {
+			return result[i].SortOrder < result[j].SortOrder
+		}
+		return result[i].ID < result[j].ID
+	})
 	return result, nil
 }
 
@@ -472,6 +1347,882 @@ func (r *MemoryRewardRepository) GetReward(id uint) (*model.Reward, error) {
 	if reward, ok := r.rewards[id]; ok {
 		return reward, nil
 	}
-	return nil, errors.New("reward not found")
+	return nil, ErrRewardNotFound
+}
+
+func (r *MemoryRewardRepository) CreateReward(reward *model.Reward) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reward.ID = r.idCounter
+	r.idCounter++
+	reward.CreatedAt = time.Now()
+	reward.UpdatedAt = reward.CreatedAt
+	r.rewards[reward.ID] = reward
+	return nil
+}
+
+func (r *MemoryRewardRepository) UpdateReward(reward *model.Reward) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.rewards[reward.ID]
+	if !ok {
+		return ErrRewardNotFound
+	}
+	existing.Title = reward.Title
+	existing.Cost = reward.Cost
+	existing.Category = reward.Category
+	existing.Stock = reward.Stock
+	existing.Minutes = reward.Minutes
+	existing.Description = reward.Description
+	existing.ImageURL = reward.ImageURL
+	existing.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *MemoryRewardRepository) SetRewardArchived(id uint, archived bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reward, ok := r.rewards[id]
+	if !ok {
+		return ErrRewardNotFound
+	}
+	if archived {
+		now := time.Now()
+		reward.DeletedAt = &now
+	} else {
+		reward.DeletedAt = nil
+	}
+	return nil
+}
+
+func (r *MemoryRewardRepository) AddStock(id uint, amount int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	reward, ok := r.rewards[id]
+	if !ok {
+		return ErrRewardNotFound
+	}
+	if reward.Stock >= 0 {
+		reward.Stock += amount
+	}
+	return nil
+}
+
+func (r *MemoryRewardRepository) ReorderRewards(familyID uint, ids []uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, id := range ids {
+		if reward, ok := r.rewards[id]; ok && reward.FamilyID == familyID {
+			reward.SortOrder = i
+		}
+	}
+	return nil
+}
+
+
+// MemoryPointRepository works on top of the other memory repositories so that
+// status, redemption and balance changes happen under the same set of locks.
+type MemoryPointRepository struct {
+	taskRepo       *MemoryTaskRepository
+	userRepo       *MemoryUserRepository
+	redemptionRepo *MemoryRedemptionRepository
+	rewardRepo     *MemoryRewardRepository
+	transactions   []*model.PointTransaction
+	streakBonuses  []model.StreakBonus
+	idCounter      uint
+	mu             sync.Mutex
+}
+
+func NewMemoryPointRepository(taskRepo *MemoryTaskRepository, userRepo *MemoryUserRepository, redemptionRepo *MemoryRedemptionRepository, rewardRepo *MemoryRewardRepository) *MemoryPointRepository {
+	return &MemoryPointRepository{
+		taskRepo:       taskRepo,
+		userRepo:       userRepo,
+		redemptionRepo: redemptionRepo,
+		rewardRepo:     rewardRepo,
+		idCounter:      1,
+	}
+}
+
+func (r *MemoryPointRepository) ApproveTask(logID uint, entry *model.PointTransaction) error {
+	// Lock order: ledger -> task -> user
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.taskRepo.mu.Lock()
+	defer r.taskRepo.mu.Unlock()
+	r.userRepo.mu.Lock()
+	defer r.userRepo.mu.Unlock()
+
+	log, ok := r.taskRepo.taskLogs[logID]
+	if !ok {
+		return ErrTaskLogNotFound
+	}
+	if log.Status != model.TaskStatusPending {
+		return ErrInvalidTransition
+	}
+	user, ok := r.userRepo.users[entry.UserID]
+	if !ok {
+		return errors.New("user not found")
+	}
+
+	log.Status = model.TaskStatusDone
+	now := time.Now()
+	log.ApprovedAt = &now
+	awarded := entry.Delta
+	log.AwardedPoints = &awarded
+	r.applyLocked(user, entry)
+	return nil
+}
+
+func (r *MemoryPointRepository) MarkOverdue(logID uint, now time.Time, entry *model.PointTransaction) (bool, error) {
+	// Lock order: ledger -> task -> user
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.taskRepo.mu.Lock()
+	defer r.taskRepo.mu.Unlock()
+	r.userRepo.mu.Lock()
+	defer r.userRepo.mu.Unlock()
+
+	log, ok := r.taskRepo.taskLogs[logID]
+	if !ok {
+		return false, ErrTaskLogNotFound
+	}
+	if log.OverdueAt != nil || (log.Status != model.TaskStatusTodo && log.Status != model.TaskStatusRejected) {
+		return false, nil
+	}
+	log.OverdueAt = &now
+	if entry == nil {
+		return true, nil
+	}
+	user, ok := r.userRepo.users[entry.UserID]
+	if !ok {
+		return false, errors.New("user not found")
+	}
+	// A penalty never takes the balance below zero
+	if -entry.Delta > user.Points {
+		entry.Delta = -user.Points
+	}
+	if entry.Delta != 0 {
+		r.applyLocked(user, entry)
+	}
+	return true, nil
+}
+
+func (r *MemoryPointRepository) AwardStreakBonus(bonus *model.StreakBonus, entry *model.PointTransaction) (bool, error) {
+	// Lock order: ledger -> user
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.userRepo.mu.Lock()
+	defer r.userRepo.mu.Unlock()
+
+	for _, existing := range r.streakBonuses {
+		if existing.StudentID == bonus.StudentID && existing.Days == bonus.Days && existing.StartDate >= bonus.StartDate {
+			return false, nil
+		}
+	}
+	user, ok := r.userRepo.users[entry.UserID]
+	if !ok {
+		return false, errors.New("user not found")
+	}
+	bonus.ID = uint(len(r.streakBonuses) + 1)
+	bonus.CreatedAt = time.Now()
+	r.streakBonuses = append(r.streakBonuses, *bonus)
+	entry.SourceID = bonus.ID
+	r.applyLocked(user, entry)
+	return true, nil
+}
+
+func (r *MemoryPointRepository) Redeem(redemption *model.Redemption, entry *model.PointTransaction) error {
+	// Lock order: ledger -> user -> redemption -> reward
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.userRepo.mu.Lock()
+	defer r.userRepo.mu.Unlock()
+	r.redemptionRepo.mu.Lock()
+	defer r.redemptionRepo.mu.Unlock()
+	r.rewardRepo.mu.Lock()
+	defer r.rewardRepo.mu.Unlock()
+
+	reward, ok := r.rewardRepo.rewards[redemption.RewardID]
+	if !ok || reward.DeletedAt != nil {
+		return ErrRewardNotFound
+	}
+	if reward.Stock == 0 {
+		return ErrOutOfStock
+	}
+	user, ok := r.userRepo.users[entry.UserID]
+	if !ok {
+		return errors.New("user not found")
+	}
+	if user.Points < reward.Cost {
+		return ErrInsufficientPoints
+	}
+
+	if reward.Stock > 0 {
+		reward.Stock--
+	}
+	redemption.RewardTitle = reward.Title
+	redemption.Cost = reward.Cost
+	if reward.Category == model.RewardCategoryTime {
+		redemption.Minutes = reward.Minutes
+	}
+	entry.Delta = -reward.Cost
+	entry.Remark = reward.Title
+
+	redemption.ID = r.redemptionRepo.idCounter
+	r.redemptionRepo.idCounter++
+	redemption.CreatedAt = time.Now()
+	r.redemptionRepo.redemptions[redemption.ID] = redemption
+
+	entry.SourceID = redemption.ID
+	r.applyLocked(user, entry)
+	return nil
+}
+
+func (r *MemoryPointRepository) Refund(redemptionID uint, from []string, status string, note string, entry *model.PointTransaction) error {
+	// Lock order: ledger -> user -> redemption -> reward
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.userRepo.mu.Lock()
+	defer r.userRepo.mu.Unlock()
+	r.redemptionRepo.mu.Lock()
+	defer r.redemptionRepo.mu.Unlock()
+	r.rewardRepo.mu.Lock()
+	defer r.rewardRepo.mu.Unlock()
+
+	redemption, ok := r.redemptionRepo.redemptions[redemptionID]
+	if !ok {
+		return ErrRedemptionNotFound
+	}
+	if !containsStatus(from, redemption.Status) {
+		return ErrInvalidTransition
+	}
+	user, ok := r.userRepo.users[redemption.StudentID]
+	if !ok {
+		return errors.New("user not found")
+	}
+
+	now := time.Now()
+	redemption.Status = status
+	redemption.Note = note
+	redemption.HandledBy = entry.ActorID
+	redemption.RefundedAt = &now
+	redemption.UpdatedAt = now
+	if reward, ok := r.rewardRepo.rewards[redemption.RewardID]; ok && reward.Stock >= 0 {
+		reward.Stock++
+	}
+
+	entry.UserID = redemption.StudentID
+	entry.SourceID = redemption.ID
+	entry.Delta = redemption.Cost
+	r.applyLocked(user, entry)
+	return nil
 }
 
+func (r *MemoryPointRepository) GetTransactionsByUser(userID uint, limit int) ([]model.PointTransaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []model.PointTransaction
+	// Newest first
+	for i := len(r.transactions) - 1; i >= 0; i-- {
+		if r.transactions[i].UserID == userID {
+			result = append(result, *r.transactions[i])
+			if limit > 0 && len(result) >= limit {
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// applyLocked must be called with r.mu and the user repository lock held
+func (r *MemoryPointRepository) applyLocked(user *model.User, entry *model.PointTransaction) {
+	user.Points += entry.Delta
+	if entry.IsEarning() {
+		user.TotalPointsEarned += entry.Delta
+	}
+	entry.ID = r.idCounter
+	r.idCounter++
+	entry.BalanceAfter = user.Points
+	entry.CreatedAt = time.Now()
+	r.transactions = append(r.transactions, entry)
+}
+
+// MemoryScreenTimeRepository
+type MemoryScreenTimeRepository struct {
+	sessions       map[uint]*model.ScreenTimeSession
+	idCounter      uint
+	userRepo       *MemoryUserRepository
+	redemptionRepo *MemoryRedemptionRepository
+	mu             sync.Mutex
+}
+
+func NewMemoryScreenTimeRepository(userRepo *MemoryUserRepository, redemptionRepo *MemoryRedemptionRepository) *MemoryScreenTimeRepository {
+	return &MemoryScreenTimeRepository{
+		sessions:       make(map[uint]*model.ScreenTimeSession),
+		idCounter:      1,
+		userRepo:       userRepo,
+		redemptionRepo: redemptionRepo,
+	}
+}
+
+func (r *MemoryScreenTimeRepository) GetBalanceSeconds(studentID uint) (int, error) {
+	redemptions, err := r.redemptionRepo.GetRedemptionsByStudent(studentID, model.RedemptionFulfilled)
+	if err != nil {
+		return 0, err
+	}
+	balance := 0
+	for _, redemption := range redemptions {
+		balance += redemption.Minutes * 60
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, session := range r.sessions {
+		if session.StudentID == studentID && !isOpenSession(session) {
+			balance -= session.UsedSeconds
+		}
+	}
+	return balance, nil
+}
+
+func (r *MemoryScreenTimeRepository) GetOpenSession(studentID uint) (*model.ScreenTimeSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, session := range r.sessions {
+		if session.StudentID == studentID && isOpenSession(session) {
+			result := *session
+			return &result, nil
+		}
+	}
+	return nil, nil
+}
+
+func (r *MemoryScreenTimeRepository) CreateSession(session *model.ScreenTimeSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.sessions {
+		if existing.StudentID == session.StudentID && isOpenSession(existing) {
+			return ErrSessionOpen
+		}
+	}
+	session.ID = r.idCounter
+	r.idCounter++
+	session.CreatedAt = time.Now()
+	session.UpdatedAt = session.CreatedAt
+	stored := *session
+	r.sessions[session.ID] = &stored
+	return nil
+}
+
+func (r *MemoryScreenTimeRepository) UpdateSession(session *model.ScreenTimeSession, from string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.sessions[session.ID]
+	if !ok || stored.Status != from {
+		return false, nil
+	}
+	session.UpdatedAt = time.Now()
+	*stored = *session
+	stored.Student = model.User{}
+	return true, nil
+}
+
+func (r *MemoryScreenTimeRepository) GetOpenSessionsByFamily(familyID uint) ([]model.ScreenTimeSession, error) {
+	r.mu.Lock()
+	var open []model.ScreenTimeSession
+	for _, session := range r.sessions {
+		if isOpenSession(session) {
+			open = append(open, *session)
+		}
+	}
+	r.mu.Unlock()
+
+	var result []model.ScreenTimeSession
+	for _, session := range open {
+		student, err := r.userRepo.GetUser(session.StudentID)
+		if err != nil || student.FamilyID != familyID {
+			continue
+		}
+		session.Student = *student
+		result = append(result, session)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (r *MemoryScreenTimeRepository) GetActiveSessions() ([]model.ScreenTimeSession, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var result []model.ScreenTimeSession
+	for _, session := range r.sessions {
+		if session.Status == model.ScreenTimeActive {
+			result = append(result, *session)
+		}
+	}
+	return result, nil
+}
+
+func isOpenSession(session *model.ScreenTimeSession) bool {
+	return session.Status == model.ScreenTimeActive || session.Status == model.ScreenTimePaused
+}
+
+// MemoryAppConfigRepository
+type MemoryAppConfigRepository struct {
+	configs   map[uint]*model.AppConfig
+	idCounter uint
+	mu        sync.Mutex
+}
+
+func NewMemoryAppConfigRepository() *MemoryAppConfigRepository {
+	return &MemoryAppConfigRepository{
+		configs:   make(map[uint]*model.AppConfig),
+		idCounter: 1,
+	}
+}
+
+func (r *MemoryAppConfigRepository) GetAllConfigs() ([]model.AppConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]model.AppConfig, 0, len(r.configs))
+	for _, config := range r.configs {
+		result = append(result, *config)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (r *MemoryAppConfigRepository) SaveConfig(config *model.AppConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	config.UpdatedAt = time.Now()
+	for _, existing := range r.configs {
+		if existing.Key == config.Key && existing.Platform == config.Platform && existing.MinVersion == config.MinVersion {
+			existing.Value = config.Value
+			existing.UpdatedAt = config.UpdatedAt
+			*config = *existing
+			return nil
+		}
+	}
+	config.ID = r.idCounter
+	r.idCounter++
+	stored := *config
+	r.configs[config.ID] = &stored
+	return nil
+}
+
+func (r *MemoryAppConfigRepository) DeleteConfig(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.configs[id]; !ok {
+		return ErrConfigNotFound
+	}
+	delete(r.configs, id)
+	return nil
+}
+
+// MemoryFeatureFlagRepository
+type MemoryFeatureFlagRepository struct {
+	flags     map[string]*model.FeatureFlag
+	idCounter uint
+	mu        sync.Mutex
+}
+
+func NewMemoryFeatureFlagRepository() *MemoryFeatureFlagRepository {
+	return &MemoryFeatureFlagRepository{
+		flags:     make(map[string]*model.FeatureFlag),
+		idCounter: 1,
+	}
+}
+
+func (r *MemoryFeatureFlagRepository) GetAllFlags() ([]model.FeatureFlag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]model.FeatureFlag, 0, len(r.flags))
+	for _, flag := range r.flags {
+		copied := *flag
+		copied.Overrides = append([]model.FeatureFlagOverride(nil), flag.Overrides...)
+		result = append(result, copied)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (r *MemoryFeatureFlagRepository) SaveFlag(flag *model.FeatureFlag) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	flag.UpdatedAt = time.Now()
+	if existing, ok := r.flags[flag.Key]; ok {
+		flag.ID = existing.ID
+		flag.Overrides = existing.Overrides
+	} else {
+		flag.ID = r.idCounter
+		r.idCounter++
+	}
+	stored := *flag
+	r.flags[flag.Key] = &stored
+	return nil
+}
+
+func (r *MemoryFeatureFlagRepository) SetOverride(key string, familyID uint, enabled *bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	flag, ok := r.flags[key]
+	if !ok {
+		return ErrFlagNotFound
+	}
+
+	overrides := flag.Overrides[:0:0]
+	for _, o := range flag.Overrides {
+		if o.FamilyID != familyID {
+			overrides = append(overrides, o)
+		}
+	}
+	if enabled != nil {
+		overrides = append(overrides, model.FeatureFlagOverride{FlagID: flag.ID, FamilyID: familyID, Enabled: *enabled})
+	}
+	flag.Overrides = overrides
+	flag.UpdatedAt = time.Now()
+	return nil
+}
+
+// MemoryBadgeRepository
+type MemoryBadgeRepository struct {
+	badges  []model.Badge
+	unlocks []model.BadgeUnlock
+	mu      sync.Mutex
+}
+
+func NewMemoryBadgeRepository() *MemoryBadgeRepository {
+	repo := &MemoryBadgeRepository{}
+	repo.EnsureBadges(DefaultBadges())
+	return repo
+}
+
+func (r *MemoryBadgeRepository) GetBadges() ([]model.Badge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	badges := append([]model.Badge(nil), r.badges...)
+	sort.SliceStable(badges, func(i, j int) bool { return badges[i].SortOrder < badges[j].SortOrder })
+	return badges, nil
+}
+
+func (r *MemoryBadgeRepository) EnsureBadges(badges []model.Badge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	known := make(map[string]bool, len(r.badges))
+	for _, badge := range r.badges {
+		known[badge.Code] = true
+	}
+	for _, badge := range badges {
+		if known[badge.Code] {
+			continue
+		}
+		badge.ID = uint(len(r.badges) + 1)
+		r.badges = append(r.badges, badge)
+		known[badge.Code] = true
+	}
+	return nil
+}
+
+func (r *MemoryBadgeRepository) CreateUnlock(unlock *model.BadgeUnlock) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.unlocks {
+		if existing.StudentID == unlock.StudentID && existing.BadgeID == unlock.BadgeID {
+			return false, nil
+		}
+	}
+	unlock.ID = uint(len(r.unlocks) + 1)
+	unlock.CreatedAt = time.Now()
+	r.unlocks = append(r.unlocks, *unlock)
+	return true, nil
+}
+
+func (r *MemoryBadgeRepository) GetUnlocksByStudent(studentID uint) ([]model.BadgeUnlock, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unlocks []model.BadgeUnlock
+	for _, unlock := range r.unlocks {
+		if unlock.StudentID == studentID {
+			unlocks = append(unlocks, unlock)
+		}
+	}
+	return unlocks, nil
+}
+
+// MemoryWebhookRepository
+type MemoryWebhookRepository struct {
+	webhooks          map[uint]*model.Webhook
+	deliveries        map[uint]*model.WebhookDelivery
+	idCounter         uint
+	deliveryIDCounter uint
+	mu                sync.Mutex
+}
+
+func NewMemoryWebhookRepository() *MemoryWebhookRepository {
+	return &MemoryWebhookRepository{
+		webhooks:          make(map[uint]*model.Webhook),
+		deliveries:        make(map[uint]*model.WebhookDelivery),
+		idCounter:         1,
+		deliveryIDCounter: 1,
+	}
+}
+
+func (r *MemoryWebhookRepository) CreateWebhook(webhook *model.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	webhook.ID = r.idCounter
+	r.idCounter++
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = webhook.CreatedAt
+	stored := *webhook
+	r.webhooks[webhook.ID] = &stored
+	return nil
+}
+
+func (r *MemoryWebhookRepository) GetWebhook(id uint) (*model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	webhook, ok := r.webhooks[id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	copied := *webhook
+	return &copied, nil
+}
+
+func (r *MemoryWebhookRepository) GetWebhooksByFamily(familyID uint) ([]model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var webhooks []model.Webhook
+	for _, webhook := range r.webhooks {
+		if webhook.FamilyID == familyID {
+			webhooks = append(webhooks, *webhook)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+func (r *MemoryWebhookRepository) UpdateWebhook(webhook *model.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.webhooks[webhook.ID]
+	if !ok {
+		return nil
+	}
+	stored.URL = webhook.URL
+	stored.Secret = webhook.Secret
+	stored.Events = webhook.Events
+	stored.Description = webhook.Description
+	stored.Enabled = webhook.Enabled
+	stored.UpdatedAt = time.Now()
+	webhook.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (r *MemoryWebhookRepository) DeleteWebhook(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.webhooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(r.webhooks, id)
+	for deliveryID, delivery := range r.deliveries {
+		if delivery.WebhookID == id {
+			delete(r.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryWebhookRepository) CreateDelivery(delivery *model.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivery.ID = r.deliveryIDCounter
+	r.deliveryIDCounter++
+	delivery.CreatedAt = time.Now()
+	delivery.UpdatedAt = delivery.CreatedAt
+	stored := *delivery
+	stored.Webhook = model.Webhook{}
+	r.deliveries[delivery.ID] = &stored
+	return nil
+}
+
+func (r *MemoryWebhookRepository) GetDueDeliveries(now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due []model.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.Status != model.WebhookDeliveryPending || delivery.NextAttemptAt == nil || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		copied := *delivery
+		if webhook, ok := r.webhooks[delivery.WebhookID]; ok {
+			copied.Webhook = *webhook
+		}
+		due = append(due, copied)
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].ID < due[j].ID })
+	if limit > 0 && len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (r *MemoryWebhookRepository) ClaimDelivery(id uint, now time.Time, until time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivery, ok := r.deliveries[id]
+	if !ok || delivery.Status != model.WebhookDeliveryPending || delivery.NextAttemptAt == nil || delivery.NextAttemptAt.After(now) {
+		return false, nil
+	}
+	delivery.NextAttemptAt = &until
+	return true, nil
+}
+
+func (r *MemoryWebhookRepository) UpdateDelivery(delivery *model.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.deliveries[delivery.ID]
+	if !ok {
+		return nil
+	}
+	stored.Status = delivery.Status
+	stored.Attempts = delivery.Attempts
+	stored.NextAttemptAt = delivery.NextAttemptAt
+	stored.LastStatusCode = delivery.LastStatusCode
+	stored.LastError = delivery.LastError
+	stored.DeliveredAt = delivery.DeliveredAt
+	stored.UpdatedAt = time.Now()
+	return nil
+}
+
+func (r *MemoryWebhookRepository) GetDeliveries(webhookID uint, limit int) ([]model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deliveries []model.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID > deliveries[j].ID })
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (r *MemoryWebhookRepository) DeleteDeliveriesBefore(cutoff time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, delivery := range r.deliveries {
+		if delivery.Status != model.WebhookDeliveryPending && delivery.CreatedAt.Before(cutoff) {
+			delete(r.deliveries, id)
+		}
+	}
+	return nil
+}
+
+// MemoryDeviceRepository
+type MemoryDeviceRepository struct {
+	devices   map[uint]*model.Device
+	idCounter uint
+	mu        sync.Mutex
+}
+
+func NewMemoryDeviceRepository() *MemoryDeviceRepository {
+	return &MemoryDeviceRepository{
+		devices:   make(map[uint]*model.Device),
+		idCounter: 1,
+	}
+}
+
+func (r *MemoryDeviceRepository) CreateDevice(device *model.Device) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	device.ID = r.idCounter
+	r.idCounter++
+	device.CreatedAt = time.Now()
+	device.UpdatedAt = device.CreatedAt
+	stored := *device
+	r.devices[device.ID] = &stored
+	return nil
+}
+
+func (r *MemoryDeviceRepository) GetDevice(id uint) (*model.Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	device, ok := r.devices[id]
+	if !ok {
+		return nil, ErrDeviceNotFound
+	}
+	copied := *device
+	return &copied, nil
+}
+
+func (r *MemoryDeviceRepository) GetDevicesByFamily(familyID uint) ([]model.Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var devices []model.Device
+	for _, device := range r.devices {
+		if device.FamilyID == familyID {
+			devices = append(devices, *device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	return devices, nil
+}
+
+func (r *MemoryDeviceRepository) UpdateDevice(device *model.Device) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.devices[device.ID]
+	if !ok {
+		return nil
+	}
+	stored.Name = device.Name
+	stored.StudentID = device.StudentID
+	stored.Topic = device.Topic
+	stored.Enabled = device.Enabled
+	stored.UpdatedAt = time.Now()
+	device.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (r *MemoryDeviceRepository) UpdateDeviceState(device *model.Device) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.devices[device.ID]
+	if !ok {
+		return nil
+	}
+	stored.LastCommand = device.LastCommand
+	stored.LastCommandAt = device.LastCommandAt
+	stored.LastError = device.LastError
+	return nil
+}
+
+func (r *MemoryDeviceRepository) DeleteDevice(id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.devices[id]; !ok {
+		return ErrDeviceNotFound
+	}
+	delete(r.devices, id)
+	return nil
+}
+
+func (r *MemoryDeviceRepository) GetFailedDevices() ([]model.Device, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var devices []model.Device
+	for _, device := range r.devices {
+		if device.Enabled && device.LastError != "" {
+			devices = append(devices, *device)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ID < devices[j].ID })
+	return devices, nil
+}
@@ -1,8 +1,11 @@
 package repository
 
 import (
+	"errors"
 	"study-quest-backend/internal/model"
+	"time"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MySQLUserRepository struct {
@@ -29,6 +32,11 @@ func (r *MySQLUserRepository) CreateUser(user *model.User) error {
 	return r.db.Create(user).Error
 }
 
+func (r *MySQLUserRepository) UpdatePassword(userID uint, hash string) error {
+	return r.db.Model(&model.User{}).Where("id = ?", userID).
+		Update("password", hash).Error
+}
+
 func (r *MySQLUserRepository) AddPoints(userID uint, points int) error {
 	return r.db.Model(&model.User{}).Where("id = ?", userID).
 		UpdateColumn("points", gorm.Expr("points + ?", points)).Error
@@ -40,15 +48,44 @@ func (r *MySQLUserRepository) GetStudentsByFamily(familyID uint) ([]model.User,
 	return students, err
 }
 
-func (r *MySQLUserRepository) GetTopStudents(limit int) ([]model.User, error) {
+func (r *MySQLUserRepository) GetMembersByFamily(familyID uint) ([]model.User, error) {
+	var members []model.User
+	err := r.db.Where("family_id = ?", familyID).Order("role, id").Find(&members).Error
+	return members, err
+}
+
+func (r *MySQLUserRepository) SetFamily(userID uint, familyID uint) error {
+	return r.db.Model(&model.User{}).Where("id = ?", userID).
+		Update("family_id", familyID).Error
+}
+
+func (r *MySQLUserRepository) GetTopStudents(familyID uint, limit int) ([]model.User, error) {
 	var students []model.User
-	err := r.db.Where("role = ?", "student").
+	err := r.db.Where("family_id = ? AND role = ?", familyID, "student").
 		Order("points DESC").
 		Limit(limit).
 		Find(&students).Error
 	return students, err
 }
 
+func (r *MySQLUserRepository) CreateLevelUp(levelUp *model.LevelUp) (bool, error) {
+	// idx_level_up keeps one record per student and level
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(levelUp)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *MySQLUserRepository) GetUnseenLevelUps(studentID uint) ([]model.LevelUp, error) {
+	var levelUps []model.LevelUp
+	err := r.db.Where("student_id = ? AND seen_at IS NULL", studentID).Order("level").Find(&levelUps).Error
+	return levelUps, err
+}
+
+func (r *MySQLUserRepository) MarkLevelUpsSeen(studentID uint, now time.Time) error {
+	return r.db.Model(&model.LevelUp{}).
+		Where("student_id = ? AND seen_at IS NULL", studentID).
+		Update("seen_at", now).Error
+}
+
 type MySQLTaskRepository struct {
 	db *gorm.DB
 }
@@ -57,68 +94,386 @@ func NewMySQLTaskRepository(db *gorm.DB) *MySQLTaskRepository {
 	return &MySQLTaskRepository{db: db}
 }
 
-func (r *MySQLTaskRepository) GetTodayTasks(studentID uint) ([]model.TaskLog, error) {
+func (r *MySQLTaskRepository) GetTodayTasks(studentID uint, familyID uint, date string, filter TaskFilter) ([]model.TaskLog, error) {
 	var logs []model.TaskLog
-	err := r.db.Preload("Task").Where("student_id = ?", studentID).Find(&logs).Error
+	query := r.db.Preload("Task").
+		Joins("JOIN tasks ON tasks.id = task_logs.task_id").
+		Where("task_logs.student_id = ? AND tasks.family_id = ? AND task_logs.status <> ?", studentID, familyID, model.TaskStatusCancelled)
+	if filter.Overdue {
+		query = query.Where("task_logs.status IN ?", []int{model.TaskStatusTodo, model.TaskStatusRejected})
+	} else {
+		query = query.Where("task_logs.occurrence_date = ? OR (COALESCE(tasks.recurrence, '') = '' AND task_logs.status IN ?)", date, []int{model.TaskStatusTodo, model.TaskStatusPending, model.TaskStatusRejected})
+	}
+	err := filterTasks(query, filter).Find(&logs).Error
 	return logs, err
 }
 
-func (r *MySQLTaskRepository) GetPendingTasks() ([]model.TaskLog, error) {
+// filterTasks applies filter to a task_logs query joined with tasks
+func filterTasks(query *gorm.DB, filter TaskFilter) *gorm.DB {
+	if filter.Type != 0 {
+		query = query.Where("tasks.type = ?", filter.Type)
+	}
+	if filter.Subject != "" {
+		query = query.Where("tasks.subject = ?", filter.Subject)
+	}
+	if filter.Overdue {
+		query = query.Where("task_logs.overdue_at IS NOT NULL")
+	}
+	return query
+}
+
+func (r *MySQLTaskRepository) GetPendingTasks(familyID uint, filter TaskFilter) ([]model.TaskLog, error) {
 	var logs []model.TaskLog
-	err := r.db.Preload("Task").Where("status = ?", 1).Find(&logs).Error
+	query := r.db.Preload("Task").
+		Joins("JOIN tasks ON tasks.id = task_logs.task_id").
+		Where("task_logs.status = ? AND tasks.family_id = ?", model.TaskStatusPending, familyID)
+	err := filterTasks(query, filter).Find(&logs).Error
 	return logs, err
 }
 
 func (r *MySQLTaskRepository) GetTaskLog(logID uint) (*model.TaskLog, error) {
 	var log model.TaskLog
 	err := r.db.Preload("Task").First(&log, logID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTaskLogNotFound
+	}
 	return &log, err
 }
 
+func (r *MySQLTaskRepository) GetTaskHistory(studentID uint, limit int) ([]model.TaskLog, error) {
+	var logs []model.TaskLog
+	query := r.db.Preload("Task").
+		Where("student_id = ? AND status IN ?", studentID, []int{model.TaskStatusDone, model.TaskStatusRejected}).
+		Order("COALESCE(approved_at, rejected_at, created_at) DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&logs).Error
+	return logs, err
+}
+
+func (r *MySQLTaskRepository) GetLogsByStudent(studentID uint) ([]model.TaskLog, error) {
+	var logs []model.TaskLog
+	err := r.db.Preload("Task").
+		Where("student_id = ? AND status <> ?", studentID, model.TaskStatusCancelled).
+		Order("occurrence_date, id").
+		Find(&logs).Error
+	return logs, err
+}
+
 func (r *MySQLTaskRepository) CreateTask(task *model.Task) error {
 	return r.db.Create(task).Error
 }
 
-func (r *MySQLTaskRepository) AssignTaskToStudent(studentID uint, taskID uint) error {
+func (r *MySQLTaskRepository) GetRecurringTasks() ([]model.Task, error) {
+	var tasks []model.Task
+	err := r.db.Where("recurrence <> '' AND deleted_at IS NULL AND archived_at IS NULL").Find(&tasks).Error
+	return tasks, err
+}
+
+func (r *MySQLTaskRepository) GetTask(id uint) (*model.Task, error) {
+	var task model.Task
+	err := r.db.Where("deleted_at IS NULL").First(&task, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTaskNotFound
+	}
+	return &task, err
+}
+
+func (r *MySQLTaskRepository) GetTasksByFamily(familyID uint, includeArchived bool) ([]model.Task, error) {
+	var tasks []model.Task
+	query := r.db.Where("family_id = ? AND deleted_at IS NULL", familyID)
+	if !includeArchived {
+		query = query.Where("archived_at IS NULL")
+	}
+	err := query.Order("id DESC").Find(&tasks).Error
+	return tasks, err
+}
+
+func (r *MySQLTaskRepository) UpdateTask(task *model.Task) error {
+	result := r.db.Model(&model.Task{}).
+		Where("id = ? AND deleted_at IS NULL", task.ID).
+		Updates(map[string]interface{}{
+			"title":             task.Title,
+			"points":            task.Points,
+			"type":              task.Type,
+			"subject":           task.Subject,
+			"description":       task.Description,
+			"estimated_minutes": task.EstimatedMinutes,
+			"difficulty":        task.Difficulty,
+			"due_time":          task.DueTime,
+			"due_date":          task.DueDate,
+			"recurrence":        task.Recurrence,
+			"assignee_ids":      task.AssigneeIDs,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+func (r *MySQLTaskRepository) SetTaskArchived(id uint, archived bool) error {
+	var archivedAt interface{}
+	if archived {
+		archivedAt = gorm.Expr("NOW()")
+	}
+	result := r.db.Model(&model.Task{}).
+		Where("id = ? AND deleted_at IS NULL", id).
+		Update("archived_at", archivedAt)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+func (r *MySQLTaskRepository) DeleteTask(id uint) error {
+	result := r.db.Model(&model.Task{}).
+		Where("id = ? AND deleted_at IS NULL", id).
+		Update("deleted_at", gorm.Expr("NOW()"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+func (r *MySQLTaskRepository) CancelOpenLogs(taskID uint, studentIDs []uint) (int, error) {
+	query := r.db.Model(&model.TaskLog{}).
+		Where("task_id = ? AND status IN ?", taskID, []int{model.TaskStatusTodo, model.TaskStatusRejected})
+	if studentIDs != nil {
+		if len(studentIDs) == 0 {
+			return 0, nil
+		}
+		query = query.Where("student_id IN ?", studentIDs)
+	}
+	result := query.Update("status", model.TaskStatusCancelled)
+	return int(result.RowsAffected), result.Error
+}
+
+func (r *MySQLTaskRepository) RescheduleOpenLogs(taskID uint, dueAt func(date string) *time.Time) (int, error) {
+	changed := 0
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var logs []model.TaskLog
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("task_id = ? AND status IN ? AND overdue_at IS NULL", taskID, []int{model.TaskStatusTodo, model.TaskStatusRejected}).
+			Find(&logs).Error
+		if err != nil {
+			return err
+		}
+		for _, log := range logs {
+			due := dueAt(log.OccurrenceDate)
+			if sameTime(log.DueAt, due) {
+				continue
+			}
+			if err := tx.Model(&model.TaskLog{}).Where("id = ?", log.ID).Update("due_at", due).Error; err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	})
+	return changed, err
+}
+
+func (r *MySQLTaskRepository) CancelStudentLogs(studentID uint) (int, error) {
+	result := r.db.Model(&model.TaskLog{}).
+		Where("student_id = ? AND status IN ?", studentID, []int{model.TaskStatusTodo, model.TaskStatusPending, model.TaskStatusRejected}).
+		Update("status", model.TaskStatusCancelled)
+	return int(result.RowsAffected), result.Error
+}
+
+func (r *MySQLTaskRepository) AssignTaskToStudent(studentID uint, taskID uint, date string, dueAt *time.Time) (bool, error) {
 	log := &model.TaskLog{
-		StudentID: studentID,
-		TaskID:    taskID,
-		Status:    0, // Todo
+		StudentID:      studentID,
+		TaskID:         taskID,
+		OccurrenceDate: date,
+		Status:         model.TaskStatusTodo,
+		DueAt:          dueAt,
 	}
-	return r.db.Create(log).Error
+	// idx_task_student_date makes this a no-op when the log already exists
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(log)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *MySQLTaskRepository) GetNewlyOverdueLogs(now time.Time) ([]model.TaskLog, error) {
+	var logs []model.TaskLog
+	err := r.db.Preload("Task").
+		Where("status IN ? AND due_at < ? AND overdue_at IS NULL", []int{model.TaskStatusTodo, model.TaskStatusRejected}, now).
+		Order("id").
+		Find(&logs).Error
+	return logs, err
 }
 
 func (r *MySQLTaskRepository) SubmitTask(studentID uint, taskID uint) error {
 	return r.db.Model(&model.TaskLog{}).
-		Where("student_id = ? AND id = ? AND status = ?", studentID, taskID, 0).
+		Where("student_id = ? AND id = ? AND status = ?", studentID, taskID, model.TaskStatusTodo).
 		Updates(map[string]interface{}{
-			"status":       1,
+			"status":       model.TaskStatusPending,
 			"submitted_at": gorm.Expr("NOW()"),
 		}).Error
 }
 
-func (r *MySQLTaskRepository) SubmitTaskByLogID(logID uint) error {
-	return r.db.Model(&model.TaskLog{}).
-		Where("id = ? AND status = ?", logID, 0).
+func (r *MySQLTaskRepository) SubmitTaskByLogID(logID uint, proof model.ProofImages) error {
+	updates := map[string]interface{}{
+		"status":       model.TaskStatusPending,
+		"submitted_at": gorm.Expr("NOW()"),
+		"attempts":     gorm.Expr("attempts + 1"),
+		"overdue_at":   gorm.Expr("CASE WHEN overdue_at IS NULL AND due_at < NOW() THEN NOW() ELSE overdue_at END"),
+	}
+	if proof != nil {
+		updates["proof_img"] = proof
+	}
+	result := r.db.Model(&model.TaskLog{}).
+		Where("id = ? AND status IN ?", logID, []int{model.TaskStatusTodo, model.TaskStatusRejected}).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTransition
+	}
+	return nil
+}
+
+func (r *MySQLTaskRepository) RejectTask(logID uint, comment *model.TaskComment) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.TaskLog{}).
+			Where("id = ? AND status = ?", logID, model.TaskStatusPending).
+			Updates(map[string]interface{}{
+				"status":        model.TaskStatusRejected,
+				"reject_reason": comment.Content,
+				"rejected_at":   gorm.Expr("NOW()"),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTransition
+		}
+		return tx.Create(comment).Error
+	})
+}
+
+func (r *MySQLTaskRepository) CreateComment(comment *model.TaskComment) error {
+	return r.db.Create(comment).Error
+}
+
+func (r *MySQLTaskRepository) GetComments(logID uint) ([]model.TaskComment, error) {
+	var comments []model.TaskComment
+	err := r.db.Where("log_id = ?", logID).Order("id").Find(&comments).Error
+	return comments, err
+}
+
+type MySQLFamilyRepository struct {
+	db *gorm.DB
+}
+
+func NewMySQLFamilyRepository(db *gorm.DB) *MySQLFamilyRepository {
+	return &MySQLFamilyRepository{db: db}
+}
+
+func (r *MySQLFamilyRepository) CreateFamily(family *model.Family) error {
+	return r.db.Create(family).Error
+}
+
+func (r *MySQLFamilyRepository) GetFamily(id uint) (*model.Family, error) {
+	var family model.Family
+	err := r.db.First(&family, id).Error
+	return &family, err
+}
+
+func (r *MySQLFamilyRepository) UpdateSettings(family *model.Family) error {
+	return r.db.Model(&model.Family{}).Where("id = ?", family.ID).
 		Updates(map[string]interface{}{
-			"status":       1,
-			"submitted_at": gorm.Expr("NOW()"),
+			"min_award_percent":    family.MinAwardPercent,
+			"max_award_percent":    family.MaxAwardPercent,
+			"late_penalty_percent": family.LatePenaltyPercent,
+			"missed_task_penalty":  family.MissedTaskPenalty,
+			"timezone":             family.Timezone,
+			"streak_skip_days":     family.StreakSkipDays,
+			"streak_milestones":    family.StreakMilestones,
 		}).Error
 }
 
-func (r *MySQLTaskRepository) ApproveTask(logID uint) error {
-	return r.db.Model(&model.TaskLog{}).
-		Where("id = ?", logID).
+func (r *MySQLFamilyRepository) CreateInvite(invite *model.FamilyInvite) error {
+	return r.db.Create(invite).Error
+}
+
+func (r *MySQLFamilyRepository) UseInvite(code string, role string, now time.Time) (*model.FamilyInvite, error) {
+	// Conditional update so concurrent joins cannot exceed MaxUses
+	result := r.db.Model(&model.FamilyInvite{}).
+		Where("code = ? AND expires_at > ? AND (max_uses = 0 OR uses < max_uses)", code, now).
+		Where("role = '' OR role = ?", role).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInviteInvalid
+	}
+
+	var invite model.FamilyInvite
+	err := r.db.Where("code = ?", code).First(&invite).Error
+	return &invite, err
+}
+
+func (r *MySQLFamilyRepository) ReleaseInvite(code string) error {
+	return r.db.Model(&model.FamilyInvite{}).
+		Where("code = ? AND uses > 0", code).
+		UpdateColumn("uses", gorm.Expr("uses - 1")).Error
+}
+
+type MySQLIdempotencyRepository struct {
+	db *gorm.DB
+}
+
+func NewMySQLIdempotencyRepository(db *gorm.DB) *MySQLIdempotencyRepository {
+	return &MySQLIdempotencyRepository{db: db}
+}
+
+func (r *MySQLIdempotencyRepository) ReserveKey(record *model.IdempotencyKey, now time.Time) (*model.IdempotencyKey, error) {
+	var existing *model.IdempotencyKey
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// An expired record no longer blocks the key
+		err := tx.Where("user_id = ? AND idempotency_key = ? AND expires_at <= ?", record.UserID, record.Key, now).
+			Delete(&model.IdempotencyKey{}).Error
+		if err != nil {
+			return err
+		}
+		// idx_idempotency_user_key lets exactly one concurrent request insert
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		existing = &model.IdempotencyKey{}
+		return tx.Where("user_id = ? AND idempotency_key = ?", record.UserID, record.Key).First(existing).Error
+	})
+	return existing, err
+}
+
+func (r *MySQLIdempotencyRepository) CompleteKey(id uint, statusCode int, contentType string, response []byte) error {
+	return r.db.Model(&model.IdempotencyKey{}).Where("id = ?", id).
 		Updates(map[string]interface{}{
-			"status":      2,
-			"approved_at": gorm.Expr("NOW()"),
+			"status_code":  statusCode,
+			"content_type": contentType,
+			"response":     response,
 		}).Error
 }
 
-func (r *MySQLTaskRepository) RejectTask(logID uint) error {
-	return r.db.Model(&model.TaskLog{}).
-		Where("id = ?", logID).
-		Update("status", 3).Error
+func (r *MySQLIdempotencyRepository) DeleteKey(id uint) error {
+	return r.db.Delete(&model.IdempotencyKey{}, id).Error
+}
+
+func (r *MySQLIdempotencyRepository) DeleteExpiredKeys(now time.Time) error {
+	return r.db.Where("expires_at <= ?", now).Delete(&model.IdempotencyKey{}).Error
 }
 
 type MySQLSessionRepository struct {
@@ -143,6 +498,10 @@ func (r *MySQLSessionRepository) DeleteSession(token string) error {
 	return r.db.Where("token = ?", token).Delete(&model.Session{}).Error
 }
 
+func (r *MySQLSessionRepository) DeleteUserSessions(userID uint, exceptToken string) error {
+	return r.db.Where("user_id = ? AND token <> ?", userID, exceptToken).Delete(&model.Session{}).Error
+}
+
 // MySQLRedemptionRepository
 type MySQLRedemptionRepository struct {
 	db *gorm.DB
@@ -156,25 +515,55 @@ func (r *MySQLRedemptionRepository) CreateRedemption(redemption *model.Redemptio
 	return r.db.Create(redemption).Error
 }
 
-func (r *MySQLRedemptionRepository) GetRedemptionsByFamily(familyID uint) ([]model.Redemption, error) {
+func (r *MySQLRedemptionRepository) GetRedemption(id uint) (*model.Redemption, error) {
+	var redemption model.Redemption
+	err := r.db.First(&redemption, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRedemptionNotFound
+	}
+	return &redemption, err
+}
+
+func (r *MySQLRedemptionRepository) GetRedemptionsByFamily(familyID uint, status string) ([]model.Redemption, error) {
 	var redemptions []model.Redemption
-	err := r.db.Preload("Student").Preload("Reward").
+	query := r.db.Preload("Student").Preload("Reward").
 		Joins("JOIN users ON users.id = redemptions.student_id").
-		Where("users.family_id = ?", familyID).
-		Order("redemptions.created_at DESC").
-		Find(&redemptions).Error
+		Where("users.family_id = ?", familyID)
+	if status != "" {
+		query = query.Where("redemptions.status = ?", status)
+	}
+	err := query.Order("redemptions.created_at DESC").Find(&redemptions).Error
 	return redemptions, err
 }
 
-func (r *MySQLRedemptionRepository) GetRedemptionsByStudent(studentID uint) ([]model.Redemption, error) {
+func (r *MySQLRedemptionRepository) GetRedemptionsByStudent(studentID uint, status string) ([]model.Redemption, error) {
 	var redemptions []model.Redemption
-	err := r.db.Preload("Student").Preload("Reward").
-		Where("student_id = ?", studentID).
-		Order("created_at DESC").
-		Find(&redemptions).Error
+	query := r.db.Preload("Student").Preload("Reward").
+		Where("student_id = ?", studentID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("created_at DESC").Find(&redemptions).Error
 	return redemptions, err
 }
 
+func (r *MySQLRedemptionRepository) UpdateRedemptionStatus(id uint, from []string, status string, handledBy uint) (bool, error) {
+	updates := map[string]interface{}{
+		"status":     status,
+		"handled_by": handledBy,
+	}
+	switch status {
+	case model.RedemptionApproved:
+		updates["approved_at"] = gorm.Expr("NOW()")
+	case model.RedemptionFulfilled:
+		updates["fulfilled_at"] = gorm.Expr("NOW()")
+	}
+	result := r.db.Model(&model.Redemption{}).
+		Where("id = ? AND status IN ?", id, from).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
 // MySQLRewardRepository
 type MySQLRewardRepository struct {
 	db *gorm.DB
@@ -184,15 +573,637 @@ func NewMySQLRewardRepository(db *gorm.DB) *MySQLRewardRepository {
 	return &MySQLRewardRepository{db: db}
 }
 
-func (r *MySQLRewardRepository) GetAllRewards() ([]model.Reward, error) {
+func (r *MySQLRewardRepository) GetRewardsByFamily(familyID uint, includeArchived bool) ([]model.Reward, error) {
 	var rewards []model.Reward
-	err := r.db.Find(&rewards).Error
+	query := r.db.Where("family_id IN ?", []uint{0, familyID})
+	if !includeArchived {
+		query = query.Where("deleted_at IS NULL")
+	}
+	err := query.Order("sort_order, id").Find(&rewards).Error
 	return rewards, err
 }
 
 func (r *MySQLRewardRepository) GetReward(id uint) (*model.Reward, error) {
 	var reward model.Reward
 	err := r.db.First(&reward, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRewardNotFound
+	}
 	return &reward, err
 }
 
+func (r *MySQLRewardRepository) CreateReward(reward *model.Reward) error {
+	return r.db.Create(reward).Error
+}
+
+func (r *MySQLRewardRepository) UpdateReward(reward *model.Reward) error {
+	return r.db.Model(&model.Reward{}).Where("id = ?", reward.ID).
+		Updates(map[string]interface{}{
+			"title":       reward.Title,
+			"cost":        reward.Cost,
+			"category":    reward.Category,
+			"stock":       reward.Stock,
+			"minutes":     reward.Minutes,
+			"description": reward.Description,
+			"image_url":   reward.ImageURL,
+		}).Error
+}
+
+func (r *MySQLRewardRepository) SetRewardArchived(id uint, archived bool) error {
+	var deletedAt interface{}
+	if archived {
+		deletedAt = gorm.Expr("NOW()")
+	}
+	return r.db.Model(&model.Reward{}).Where("id = ?", id).
+		Update("deleted_at", deletedAt).Error
+}
+
+func (r *MySQLRewardRepository) AddStock(id uint, amount int) error {
+	return r.db.Model(&model.Reward{}).Where("id = ? AND stock >= 0", id).
+		UpdateColumn("stock", gorm.Expr("stock + ?", amount)).Error
+}
+
+func (r *MySQLRewardRepository) ReorderRewards(familyID uint, ids []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for i, id := range ids {
+			err := tx.Model(&model.Reward{}).Where("id = ? AND family_id = ?", id, familyID).
+				UpdateColumn("sort_order", i).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+
+// MySQLPointRepository
+type MySQLPointRepository struct {
+	db *gorm.DB
+}
+
+func NewMySQLPointRepository(db *gorm.DB) *MySQLPointRepository {
+	return &MySQLPointRepository{db: db}
+}
+
+func (r *MySQLPointRepository) ApproveTask(logID uint, entry *model.PointTransaction) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Only a pending log can be approved; a repeated or concurrent
+		// approval matches no row and must not award points again
+		result := tx.Model(&model.TaskLog{}).
+			Where("id = ? AND status = ?", logID, model.TaskStatusPending).
+			Updates(map[string]interface{}{
+				"status":         model.TaskStatusDone,
+				"approved_at":    gorm.Expr("NOW()"),
+				"awarded_points": entry.Delta,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTransition
+		}
+		return applyPoints(tx, entry)
+	})
+}
+
+func (r *MySQLPointRepository) MarkOverdue(logID uint, now time.Time, entry *model.PointTransaction) (bool, error) {
+	marked := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Marking is conditional so a penalty is deducted at most once
+		result := tx.Model(&model.TaskLog{}).
+			Where("id = ? AND overdue_at IS NULL AND status IN ?", logID, []int{model.TaskStatusTodo, model.TaskStatusRejected}).
+			Update("overdue_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || entry == nil {
+			marked = result.RowsAffected > 0
+			return nil
+		}
+		marked = true
+
+		var user model.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, entry.UserID).Error; err != nil {
+			return err
+		}
+		// A penalty never takes the balance below zero
+		if -entry.Delta > user.Points {
+			entry.Delta = -user.Points
+		}
+		if entry.Delta == 0 {
+			return nil
+		}
+		return applyPoints(tx, entry)
+	})
+	return marked, err
+}
+
+func (r *MySQLPointRepository) AwardStreakBonus(bonus *model.StreakBonus, entry *model.PointTransaction) (bool, error) {
+	awarded := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the student first so concurrent approvals check one at a time
+		var user model.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, entry.UserID).Error; err != nil {
+			return err
+		}
+		var count int64
+		err := tx.Model(&model.StreakBonus{}).
+			Where("student_id = ? AND days = ? AND start_date >= ?", bonus.StudentID, bonus.Days, bonus.StartDate).
+			Count(&count).Error
+		if err != nil || count > 0 {
+			return err
+		}
+		if err := tx.Create(bonus).Error; err != nil {
+			return err
+		}
+		entry.SourceID = bonus.ID
+		awarded = true
+		return applyPoints(tx, entry)
+	})
+	return awarded && err == nil, err
+}
+
+func (r *MySQLPointRepository) Redeem(redemption *model.Redemption, entry *model.PointTransaction) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the reward row so concurrent redemptions see the updated stock
+		var reward model.Reward
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&reward, redemption.RewardID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && reward.DeletedAt != nil) {
+			return ErrRewardNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if reward.Stock == 0 {
+			return ErrOutOfStock
+		}
+
+		if reward.Stock > 0 {
+			err := tx.Model(&model.Reward{}).Where("id = ?", reward.ID).
+				UpdateColumn("stock", gorm.Expr("stock - 1")).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		redemption.RewardTitle = reward.Title
+		redemption.Cost = reward.Cost
+		if reward.Category == model.RewardCategoryTime {
+			redemption.Minutes = reward.Minutes
+		}
+		if err := tx.Create(redemption).Error; err != nil {
+			return err
+		}
+		entry.Delta = -reward.Cost
+		entry.Remark = reward.Title
+		entry.SourceID = redemption.ID
+		return applyPoints(tx, entry)
+	})
+}
+
+func (r *MySQLPointRepository) Refund(redemptionID uint, from []string, status string, note string, entry *model.PointTransaction) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var redemption model.Redemption
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&redemption, redemptionID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrRedemptionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !containsStatus(from, redemption.Status) {
+			return ErrInvalidTransition
+		}
+
+		err = tx.Model(&model.Redemption{}).Where("id = ?", redemption.ID).
+			Updates(map[string]interface{}{
+				"status":      status,
+				"note":        note,
+				"handled_by":  entry.ActorID,
+				"refunded_at": gorm.Expr("NOW()"),
+			}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&model.Reward{}).Where("id = ? AND stock >= 0", redemption.RewardID).
+			UpdateColumn("stock", gorm.Expr("stock + 1")).Error
+		if err != nil {
+			return err
+		}
+
+		entry.UserID = redemption.StudentID
+		entry.SourceID = redemption.ID
+		entry.Delta = redemption.Cost
+		return applyPoints(tx, entry)
+	})
+}
+
+func (r *MySQLPointRepository) GetTransactionsByUser(userID uint, limit int) ([]model.PointTransaction, error) {
+	var transactions []model.PointTransaction
+	query := r.db.Where("user_id = ?", userID).Order("id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&transactions).Error
+	return transactions, err
+}
+
+// applyPoints locks the user row, updates the balance and writes the ledger
+// entry. It must run inside a transaction.
+func applyPoints(tx *gorm.DB, entry *model.PointTransaction) error {
+	var user model.User
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, entry.UserID).Error; err != nil {
+		return err
+	}
+
+	balance := user.Points + entry.Delta
+	if entry.Delta < 0 && balance < 0 {
+		// Rolls back the whole transaction, including any stock change
+		return ErrInsufficientPoints
+	}
+	updates := map[string]interface{}{"points": balance}
+	if entry.IsEarning() {
+		updates["total_points_earned"] = user.TotalPointsEarned + entry.Delta
+	}
+	if err := tx.Model(&model.User{}).Where("id = ?", user.ID).
+		UpdateColumns(updates).Error; err != nil {
+		return err
+	}
+
+	entry.BalanceAfter = balance
+	return tx.Create(entry).Error
+}
+
+// MySQLScreenTimeRepository
+type MySQLScreenTimeRepository struct {
+	db *gorm.DB
+}
+
+func NewMySQLScreenTimeRepository(db *gorm.DB) *MySQLScreenTimeRepository {
+	return &MySQLScreenTimeRepository{db: db}
+}
+
+var openSessionStatuses = []string{model.ScreenTimeActive, model.ScreenTimePaused}
+
+func (r *MySQLScreenTimeRepository) GetBalanceSeconds(studentID uint) (int, error) {
+	var granted, used int
+	err := r.db.Model(&model.Redemption{}).
+		Where("student_id = ? AND status = ?", studentID, model.RedemptionFulfilled).
+		Select("COALESCE(SUM(minutes), 0) * 60").Scan(&granted).Error
+	if err != nil {
+		return 0, err
+	}
+	err = r.db.Model(&model.ScreenTimeSession{}).
+		Where("student_id = ? AND status NOT IN ?", studentID, openSessionStatuses).
+		Select("COALESCE(SUM(used_seconds), 0)").Scan(&used).Error
+	return granted - used, err
+}
+
+func (r *MySQLScreenTimeRepository) GetOpenSession(studentID uint) (*model.ScreenTimeSession, error) {
+	var session model.ScreenTimeSession
+	err := r.db.Where("student_id = ? AND status IN ?", studentID, openSessionStatuses).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *MySQLScreenTimeRepository) CreateSession(session *model.ScreenTimeSession) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the student row so two concurrent starts cannot both succeed
+		var user model.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, session.StudentID).Error; err != nil {
+			return err
+		}
+		var count int64
+		err := tx.Model(&model.ScreenTimeSession{}).
+			Where("student_id = ? AND status IN ?", session.StudentID, openSessionStatuses).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrSessionOpen
+		}
+		return tx.Omit("Student").Create(session).Error
+	})
+}
+
+func (r *MySQLScreenTimeRepository) UpdateSession(session *model.ScreenTimeSession, from string) (bool, error) {
+	result := r.db.Model(&model.ScreenTimeSession{}).
+		Where("id = ? AND status = ?", session.ID, from).
+		Updates(map[string]interface{}{
+			"status":       session.Status,
+			"used_seconds": session.UsedSeconds,
+			"resumed_at":   session.ResumedAt,
+			"ended_at":     session.EndedAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *MySQLScreenTimeRepository) GetOpenSessionsByFamily(familyID uint) ([]model.ScreenTimeSession, error) {
+	var sessions []model.ScreenTimeSession
+	err := r.db.Preload("Student").
+		Joins("JOIN users ON users.id = screen_time_sessions.student_id").
+		Where("users.family_id = ? AND screen_time_sessions.status IN ?", familyID, openSessionStatuses).
+		Order("screen_time_sessions.id").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *MySQLScreenTimeRepository) GetActiveSessions() ([]model.ScreenTimeSession, error) {
+	var sessions []model.ScreenTimeSession
+	err := r.db.Where("status = ?", model.ScreenTimeActive).Find(&sessions).Error
+	return sessions, err
+}
+
+// MySQLAppConfigRepository
+type MySQLAppConfigRepository struct {
+	db *gorm.DB
+}
+
+func NewMySQLAppConfigRepository(db *gorm.DB) *MySQLAppConfigRepository {
+	return &MySQLAppConfigRepository{db: db}
+}
+
+func (r *MySQLAppConfigRepository) GetAllConfigs() ([]model.AppConfig, error) {
+	var configs []model.AppConfig
+	err := r.db.Order("id").Find(&configs).Error
+	return configs, err
+}
+
+func (r *MySQLAppConfigRepository) SaveConfig(config *model.AppConfig) error {
+	err := r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"value", "updated_at"}),
+	}).Create(config).Error
+	if err != nil {
+		return err
+	}
+	// On conflict MySQL does not report the id of the existing row
+	var saved model.AppConfig
+	err = r.db.Where("`key` = ? AND platform = ? AND min_version = ?", config.Key, config.Platform, config.MinVersion).
+		First(&saved).Error
+	if err != nil {
+		return err
+	}
+	*config = saved
+	return nil
+}
+
+func (r *MySQLAppConfigRepository) DeleteConfig(id uint) error {
+	result := r.db.Delete(&model.AppConfig{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrConfigNotFound
+	}
+	return nil
+}
+
+// MySQLFeatureFlagRepository
+type MySQLFeatureFlagRepository struct {
+	db *gorm.DB
+}
+
+func NewMySQLFeatureFlagRepository(db *gorm.DB) *MySQLFeatureFlagRepository {
+	return &MySQLFeatureFlagRepository{db: db}
+}
+
+func (r *MySQLFeatureFlagRepository) GetAllFlags() ([]model.FeatureFlag, error) {
+	var flags []model.FeatureFlag
+	err := r.db.Preload("Overrides").Order("id").Find(&flags).Error
+	return flags, err
+}
+
+func (r *MySQLFeatureFlagRepository) SaveFlag(flag *model.FeatureFlag) error {
+	err := r.db.Omit("Overrides").Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"description", "enabled", "platforms", "percentage", "updated_at"}),
+	}).Create(flag).Error
+	if err != nil {
+		return err
+	}
+	var saved model.FeatureFlag
+	if err := r.db.Preload("Overrides").Where("`key` = ?", flag.Key).First(&saved).Error; err != nil {
+		return err
+	}
+	*flag = saved
+	return nil
+}
+
+func (r *MySQLFeatureFlagRepository) SetOverride(key string, familyID uint, enabled *bool) error {
+	var flag model.FeatureFlag
+	err := r.db.Where("`key` = ?", key).First(&flag).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrFlagNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if enabled == nil {
+		return r.db.Where("flag_id = ? AND family_id = ?", flag.ID, familyID).
+			Delete(&model.FeatureFlagOverride{}).Error
+	}
+	override := model.FeatureFlagOverride{FlagID: flag.ID, FamilyID: familyID, Enabled: *enabled}
+	return r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"enabled"}),
+	}).Create(&override).Error
+}
+
+// MySQLBadgeRepository
+type MySQLBadgeRepository struct {
+	db *gorm.DB
+}
+
+func NewMySQLBadgeRepository(db *gorm.DB) *MySQLBadgeRepository {
+	return &MySQLBadgeRepository{db: db}
+}
+
+func (r *MySQLBadgeRepository) GetBadges() ([]model.Badge, error) {
+	var badges []model.Badge
+	err := r.db.Order("sort_order, id").Find(&badges).Error
+	return badges, err
+}
+
+func (r *MySQLBadgeRepository) EnsureBadges(badges []model.Badge) error {
+	if len(badges) == 0 {
+		return nil
+	}
+	// The unique code keeps badges that are already in the catalog
+	return r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&badges).Error
+}
+
+func (r *MySQLBadgeRepository) CreateUnlock(unlock *model.BadgeUnlock) (bool, error) {
+	// idx_badge_unlock keeps one unlock per student and badge
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(unlock)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *MySQLBadgeRepository) GetUnlocksByStudent(studentID uint) ([]model.BadgeUnlock, error) {
+	var unlocks []model.BadgeUnlock
+	err := r.db.Where("student_id = ?", studentID).Order("id").Find(&unlocks).Error
+	return unlocks, err
+}
+
+// MySQLWebhookRepository
+type MySQLWebhookRepository struct {
+	db *gorm.DB
+}
+
+func NewMySQLWebhookRepository(db *gorm.DB) *MySQLWebhookRepository {
+	return &MySQLWebhookRepository{db: db}
+}
+
+func (r *MySQLWebhookRepository) CreateWebhook(webhook *model.Webhook) error {
+	return r.db.Create(webhook).Error
+}
+
+func (r *MySQLWebhookRepository) GetWebhook(id uint) (*model.Webhook, error) {
+	var webhook model.Webhook
+	err := r.db.First(&webhook, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWebhookNotFound
+	}
+	return &webhook, err
+}
+
+func (r *MySQLWebhookRepository) GetWebhooksByFamily(familyID uint) ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+	err := r.db.Where("family_id = ?", familyID).Order("id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+func (r *MySQLWebhookRepository) UpdateWebhook(webhook *model.Webhook) error {
+	return r.db.Model(&model.Webhook{}).Where("id = ?", webhook.ID).
+		Updates(map[string]interface{}{
+			"url":         webhook.URL,
+			"secret":      webhook.Secret,
+			"events":      webhook.Events,
+			"description": webhook.Description,
+			"enabled":     webhook.Enabled,
+		}).Error
+}
+
+func (r *MySQLWebhookRepository) DeleteWebhook(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&model.Webhook{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrWebhookNotFound
+		}
+		return tx.Where("webhook_id = ?", id).Delete(&model.WebhookDelivery{}).Error
+	})
+}
+
+func (r *MySQLWebhookRepository) CreateDelivery(delivery *model.WebhookDelivery) error {
+	return r.db.Omit("Webhook").Create(delivery).Error
+}
+
+func (r *MySQLWebhookRepository) GetDueDeliveries(now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	err := r.db.Preload("Webhook").
+		Where("status = ? AND next_attempt_at <= ?", model.WebhookDeliveryPending, now).
+		Order("id").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (r *MySQLWebhookRepository) ClaimDelivery(id uint, now time.Time, until time.Time) (bool, error) {
+	result := r.db.Model(&model.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", id, model.WebhookDeliveryPending, now).
+		Update("next_attempt_at", until)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *MySQLWebhookRepository) UpdateDelivery(delivery *model.WebhookDelivery) error {
+	return r.db.Model(&model.WebhookDelivery{}).Where("id = ?", delivery.ID).
+		Updates(map[string]interface{}{
+			"status":           delivery.Status,
+			"attempts":         delivery.Attempts,
+			"next_attempt_at":  delivery.NextAttemptAt,
+			"last_status_code": delivery.LastStatusCode,
+			"last_error":       delivery.LastError,
+			"delivered_at":     delivery.DeliveredAt,
+		}).Error
+}
+
+func (r *MySQLWebhookRepository) GetDeliveries(webhookID uint, limit int) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	err := r.db.Where("webhook_id = ?", webhookID).Order("id DESC").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (r *MySQLWebhookRepository) DeleteDeliveriesBefore(cutoff time.Time) error {
+	return r.db.Where("status <> ? AND created_at < ?", model.WebhookDeliveryPending, cutoff).
+		Delete(&model.WebhookDelivery{}).Error
+}
+
+// MySQLDeviceRepository
+type MySQLDeviceRepository struct {
+	db *gorm.DB
+}
+
+func NewMySQLDeviceRepository(db *gorm.DB) *MySQLDeviceRepository {
+	return &MySQLDeviceRepository{db: db}
+}
+
+func (r *MySQLDeviceRepository) CreateDevice(device *model.Device) error {
+	return r.db.Create(device).Error
+}
+
+func (r *MySQLDeviceRepository) GetDevice(id uint) (*model.Device, error) {
+	var device model.Device
+	err := r.db.First(&device, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDeviceNotFound
+	}
+	return &device, err
+}
+
+func (r *MySQLDeviceRepository) GetDevicesByFamily(familyID uint) ([]model.Device, error) {
+	var devices []model.Device
+	err := r.db.Where("family_id = ?", familyID).Order("id").Find(&devices).Error
+	return devices, err
+}
+
+func (r *MySQLDeviceRepository) UpdateDevice(device *model.Device) error {
+	return r.db.Model(&model.Device{}).Where("id = ?", device.ID).
+		Updates(map[string]interface{}{
+			"name":       device.Name,
+			"student_id": device.StudentID,
+			"topic":      device.Topic,
+			"enabled":    device.Enabled,
+		}).Error
+}
+
+func (r *MySQLDeviceRepository) UpdateDeviceState(device *model.Device) error {
+	return r.db.Model(&model.Device{}).Where("id = ?", device.ID).
+		UpdateColumns(map[string]interface{}{
+			"last_command":    device.LastCommand,
+			"last_command_at": device.LastCommandAt,
+			"last_error":      device.LastError,
+		}).Error
+}
+
+func (r *MySQLDeviceRepository) DeleteDevice(id uint) error {
+	result := r.db.Delete(&model.Device{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+func (r *MySQLDeviceRepository) GetFailedDevices() ([]model.Device, error) {
+	var devices []model.Device
+	err := r.db.Where("enabled = ? AND last_error <> ''", true).Order("id").Find(&devices).Error
+	return devices, err
+}
@@ -0,0 +1,33 @@
+package scheduler
+
+import (
+	"study-quest-backend/internal/model"
+	"time"
+)
+
+// DueAt returns when the log of task scheduled for date (YYYY-MM-DD) must be
+// submitted, or nil when it has no deadline. Recurring tasks are due at
+// DueTime on their day, or at the end of it; one-off tasks are due on
+// DueDate (or the day they were assigned when only DueTime is set).
+func DueAt(task *model.Task, date string, loc *time.Location) *time.Time {
+	if task.Recurrence == "" && task.DueDate == "" && task.DueTime == "" {
+		return nil
+	}
+	if task.Recurrence == "" && task.DueDate != "" {
+		date = task.DueDate
+	}
+	day, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return nil
+	}
+
+	due := day.AddDate(0, 0, 1)
+	if task.DueTime != "" {
+		clock, err := time.Parse("15:04", task.DueTime)
+		if err != nil {
+			return nil
+		}
+		due = time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+	}
+	return &due
+}
@@ -0,0 +1,207 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidRecurrence = errors.New("invalid recurrence rule")
+
+// Rule decides on which days a recurring task produces a TaskLog
+type Rule interface {
+	Matches(day time.Time) bool
+}
+
+// DateKey formats a day the way TaskLog.OccurrenceDate stores it
+func DateKey(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var cronAliases = map[string]string{
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// ParseRule parses a Task.Recurrence value. Supported forms:
+//
+//	""  / "once"         one-off task, returns a nil Rule
+//	"daily"              every day
+//	"weekdays"           Monday to Friday
+//	"weekends"           Saturday and Sunday
+//	"weekly:mon,wed"     the listed days of the week
+//	"0 8 * * 1-5"        5-field cron expression (only the day fields matter)
+func ParseRule(expr string) (Rule, error) {
+	expr = strings.ToLower(strings.TrimSpace(expr))
+	switch expr {
+	case "", "once":
+		return nil, nil
+	case "daily":
+		return allDays(), nil
+	case "weekdays":
+		return weekdaySet{time.Monday: true, time.Tuesday: true, time.Wednesday: true, time.Thursday: true, time.Friday: true}, nil
+	case "weekends":
+		return weekdaySet{time.Saturday: true, time.Sunday: true}, nil
+	}
+
+	if strings.HasPrefix(expr, "weekly:") {
+		set := weekdaySet{}
+		for _, name := range strings.Split(strings.TrimPrefix(expr, "weekly:"), ",") {
+			key := strings.TrimSpace(name)
+			if len(key) > 3 {
+				key = key[:3] // accept "monday" as well as "mon"
+			}
+			day, ok := weekdayNames[key]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown weekday %q", ErrInvalidRecurrence, name)
+			}
+			set[day] = true
+		}
+		return set, nil
+	}
+
+	if alias, ok := cronAliases[expr]; ok {
+		expr = alias
+	}
+	return parseCron(expr)
+}
+
+type weekdaySet map[time.Weekday]bool
+
+func allDays() weekdaySet {
+	set := make(weekdaySet, 7)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		set[d] = true
+	}
+	return set
+}
+
+func (s weekdaySet) Matches(day time.Time) bool {
+	return s[day.Weekday()]
+}
+
+// cronRule keeps the day-level fields of a cron expression. Minute and hour
+// are validated but ignored: TaskLogs are materialized once per day.
+type cronRule struct {
+	dom, month, dow              map[int]bool
+	domRestricted, dowRestricted bool
+}
+
+func (r *cronRule) Matches(day time.Time) bool {
+	if !r.month[int(day.Month())] {
+		return false
+	}
+	domMatch := r.dom[day.Day()]
+	dowMatch := r.dow[int(day.Weekday())]
+	// Standard cron semantics: when both day fields are restricted either may match
+	if r.domRestricted && r.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+func parseCron(expr string) (Rule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: expected 5 cron fields, got %d", ErrInvalidRecurrence, len(fields))
+	}
+
+	if _, err := parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if _, err := parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	dom, err := parseCronField(fields[2], 1, 31, nil)
+	if err != nil {
+		return nil, err
+	}
+	month, err := parseCronField(fields[3], 1, 12, monthNames)
+	if err != nil {
+		return nil, err
+	}
+	dowNames := make(map[string]int, len(weekdayNames))
+	for name, d := range weekdayNames {
+		dowNames[name] = int(d)
+	}
+	dow, err := parseCronField(fields[4], 0, 7, dowNames)
+	if err != nil {
+		return nil, err
+	}
+	if dow[7] {
+		dow[0] = true // 7 is an alias for Sunday
+	}
+
+	return &cronRule{
+		dom:           dom,
+		month:         month,
+		dow:           dow,
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+	}, nil
+}
+
+// parseCronField expands one cron field ("*", "1-5", "*/2", "mon,wed", ...)
+func parseCronField(field string, lo, hi int, names map[string]int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("%w: bad step in %q", ErrInvalidRecurrence, part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		start, end := lo, hi
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = parseCronValue(bounds[0], names); err != nil {
+				return nil, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = parseCronValue(bounds[1], names); err != nil {
+					return nil, err
+				}
+			} else if step > 1 {
+				end = hi
+			}
+		}
+		if start < lo || end > hi || start > end {
+			return nil, fmt.Errorf("%w: %q out of range %d-%d", ErrInvalidRecurrence, field, lo, hi)
+		}
+
+		for v := start; v <= end; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if v, ok := names[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: bad value %q", ErrInvalidRecurrence, s)
+	}
+	return v, nil
+}
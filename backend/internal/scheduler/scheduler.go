@@ -0,0 +1,138 @@
+package scheduler
+
+import (
+	"log"
+	"study-quest-backend/internal/repository"
+	"time"
+)
+
+// Scheduler materializes TaskLogs for recurring tasks. Every run is
+// idempotent: a (task, student, day) log is only created once, so running
+// it repeatedly or after a restart is safe.
+type Scheduler struct {
+	taskRepo   repository.ITaskRepository
+	userRepo   repository.IUserRepository
+	familyRepo repository.IFamilyRepository
+	interval   time.Duration
+	jobs       []job
+}
+
+// Job is periodic background work registered with AddJob
+type Job func(now time.Time) error
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      Job
+}
+
+func NewScheduler(taskRepo repository.ITaskRepository, userRepo repository.IUserRepository, familyRepo repository.IFamilyRepository, interval time.Duration) *Scheduler {
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	return &Scheduler{
+		taskRepo:   taskRepo,
+		userRepo:   userRepo,
+		familyRepo: familyRepo,
+		interval:   interval,
+	}
+}
+
+// AddJob registers extra work that Start runs every interval. It must be
+// called before Start.
+func (s *Scheduler) AddJob(name string, interval time.Duration, run Job) *Scheduler {
+	if interval <= 0 {
+		interval = s.interval
+	}
+	s.jobs = append(s.jobs, job{name: name, interval: interval, run: run})
+	return s
+}
+
+// Start runs the scheduler and every registered job immediately and then on
+// every tick in the background
+func (s *Scheduler) Start() {
+	go every(s.interval, func(now time.Time) {
+		if _, err := s.RunOnce(now); err != nil {
+			log.Printf("Scheduler run failed: %v", err)
+		}
+	})
+	for _, j := range s.jobs {
+		go every(j.interval, func(now time.Time) {
+			if err := j.run(now); err != nil {
+				log.Printf("Scheduler job %s failed: %v", j.name, err)
+			}
+		})
+	}
+}
+
+func every(interval time.Duration, fn func(now time.Time)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		fn(time.Now())
+		<-ticker.C
+	}
+}
+
+// RunOnce creates the missing TaskLogs for the day that now falls on in each
+// family's time zone and returns how many were created
+func (s *Scheduler) RunOnce(now time.Time) (int, error) {
+	tasks, err := s.taskRepo.GetRecurringTasks()
+	if err != nil {
+		return 0, err
+	}
+
+	locations := make(map[uint]*time.Location)
+	created := 0
+	for _, task := range tasks {
+		rule, err := ParseRule(task.Recurrence)
+		if err != nil {
+			log.Printf("Skipping task %d with bad recurrence %q: %v", task.ID, task.Recurrence, err)
+			continue
+		}
+		loc, ok := locations[task.FamilyID]
+		if !ok {
+			loc = s.familyLocation(task.FamilyID)
+			locations[task.FamilyID] = loc
+		}
+		day := now.In(loc)
+		if rule == nil || !rule.Matches(day) {
+			continue
+		}
+
+		students, err := s.userRepo.GetStudentsByFamily(task.FamilyID)
+		if err != nil {
+			return created, err
+		}
+		date := DateKey(day)
+		dueAt := DueAt(&task, date, loc)
+		for _, student := range students {
+			if !task.IsAssigned(student.ID) {
+				continue
+			}
+			ok, err := s.taskRepo.AssignTaskToStudent(student.ID, task.ID, date, dueAt)
+			if err != nil {
+				return created, err
+			}
+			if ok {
+				created++
+			}
+		}
+	}
+
+	if created > 0 {
+		log.Printf("Scheduler created %d task logs for %s", created, DateKey(now))
+	}
+	return created, nil
+}
+
+// familyLocation returns the family's time zone, or the server's when the
+// family cannot be loaded
+func (s *Scheduler) familyLocation(familyID uint) *time.Location {
+	family, err := s.familyRepo.GetFamily(familyID)
+	if err != nil {
+		log.Printf("Scheduling family %d in the server time zone: %v", familyID, err)
+		return time.Local
+	}
+	return family.Location()
+}
@@ -0,0 +1,58 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/password"
+	"study-quest-backend/internal/repository"
+)
+
+// RunOnce schedules each family's tasks on the family's own calendar day
+func TestRunOnceUsesFamilyTimezone(t *testing.T) {
+	auckland, err := time.LoadLocation("Pacific/Auckland")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	taskRepo := repository.NewMemoryTaskRepository()
+	userRepo := repository.NewMemoryUserRepository(password.NewHasher("", 4))
+	familyRepo := repository.NewMemoryFamilyRepository()
+	family, err := familyRepo.GetFamily(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	family.Timezone = "Pacific/Auckland"
+	if err := familyRepo.UpdateSettings(family); err != nil {
+		t.Fatal(err)
+	}
+	task := &model.Task{FamilyID: 1, Title: "Practice", Points: 5, Recurrence: "weekly:thu", DueTime: "19:00"}
+	if err := taskRepo.CreateTask(task); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wednesday 12:00 UTC is already Thursday 01:00 in Auckland
+	now := time.Date(2030, 1, 16, 12, 0, 0, 0, time.UTC)
+	if _, err := NewScheduler(taskRepo, userRepo, familyRepo, time.Minute).RunOnce(now); err != nil {
+		t.Fatal(err)
+	}
+	logs, err := taskRepo.GetLogsByStudent(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found *model.TaskLog
+	for i := range logs {
+		if logs[i].TaskID == task.ID {
+			found = &logs[i]
+		}
+	}
+	if found == nil {
+		t.Fatal("no log was created for the Auckland Thursday")
+	}
+	if found.OccurrenceDate != "2030-01-17" {
+		t.Errorf("OccurrenceDate = %s, want 2030-01-17", found.OccurrenceDate)
+	}
+	if want := time.Date(2030, 1, 17, 19, 0, 0, 0, auckland); found.DueAt == nil || !found.DueAt.Equal(want) {
+		t.Errorf("DueAt = %v, want %v", found.DueAt, want)
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"log"
+	"study-quest-backend/internal/model"
+	"time"
+)
+
+// BadgeProgress is a badge of the catalog as seen by one student
+type BadgeProgress struct {
+	model.Badge
+	Unlocked   bool       `json:"unlocked"`
+	UnlockedAt *time.Time `json:"unlocked_at,omitempty"`
+	Progress   int        `json:"progress"` // towards Target, at most Target
+}
+
+// badgeStats holds what the badge rules count for one student
+type badgeStats struct {
+	student     *model.User
+	logs        []model.TaskLog
+	redemptions int
+	streak      *StreakSummary
+	today       time.Time // midnight in the family's time zone
+}
+
+func (s *TaskService) loadBadgeStats(studentID uint) (*badgeStats, error) {
+	student, err := s.userRepo.GetUser(studentID)
+	if err != nil {
+		return nil, err
+	}
+	family, err := s.familyRepo.GetFamily(student.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := s.taskRepo.GetLogsByStudent(studentID)
+	if err != nil {
+		return nil, err
+	}
+	redemptions, err := s.redemptionRepo.GetRedemptionsByStudent(studentID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().In(family.Location())
+	stats := &badgeStats{
+		student: student,
+		logs:    logs,
+		streak:  computeStreaks(family, logs, now),
+		today:   time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()),
+	}
+	for _, redemption := range redemptions {
+		if !redemption.IsRefunded() {
+			stats.redemptions++
+		}
+	}
+	return stats, nil
+}
+
+// count returns what badge's rule has counted so far; unknown rules count
+// nothing and never unlock
+func (st *badgeStats) count(badge *model.Badge) int {
+	switch badge.Rule {
+	case model.BadgeRuleTasksApproved:
+		var since time.Time
+		if badge.WindowDays > 0 {
+			since = st.today.AddDate(0, 0, 1-badge.WindowDays)
+		}
+		count := 0
+		for _, taskLog := range st.logs {
+			if taskLog.Status != model.TaskStatusDone {
+				continue
+			}
+			if badge.TaskType != 0 && taskLog.Task.Type != badge.TaskType {
+				continue
+			}
+			if badge.Subject != "" && taskLog.Task.Subject != badge.Subject {
+				continue
+			}
+			if badge.WindowDays > 0 && (taskLog.ApprovedAt == nil || taskLog.ApprovedAt.Before(since)) {
+				continue
+			}
+			count++
+		}
+		return count
+	case model.BadgeRulePointsBalance:
+		return st.student.Points
+	case model.BadgeRuleLifetimePoints:
+		return st.student.TotalPointsEarned
+	case model.BadgeRuleRedemptions:
+		return st.redemptions
+	case model.BadgeRuleStreakDays:
+		return st.streak.Longest
+	}
+	return 0
+}
+
+// GetBadges lists the whole catalog for studentID as seen by actorID:
+// unlocked badges with their time, locked ones with the progress so far
+func (s *TaskService) GetBadges(actorID uint, studentID uint) ([]BadgeProgress, error) {
+	if _, err := s.AuthorizeStudent(actorID, studentID); err != nil {
+		return nil, err
+	}
+	badges, err := s.badgeRepo.GetBadges()
+	if err != nil {
+		return nil, err
+	}
+	unlocks, err := s.badgeRepo.GetUnlocksByStudent(studentID)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.loadBadgeStats(studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	unlockedAt := make(map[uint]time.Time, len(unlocks))
+	for _, unlock := range unlocks {
+		unlockedAt[unlock.BadgeID] = unlock.CreatedAt
+	}
+	result := make([]BadgeProgress, len(badges))
+	for i, badge := range badges {
+		progress := BadgeProgress{Badge: badge, Progress: stats.count(&badge)}
+		if at, ok := unlockedAt[badge.ID]; ok {
+			progress.Unlocked = true
+			progress.UnlockedAt = &at
+		}
+		// A windowed count can drop again after the badge was earned
+		if progress.Unlocked || progress.Progress > badge.Target {
+			progress.Progress = badge.Target
+		}
+		result[i] = progress
+	}
+	return result, nil
+}
+
+// evaluateBadges unlocks every badge whose target the student has reached,
+// crediting the unlock to the task log or redemption that triggered the
+// check. Badges the student already has are skipped, so running it again
+// changes nothing. It returns the newly unlocked badges.
+func (s *TaskService) evaluateBadges(studentID uint, sourceType string, sourceID uint) []model.Badge {
+	badges, err := s.badgeRepo.GetBadges()
+	if err != nil {
+		log.Printf("Error loading badges for student %d: %v", studentID, err)
+		return nil
+	}
+	stats, err := s.loadBadgeStats(studentID)
+	if err != nil {
+		log.Printf("Error loading badge stats of student %d: %v", studentID, err)
+		return nil
+	}
+
+	var unlocked []model.Badge
+	for _, badge := range badges {
+		if badge.Target <= 0 || stats.count(&badge) < badge.Target {
+			continue
+		}
+		created, err := s.badgeRepo.CreateUnlock(&model.BadgeUnlock{
+			StudentID:  studentID,
+			BadgeID:    badge.ID,
+			SourceType: sourceType,
+			SourceID:   sourceID,
+		})
+		if err != nil {
+			log.Printf("Error unlocking badge %s for student %d: %v", badge.Code, studentID, err)
+			continue
+		}
+		if created {
+			log.Printf("Student %d unlocked badge %s", studentID, badge.Code)
+			unlocked = append(unlocked, badge)
+		}
+	}
+	return unlocked
+}
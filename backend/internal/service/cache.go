@@ -0,0 +1,47 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// cachedList keeps the result of load in memory for ttl. It backs the
+// config and feature flag lookups done on every app start.
+type cachedList[T any] struct {
+	ttl  time.Duration
+	load func() ([]T, error)
+
+	mu       sync.Mutex
+	items    []T
+	loaded   bool
+	loadedAt time.Time
+}
+
+func newCachedList[T any](ttl time.Duration, load func() ([]T, error)) *cachedList[T] {
+	return &cachedList[T]{ttl: ttl, load: load}
+}
+
+func (c *cachedList[T]) Get() ([]T, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.loaded && time.Since(c.loadedAt) < c.ttl {
+		return c.items, nil
+	}
+
+	items, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	c.items = items
+	c.loaded = true
+	c.loadedAt = time.Now()
+	return items, nil
+}
+
+// Invalidate drops the cached items so the next Get loads them again
+func (c *cachedList[T]) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loaded = false
+	c.items = nil
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"study-quest-backend/internal/model"
+	"unicode/utf8"
+)
+
+const maxCommentLength = 500
+
+var (
+	ErrReasonRequired = errors.New("a reason is required when rejecting")
+	ErrInvalidComment = errors.New("invalid comment")
+)
+
+// GetTaskComments returns the conversation on a task log. The student it
+// belongs to and the parents of their family may read it.
+func (s *TaskService) GetTaskComments(actorID uint, logID uint) ([]model.TaskComment, error) {
+	if _, err := s.authorizeThread(actorID, logID); err != nil {
+		return nil, err
+	}
+	return s.taskRepo.GetComments(logID)
+}
+
+// AddTaskComment appends a message to the conversation on a task log
+func (s *TaskService) AddTaskComment(actorID uint, logID uint, content string) (*model.TaskComment, error) {
+	content = strings.TrimSpace(content)
+	if err := validateComment(content); err != nil {
+		return nil, err
+	}
+	taskLog, err := s.authorizeThread(actorID, logID)
+	if err != nil {
+		return nil, err
+	}
+	actor, err := s.userRepo.GetUser(actorID)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := &model.TaskComment{
+		LogID:      logID,
+		AuthorID:   actorID,
+		AuthorRole: actor.Role,
+		Kind:       model.TaskCommentMessage,
+		Attempt:    taskLog.Attempts,
+		Content:    content,
+	}
+	if err := s.taskRepo.CreateComment(comment); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (s *TaskService) authorizeThread(actorID uint, logID uint) (*model.TaskLog, error) {
+	taskLog, err := s.taskRepo.GetTaskLog(logID)
+	if err != nil {
+		return nil, err
+	}
+	student, err := s.AuthorizeStudent(actorID, taskLog.StudentID)
+	if err != nil {
+		return nil, err
+	}
+	if taskLog.Task.FamilyID != student.FamilyID {
+		// The student has left the family the task belongs to
+		return nil, ErrPermissionDenied
+	}
+	return taskLog, nil
+}
+
+func validateComment(content string) error {
+	if content == "" {
+		return fmt.Errorf("%w: content is required", ErrInvalidComment)
+	}
+	if utf8.RuneCountInString(content) > maxCommentLength {
+		return fmt.Errorf("%w: at most %d characters", ErrInvalidComment, maxCommentLength)
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+	"time"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// defaultAppConfig is returned for keys that have no matching app_configs row
+var defaultAppConfig = map[string]interface{}{
+	"review_mode": false,
+	"theme":       "default",
+}
+
+var configPlatforms = map[string]bool{
+	model.ConfigPlatformAll: true,
+	"ios":                   true,
+	"android":               true,
+}
+
+// ClientInfo describes the app asking for its config, taken from the
+// X-Platform and X-App-Version headers
+type ClientInfo struct {
+	Platform string
+	Version  string
+}
+
+// ConfigService resolves the dynamic app config. Rows are cached in-process
+// for the configured TTL; edits through the service invalidate the cache
+// right away.
+type ConfigService struct {
+	configRepo repository.IAppConfigRepository
+	cache      *cachedList[model.AppConfig]
+}
+
+func NewConfigService(configRepo repository.IAppConfigRepository, ttl time.Duration) *ConfigService {
+	return &ConfigService{
+		configRepo: configRepo,
+		cache:      newCachedList(ttl, configRepo.GetAllConfigs),
+	}
+}
+
+// Resolve returns the config values for client. For every key the most
+// specific matching row wins: a row for the client's platform beats one for
+// all platforms, and a higher min_version beats a lower one.
+func (s *ConfigService) Resolve(client ClientInfo) (map[string]interface{}, error) {
+	configs, err := s.cache.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	platform := strings.ToLower(strings.TrimSpace(client.Platform))
+	best := make(map[string]model.AppConfig)
+	for _, config := range configs {
+		if config.Platform != model.ConfigPlatformAll && config.Platform != platform {
+			continue
+		}
+		if config.MinVersion != "" && (client.Version == "" || compareVersions(client.Version, config.MinVersion) < 0) {
+			continue
+		}
+		if current, ok := best[config.Key]; !ok || moreSpecific(config, current) {
+			best[config.Key] = config
+		}
+	}
+
+	result := make(map[string]interface{}, len(defaultAppConfig)+len(best))
+	for key, value := range defaultAppConfig {
+		result[key] = value
+	}
+	for key, config := range best {
+		var value interface{}
+		if err := json.Unmarshal([]byte(config.Value), &value); err != nil {
+			// Rows edited by hand may hold a bare string
+			value = config.Value
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+func (s *ConfigService) ListConfigs() ([]model.AppConfig, error) {
+	return s.configRepo.GetAllConfigs()
+}
+
+// SaveConfig creates or updates the row for the key, platform and min
+// version of config
+func (s *ConfigService) SaveConfig(config *model.AppConfig) error {
+	config.Key = strings.TrimSpace(config.Key)
+	config.Platform = strings.ToLower(strings.TrimSpace(config.Platform))
+	config.MinVersion = strings.TrimSpace(config.MinVersion)
+	if config.Platform == "" {
+		config.Platform = model.ConfigPlatformAll
+	}
+
+	if config.Key == "" || len(config.Key) > 64 {
+		return fmt.Errorf("%w: key must be 1-64 characters", ErrInvalidConfig)
+	}
+	if !configPlatforms[config.Platform] {
+		return fmt.Errorf("%w: platform must be all, ios or android", ErrInvalidConfig)
+	}
+	if config.MinVersion != "" {
+		if _, _, err := parseVersion(config.MinVersion); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+		}
+	}
+	if !json.Valid([]byte(config.Value)) {
+		return fmt.Errorf("%w: value must be JSON", ErrInvalidConfig)
+	}
+
+	if err := s.configRepo.SaveConfig(config); err != nil {
+		return err
+	}
+	s.Invalidate()
+	return nil
+}
+
+func (s *ConfigService) DeleteConfig(id uint) error {
+	if err := s.configRepo.DeleteConfig(id); err != nil {
+		return err
+	}
+	s.Invalidate()
+	return nil
+}
+
+// Invalidate drops the cached rows so the next Resolve reads them again
+func (s *ConfigService) Invalidate() {
+	s.cache.Invalidate()
+}
+
+func moreSpecific(a, b model.AppConfig) bool {
+	if (a.Platform != model.ConfigPlatformAll) != (b.Platform != model.ConfigPlatformAll) {
+		return a.Platform != model.ConfigPlatformAll
+	}
+	if a.MinVersion == "" || b.MinVersion == "" {
+		return b.MinVersion == "" && a.MinVersion != ""
+	}
+	return compareVersions(a.MinVersion, b.MinVersion) > 0
+}
+
+// compareVersions compares two semantic versions and returns -1, 0 or 1.
+// Unparsable versions sort before everything else.
+func compareVersions(a, b string) int {
+	aNums, aPre, aErr := parseVersion(a)
+	bNums, bPre, bErr := parseVersion(b)
+	switch {
+	case aErr != nil && bErr != nil:
+		return 0
+	case aErr != nil:
+		return -1
+	case bErr != nil:
+		return 1
+	}
+
+	for i := 0; i < 3; i++ {
+		if aNums[i] != bNums[i] {
+			if aNums[i] < bNums[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	// A pre-release sorts before the release it precedes (1.2.0-beta < 1.2.0)
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	case aPre < bPre:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// parseVersion accepts "1", "1.2", "1.2.3" with an optional "v" prefix,
+// "-prerelease" and "+build" suffix
+func parseVersion(v string) ([3]int, string, error) {
+	var nums [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.Index(v, "+"); i >= 0 {
+		v = v[:i]
+	}
+	pre := ""
+	if i := strings.Index(v, "-"); i >= 0 {
+		v, pre = v[:i], v[i+1:]
+	}
+
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return nums, "", fmt.Errorf("invalid version %q", v)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nums, "", fmt.Errorf("invalid version %q", v)
+		}
+		nums[i] = n
+	}
+	return nums, pre, nil
+}
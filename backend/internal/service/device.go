@@ -0,0 +1,506 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"study-quest-backend/internal/events"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/mqtt"
+	"study-quest-backend/internal/repository"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidDevice = errors.New("invalid device")
+	// ErrDeviceControlDisabled is returned when commands are requested but no
+	// MQTT broker is configured
+	ErrDeviceControlDisabled = errors.New("device control is not configured")
+)
+
+const (
+	maxDevicesPerFamily = 20
+	maxDeviceNameLength = 64
+	maxDeviceTopicLen   = 255
+	maxDeviceError      = 500
+	// DefaultDeviceTopicTemplate is used when mqtt.topic_template is empty
+	DefaultDeviceTopicTemplate = "studyquest/{family_id}/devices/{device_id}/control"
+)
+
+// Device command payload formats
+const (
+	DevicePayloadJSON  = "json"
+	DevicePayloadPlain = "plain" // just "ON" or "OFF"
+)
+
+// DevicePublisher sends a message to an MQTT topic; *mqtt.Client is one
+type DevicePublisher interface {
+	Publish(topic string, qos byte, retain bool, payload []byte) error
+}
+
+// DeviceInput carries the editable device fields; nil fields are left
+// unchanged on update
+type DeviceInput struct {
+	Name *string `json:"name"`
+	// StudentID is the child the device follows; 0 follows every child
+	StudentID *uint `json:"student_id"`
+	// Topic overrides the configured topic template; "" restores it. It
+	// must stay under the family's own prefix (see FamilyTopicPrefix).
+	Topic   *string `json:"topic"`
+	Enabled *bool   `json:"enabled"`
+}
+
+// DeviceCommand is the JSON payload sent to a device's topic
+type DeviceCommand struct {
+	Command  string `json:"command"` // 'on' or 'off'
+	DeviceID uint   `json:"device_id"`
+	// Reason is the screen_time.* event type that caused the command, or
+	// 'sync' (device registered or changed), 'test' and 'retry'
+	Reason           string    `json:"reason"`
+	StudentID        uint      `json:"student_id,omitempty"`
+	SessionID        uint      `json:"session_id,omitempty"`
+	RemainingSeconds int       `json:"remaining_seconds,omitempty"`
+	SentAt           time.Time `json:"sent_at"`
+}
+
+// DeviceOptions configures how commands are published
+type DeviceOptions struct {
+	// TopicTemplate may use {family_id}, {device_id} and {student_id}
+	TopicTemplate string
+	QoS           byte
+	// Retain lets a device that reconnects pick up its latest command
+	Retain bool
+	Format string // DevicePayloadJSON or DevicePayloadPlain
+}
+
+// DeviceService manages the devices families register and switches them
+// with the screen time sessions: a device is turned on while a child it
+// follows has a running session and off otherwise. Commands are sent over
+// MQTT by a single worker so that a slow broker never holds up a request;
+// failed commands are retried by a scheduler job.
+type DeviceService struct {
+	deviceRepo     repository.IDeviceRepository
+	userRepo       repository.IUserRepository
+	screenTimeRepo repository.IScreenTimeRepository
+	publisher      DevicePublisher
+	opts           DeviceOptions
+
+	mu      sync.Mutex
+	pending map[pendingKey]events.Event // latest event per student
+	wake    chan struct{}
+}
+
+type pendingKey struct {
+	familyID  uint
+	studentID uint
+}
+
+// NewDeviceService sends commands with publisher; with a nil publisher
+// devices can still be registered but are never switched
+func NewDeviceService(deviceRepo repository.IDeviceRepository, userRepo repository.IUserRepository, screenTimeRepo repository.IScreenTimeRepository, publisher DevicePublisher, opts DeviceOptions) *DeviceService {
+	if opts.TopicTemplate == "" {
+		opts.TopicTemplate = DefaultDeviceTopicTemplate
+	}
+	if opts.Format != DevicePayloadPlain {
+		opts.Format = DevicePayloadJSON
+	}
+	return &DeviceService{
+		deviceRepo:     deviceRepo,
+		userRepo:       userRepo,
+		screenTimeRepo: screenTimeRepo,
+		publisher:      publisher,
+		opts:           opts,
+		pending:        make(map[pendingKey]events.Event),
+		wake:           make(chan struct{}, 1),
+	}
+}
+
+// ControlEnabled reports whether commands are sent at all, i.e. whether an
+// MQTT broker is configured
+func (s *DeviceService) ControlEnabled() bool {
+	return s.publisher != nil
+}
+
+// ListDevices returns the devices of the parent's family
+func (s *DeviceService) ListDevices(parentID uint) ([]model.Device, error) {
+	parent, err := s.requireParent(parentID)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.deviceRepo.GetDevicesByFamily(parent.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range devices {
+		devices[i].ControlTopic = s.topic(&devices[i])
+	}
+	return devices, nil
+}
+
+// CreateDevice registers an enabled device. It is switched on the next time
+// a screen time session of a child it follows starts or stops.
+func (s *DeviceService) CreateDevice(parentID uint, input DeviceInput) (*model.Device, error) {
+	parent, err := s.requireParent(parentID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.deviceRepo.GetDevicesByFamily(parent.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxDevicesPerFamily {
+		return nil, fmt.Errorf("%w: a family can have at most %d devices", ErrInvalidDevice, maxDevicesPerFamily)
+	}
+
+	device := &model.Device{FamilyID: parent.FamilyID, Enabled: true}
+	if err := s.applyDeviceInput(device, input); err != nil {
+		return nil, err
+	}
+	if device.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidDevice)
+	}
+	if err := s.deviceRepo.CreateDevice(device); err != nil {
+		return nil, err
+	}
+	s.sync(device)
+	device.ControlTopic = s.topic(device)
+	return device, nil
+}
+
+func (s *DeviceService) UpdateDevice(parentID uint, deviceID uint, input DeviceInput) (*model.Device, error) {
+	device, err := s.ownedDevice(parentID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	wasEnabled := device.Enabled
+	if err := s.applyDeviceInput(device, input); err != nil {
+		return nil, err
+	}
+	if err := s.deviceRepo.UpdateDevice(device); err != nil {
+		return nil, err
+	}
+	if wasEnabled && !device.Enabled {
+		s.switchOff(device, "disabled")
+	}
+	s.sync(device)
+	device.ControlTopic = s.topic(device)
+	return device, nil
+}
+
+func (s *DeviceService) DeleteDevice(parentID uint, deviceID uint) error {
+	device, err := s.ownedDevice(parentID, deviceID)
+	if err != nil {
+		return err
+	}
+	if device.Enabled {
+		s.switchOff(device, "deleted")
+	}
+	return s.deviceRepo.DeleteDevice(deviceID)
+}
+
+// switchOff sends 'off' right away to a device that stops being controlled,
+// so that it is not left on by its last command
+func (s *DeviceService) switchOff(device *model.Device, reason string) {
+	if s.publisher == nil {
+		return
+	}
+	s.send(device, DeviceCommand{Command: model.DeviceCommandOff, Reason: reason})
+}
+
+// TestDevice sends command ('on' or 'off') right away, even to a disabled
+// device, and returns the device with the outcome recorded. The next screen
+// time change, or the retry of a failed test, sends the real state again.
+func (s *DeviceService) TestDevice(parentID uint, deviceID uint, command string) (*model.Device, error) {
+	if command != model.DeviceCommandOn && command != model.DeviceCommandOff {
+		return nil, fmt.Errorf("%w: command must be on or off", ErrInvalidDevice)
+	}
+	device, err := s.ownedDevice(parentID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if s.publisher == nil {
+		return nil, ErrDeviceControlDisabled
+	}
+	s.send(device, DeviceCommand{Command: command, Reason: "test"})
+	device.ControlTopic = s.topic(device)
+	return device, nil
+}
+
+// Notify queues the devices of a screen_time.* event's family for an
+// update. It is registered as a bus listener and never blocks.
+func (s *DeviceService) Notify(event events.Event) {
+	if event.Type != events.ScreenTimeStarted && event.Type != events.ScreenTimeEnded {
+		return
+	}
+	s.enqueue(event)
+}
+
+// sync queues a device that was just registered or changed so that it is
+// told the current state
+func (s *DeviceService) sync(device *model.Device) {
+	if device.Enabled {
+		s.enqueue(events.Event{Type: "sync", FamilyID: device.FamilyID, StudentID: device.StudentID})
+	}
+}
+
+func (s *DeviceService) enqueue(event events.Event) {
+	if s.publisher == nil {
+		return
+	}
+	s.mu.Lock()
+	s.pending[pendingKey{event.FamilyID, event.StudentID}] = event
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default: // the worker is already due to run
+	}
+}
+
+// Run sends the queued commands; it is started once in its own goroutine
+// and runs for the life of the process
+func (s *DeviceService) Run() {
+	for range s.wake {
+		s.mu.Lock()
+		queued := make([]events.Event, 0, len(s.pending))
+		for _, event := range s.pending {
+			queued = append(queued, event)
+		}
+		s.pending = make(map[pendingKey]events.Event)
+		s.mu.Unlock()
+
+		sort.Slice(queued, func(i, j int) bool { return queued[i].ID < queued[j].ID })
+		for _, event := range queued {
+			if err := s.apply(event); err != nil {
+				log.Printf("Error switching devices of family %d: %v", event.FamilyID, err)
+			}
+		}
+	}
+}
+
+// RetryFailed sends the current command again to every enabled device
+// whose last command failed. It is run periodically by the scheduler.
+func (s *DeviceService) RetryFailed(now time.Time) error {
+	if s.publisher == nil {
+		return nil
+	}
+	devices, err := s.deviceRepo.GetFailedDevices()
+	if err != nil {
+		return err
+	}
+	running := make(map[uint]map[uint]bool)
+	for i := range devices {
+		device := &devices[i]
+		if _, ok := running[device.FamilyID]; !ok {
+			if running[device.FamilyID], err = s.runningStudents(device.FamilyID); err != nil {
+				return err
+			}
+		}
+		s.send(device, DeviceCommand{
+			Command: commandFor(device, running[device.FamilyID]),
+			Reason:  "retry",
+		})
+	}
+	return nil
+}
+
+// apply switches the devices that follow the event's student (for a sync
+// of a family-wide device, the devices that follow every child)
+func (s *DeviceService) apply(event events.Event) error {
+	devices, err := s.deviceRepo.GetDevicesByFamily(event.FamilyID)
+	if err != nil {
+		return err
+	}
+	running, err := s.runningStudents(event.FamilyID)
+	if err != nil {
+		return err
+	}
+	data, _ := event.Data.(ScreenTimeEvent)
+	for i := range devices {
+		device := &devices[i]
+		if !device.Enabled || (device.StudentID != 0 && device.StudentID != event.StudentID) {
+			continue
+		}
+		s.send(device, DeviceCommand{
+			Command:          commandFor(device, running),
+			Reason:           event.Type,
+			StudentID:        event.StudentID,
+			SessionID:        data.SessionID,
+			RemainingSeconds: data.RemainingSeconds,
+		})
+	}
+	return nil
+}
+
+// runningStudents returns the students of the family whose screen time
+// clock is running
+func (s *DeviceService) runningStudents(familyID uint) (map[uint]bool, error) {
+	sessions, err := s.screenTimeRepo.GetOpenSessionsByFamily(familyID)
+	if err != nil {
+		return nil, err
+	}
+	running := make(map[uint]bool)
+	for _, session := range sessions {
+		if session.Status == model.ScreenTimeActive {
+			running[session.StudentID] = true
+		}
+	}
+	return running, nil
+}
+
+// commandFor is 'on' while a student the device follows has a running
+// session
+func commandFor(device *model.Device, running map[uint]bool) string {
+	if (device.StudentID == 0 && len(running) > 0) || running[device.StudentID] {
+		return model.DeviceCommandOn
+	}
+	return model.DeviceCommandOff
+}
+
+// send publishes the command to the device and records the outcome; a
+// failed device is retried by RetryFailed
+func (s *DeviceService) send(device *model.Device, command DeviceCommand) {
+	now := time.Now()
+	command.DeviceID = device.ID
+	command.SentAt = now
+
+	var payload []byte
+	if s.opts.Format == DevicePayloadPlain {
+		payload = []byte(strings.ToUpper(command.Command))
+	} else {
+		payload, _ = json.Marshal(command)
+	}
+	var err error
+	if device.Topic != "" && !s.ownTopic(device.FamilyID, device.Topic) {
+		// Saved before the prefix rule or under another topic template
+		err = fmt.Errorf("topic %q is outside the family's prefix", device.Topic)
+	} else {
+		err = s.publisher.Publish(s.topic(device), s.opts.QoS, s.opts.Retain, payload)
+	}
+
+	device.LastError = ""
+	if err != nil {
+		log.Printf("Error sending %q to device %d: %v", command.Command, device.ID, err)
+		device.LastError = err.Error()
+		if len(device.LastError) > maxDeviceError {
+			device.LastError = device.LastError[:maxDeviceError]
+		}
+	} else {
+		device.LastCommand = command.Command
+		device.LastCommandAt = &now
+	}
+	if err := s.deviceRepo.UpdateDeviceState(device); err != nil {
+		log.Printf("Error saving state of device %d: %v", device.ID, err)
+	}
+}
+
+// topic returns the device's own topic or the configured template filled
+// in for it
+func (s *DeviceService) topic(device *model.Device) string {
+	if device.Topic != "" {
+		return device.Topic
+	}
+	return strings.NewReplacer(
+		"{family_id}", strconv.FormatUint(uint64(device.FamilyID), 10),
+		"{device_id}", strconv.FormatUint(uint64(device.ID), 10),
+		"{student_id}", strconv.FormatUint(uint64(device.StudentID), 10),
+	).Replace(s.opts.TopicTemplate)
+}
+
+// FamilyTopicPrefix returns the part of the topic template up to and
+// including the {family_id} level, filled in for the family. Custom topics
+// must start with it so that a family can only reach its own devices; it is
+// not available when the template has no {family_id} level of its own.
+func (s *DeviceService) FamilyTopicPrefix(familyID uint) (string, bool) {
+	const placeholder = "{family_id}"
+	template := s.opts.TopicTemplate
+	i := strings.Index(template, placeholder)
+	if i < 0 {
+		return "", false
+	}
+	end := i + len(placeholder)
+	if (i > 0 && template[i-1] != '/') || end >= len(template) || template[end] != '/' {
+		return "", false
+	}
+	prefix := template[:end+1]
+	if strings.ContainsAny(prefix[:i], "{}") {
+		// Another placeholder before the family level
+		return "", false
+	}
+	return prefix[:i] + strconv.FormatUint(uint64(familyID), 10) + "/", true
+}
+
+// ownTopic reports whether a custom topic lies under the family's prefix
+func (s *DeviceService) ownTopic(familyID uint, topic string) bool {
+	prefix, ok := s.FamilyTopicPrefix(familyID)
+	return ok && len(topic) > len(prefix) && strings.HasPrefix(topic, prefix)
+}
+
+func (s *DeviceService) applyDeviceInput(device *model.Device, input DeviceInput) error {
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if len([]rune(name)) > maxDeviceNameLength {
+			return fmt.Errorf("%w: name is longer than %d characters", ErrInvalidDevice, maxDeviceNameLength)
+		}
+		device.Name = name
+	}
+	if input.StudentID != nil && *input.StudentID != 0 {
+		student, err := s.userRepo.GetUser(*input.StudentID)
+		if err != nil || student.Role != "student" || student.FamilyID != device.FamilyID {
+			return fmt.Errorf("%w: student_id is not a child of this family", ErrInvalidDevice)
+		}
+		device.StudentID = student.ID
+	} else if input.StudentID != nil {
+		device.StudentID = 0
+	}
+	if input.Topic != nil {
+		topic := strings.TrimSpace(*input.Topic)
+		if topic != "" && (!mqtt.ValidTopic(topic) || len(topic) > maxDeviceTopicLen) {
+			return fmt.Errorf("%w: topic must be at most %d characters without wildcards", ErrInvalidDevice, maxDeviceTopicLen)
+		}
+		if topic != "" && !s.ownTopic(device.FamilyID, topic) {
+			prefix, ok := s.FamilyTopicPrefix(device.FamilyID)
+			if !ok {
+				return fmt.Errorf("%w: custom topics are not allowed by this server", ErrInvalidDevice)
+			}
+			return fmt.Errorf("%w: topic must start with %s", ErrInvalidDevice, prefix)
+		}
+		device.Topic = topic
+	}
+	if input.Enabled != nil {
+		device.Enabled = *input.Enabled
+	}
+	return nil
+}
+
+func (s *DeviceService) requireParent(userID uint) (*model.User, error) {
+	user, err := s.userRepo.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != "parent" {
+		return nil, ErrPermissionDenied
+	}
+	return user, nil
+}
+
+// ownedDevice returns a device of the parent's family; other families'
+// devices are reported as not found
+func (s *DeviceService) ownedDevice(parentID uint, deviceID uint) (*model.Device, error) {
+	parent, err := s.requireParent(parentID)
+	if err != nil {
+		return nil, err
+	}
+	device, err := s.deviceRepo.GetDevice(deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device.FamilyID != parent.FamilyID {
+		return nil, repository.ErrDeviceNotFound
+	}
+	return device, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"study-quest-backend/internal/events"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/password"
+	"study-quest-backend/internal/repository"
+)
+
+// fakePublisher records the commands sent; the first publish waits for
+// release so that events pile up behind it
+type fakePublisher struct {
+	mu       sync.Mutex
+	messages []publishedCommand
+	started  chan struct{}
+	release  chan struct{}
+}
+
+type publishedCommand struct {
+	Topic   string
+	Command DeviceCommand
+}
+
+func (p *fakePublisher) Publish(topic string, qos byte, retain bool, payload []byte) error {
+	var command DeviceCommand
+	if err := json.Unmarshal(payload, &command); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.messages = append(p.messages, publishedCommand{topic, command})
+	first := len(p.messages) == 1
+	p.mu.Unlock()
+	if first {
+		close(p.started)
+		<-p.release
+	}
+	return nil
+}
+
+func newTestDeviceService(t *testing.T, publisher DevicePublisher, opts DeviceOptions) (*DeviceService, *repository.MemoryDeviceRepository) {
+	t.Helper()
+	userRepo := repository.NewMemoryUserRepository(password.NewHasher("", 4))
+	redemptionRepo := repository.NewMemoryRedemptionRepository(userRepo)
+	screenTimeRepo := repository.NewMemoryScreenTimeRepository(userRepo, redemptionRepo)
+	deviceRepo := repository.NewMemoryDeviceRepository()
+	return NewDeviceService(deviceRepo, userRepo, screenTimeRepo, publisher, opts), deviceRepo
+}
+
+func TestDeviceRunCoalescesQueuedEvents(t *testing.T) {
+	publisher := &fakePublisher{started: make(chan struct{}), release: make(chan struct{})}
+	service, deviceRepo := newTestDeviceService(t, publisher, DeviceOptions{})
+	for _, device := range []*model.Device{
+		{FamilyID: 1, StudentID: 1, Name: "tv", Enabled: true},
+		{FamilyID: 2, StudentID: 9, Name: "plug", Enabled: true},
+	} {
+		if err := deviceRepo.CreateDevice(device); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		service.Run()
+		close(done)
+	}()
+
+	service.Notify(events.Event{ID: 1, Type: events.ScreenTimeStarted, FamilyID: 1, StudentID: 1})
+	select {
+	case <-publisher.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the first event was not sent")
+	}
+
+	// While the worker is busy, later events of the same student replace
+	// each other; other students keep their own entry
+	service.Notify(events.Event{ID: 2, Type: events.ScreenTimeEnded, FamilyID: 1, StudentID: 1})
+	service.Notify(events.Event{ID: 3, Type: events.ScreenTimeStarted, FamilyID: 2, StudentID: 9})
+	service.Notify(events.Event{ID: 4, Type: events.ScreenTimeStarted, FamilyID: 1, StudentID: 1})
+	service.Notify(events.Event{ID: 5, Type: events.ScreenTimeEnded, FamilyID: 1, StudentID: 1})
+	service.Notify(events.Event{ID: 6, Type: events.TaskApproved, FamilyID: 1, StudentID: 1})
+
+	service.mu.Lock()
+	queued := len(service.pending)
+	latest := service.pending[pendingKey{1, 1}].ID
+	service.mu.Unlock()
+	if queued != 2 || latest != 5 {
+		t.Fatalf("pending = %d entries with event %d for student 1, want 2 entries with event 5", queued, latest)
+	}
+
+	close(publisher.release)
+	// The wake-up left by the queued events makes the worker run once more;
+	// closing the channel then ends Run after that batch
+	waitFor(t, func() bool {
+		publisher.mu.Lock()
+		defer publisher.mu.Unlock()
+		return len(publisher.messages) >= 3
+	})
+	close(service.wake)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+
+	want := []publishedCommand{
+		{"studyquest/1/devices/1/control", DeviceCommand{Command: model.DeviceCommandOff, Reason: events.ScreenTimeStarted, StudentID: 1}},
+		// sorted by event id
+		{"studyquest/2/devices/2/control", DeviceCommand{Command: model.DeviceCommandOff, Reason: events.ScreenTimeStarted, StudentID: 9}},
+		{"studyquest/1/devices/1/control", DeviceCommand{Command: model.DeviceCommandOff, Reason: events.ScreenTimeEnded, StudentID: 1}},
+	}
+	if len(publisher.messages) != len(want) {
+		t.Fatalf("sent %d commands, want %d: %+v", len(publisher.messages), len(want), publisher.messages)
+	}
+	for i, got := range publisher.messages {
+		got.Command.DeviceID, got.Command.SentAt = 0, time.Time{}
+		if got != want[i] {
+			t.Errorf("command %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestFamilyTopicPrefix(t *testing.T) {
+	tests := []struct {
+		template string
+		prefix   string
+		ok       bool
+	}{
+		{"", "studyquest/7/", true},
+		{"home/{family_id}/tv", "home/7/", true},
+		{"{family_id}/{device_id}", "7/", true},
+		{"home/{device_id}/{family_id}/x", "", false},
+		{"home/f{family_id}/x", "", false},
+		{"home/{family_id}", "", false},
+		{"home/{device_id}/control", "", false},
+	}
+	for _, tt := range tests {
+		service, _ := newTestDeviceService(t, nil, DeviceOptions{TopicTemplate: tt.template})
+		prefix, ok := service.FamilyTopicPrefix(7)
+		if prefix != tt.prefix || ok != tt.ok {
+			t.Errorf("FamilyTopicPrefix(%q) = %q, %v, want %q, %v", tt.template, prefix, ok, tt.prefix, tt.ok)
+		}
+	}
+
+	service, _ := newTestDeviceService(t, nil, DeviceOptions{})
+	for topic, want := range map[string]bool{
+		"studyquest/7/tv/control":        true,
+		"studyquest/7/":                  false,
+		"studyquest/70/tv/control":       false,
+		"studyquest/8/devices/1/control": false,
+		"other/7/tv":                     false,
+	} {
+		if got := service.ownTopic(7, topic); got != want {
+			t.Errorf("ownTopic(7, %q) = %v, want %v", topic, got, want)
+		}
+	}
+}
+
+func waitFor(t *testing.T, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
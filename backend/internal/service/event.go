@@ -0,0 +1,66 @@
+package service
+
+import (
+	"log"
+	"study-quest-backend/internal/events"
+	"study-quest-backend/internal/model"
+)
+
+// TaskEvent is the data of the task.* events. Points are the task's points,
+// or the points actually awarded once approved.
+type TaskEvent struct {
+	LogID   uint           `json:"log_id"`
+	TaskID  uint           `json:"task_id"`
+	Title   string         `json:"title"`
+	Points  int            `json:"points"`
+	Reason  string         `json:"reason,omitempty"` // task.rejected
+	LevelUp *model.LevelUp `json:"level_up,omitempty"`
+	Badges  []model.Badge  `json:"badges,omitempty"`
+}
+
+// RedemptionEvent is the data of the reward.redeemed and
+// redemption.updated events
+type RedemptionEvent struct {
+	RedemptionID uint          `json:"redemption_id"`
+	RewardID     uint          `json:"reward_id"`
+	Title        string        `json:"title"`
+	Cost         int           `json:"cost"`
+	Status       string        `json:"status"`
+	Note         string        `json:"note,omitempty"` // reason of a rejection or cancellation
+	Badges       []model.Badge `json:"badges,omitempty"`
+}
+
+// PointsEvent is the data of a points.changed event
+type PointsEvent struct {
+	Points            int `json:"points"`
+	TotalPointsEarned int `json:"total_points_earned"`
+}
+
+// ScreenTimeEvent is the data of the screen_time.* events. Status is the
+// session's new status; RemainingSeconds is the balance left at that moment.
+type ScreenTimeEvent struct {
+	SessionID        uint   `json:"session_id"`
+	Status           string `json:"status"`
+	RemainingSeconds int    `json:"remaining_seconds"`
+}
+
+// publish sends an event about studentID to the family's live streams
+func (s *TaskService) publish(eventType string, familyID uint, studentID uint, data interface{}) {
+	s.bus.Publish(events.Event{Type: eventType, FamilyID: familyID, StudentID: studentID, Data: data})
+}
+
+// publishPoints tells the family that the student's balance changed
+func (s *TaskService) publishPoints(studentID uint) {
+	if s.bus == nil {
+		return
+	}
+	student, err := s.userRepo.GetUser(studentID)
+	if err != nil {
+		log.Printf("Error loading student %d for points event: %v", studentID, err)
+		return
+	}
+	s.publish(events.PointsChanged, student.FamilyID, studentID, PointsEvent{
+		Points:            student.Points,
+		TotalPointsEarned: student.TotalPointsEarned,
+	})
+}
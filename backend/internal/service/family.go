@@ -0,0 +1,331 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/scheduler"
+	"time"
+)
+
+const (
+	defaultInviteTTL = 72 * time.Hour
+	maxInviteTTL     = 30 * 24 * time.Hour
+	inviteCodeLength = 8
+	maxAwardPercent  = 500
+	maxMissedPenalty = 1000
+	maxMilestones    = 10
+	maxStreakDays    = 365
+	maxStreakBonus   = 1000
+	// No 0/O/1/I so codes can be read aloud and typed by kids
+	inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+// FamilyService manages families, invite codes and membership
+type FamilyService struct {
+	familyRepo repository.IFamilyRepository
+	userRepo   repository.IUserRepository
+	rewardRepo repository.IRewardRepository
+	taskRepo   repository.ITaskRepository
+}
+
+func NewFamilyService(familyRepo repository.IFamilyRepository, userRepo repository.IUserRepository, rewardRepo repository.IRewardRepository, taskRepo repository.ITaskRepository) *FamilyService {
+	return &FamilyService{
+		familyRepo: familyRepo,
+		userRepo:   userRepo,
+		rewardRepo: rewardRepo,
+		taskRepo:   taskRepo,
+	}
+}
+
+// CreateFamily creates a new family with its own copy of the default
+// reward catalog
+func (s *FamilyService) CreateFamily(name string) (*model.Family, error) {
+	family := &model.Family{
+		Name:            name,
+		MinAwardPercent: model.DefaultMinAwardPercent,
+		MaxAwardPercent: model.DefaultMaxAwardPercent,
+	}
+	if err := s.familyRepo.CreateFamily(family); err != nil {
+		return nil, err
+	}
+
+	for _, reward := range repository.DefaultRewards() {
+		reward.FamilyID = family.ID
+		if err := s.rewardRepo.CreateReward(&reward); err != nil {
+			return nil, err
+		}
+	}
+	return family, nil
+}
+
+// GetFamily returns the family of userID together with all its members
+func (s *FamilyService) GetFamily(userID uint) (*model.Family, []model.User, error) {
+	user, err := s.userRepo.GetUser(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	family, err := s.familyRepo.GetFamily(user.FamilyID)
+	if err != nil {
+		return nil, nil, err
+	}
+	members, err := s.userRepo.GetMembersByFamily(family.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return family, members, nil
+}
+
+// CreateInvite lets a parent generate an invite code for their family. role
+// restricts who may use it (empty for anyone), ttl defaults to 72 hours.
+func (s *FamilyService) CreateInvite(parentID uint, role string, ttl time.Duration, maxUses int) (*model.FamilyInvite, error) {
+	parent, err := s.userRepo.GetUser(parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.Role != "parent" {
+		return nil, ErrPermissionDenied
+	}
+	if role != "" && role != "parent" && role != "student" {
+		return nil, errors.New("invalid invite role")
+	}
+	if ttl <= 0 {
+		ttl = defaultInviteTTL
+	}
+	if ttl > maxInviteTTL {
+		ttl = maxInviteTTL
+	}
+	if maxUses < 0 {
+		maxUses = 0
+	}
+
+	invite := &model.FamilyInvite{
+		Code:      generateInviteCode(),
+		FamilyID:  parent.FamilyID,
+		CreatorID: parent.ID,
+		Role:      role,
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.familyRepo.CreateInvite(invite); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// FamilySettings carries the family settings parents may change; nil
+// fields are left unchanged
+type FamilySettings struct {
+	// Range of points, as a percentage of a task's points, that parents may
+	// award on approval
+	MinAwardPercent *int `json:"min_award_percent"`
+	MaxAwardPercent *int `json:"max_award_percent"`
+	// Share of the points withheld when an overdue submission is approved
+	LatePenaltyPercent *int `json:"late_penalty_percent"`
+	// Points deducted when a task is still not submitted at its deadline
+	MissedTaskPenalty *int `json:"missed_task_penalty"`
+	// IANA time zone the family's days are counted in, e.g. Asia/Shanghai
+	Timezone *string `json:"timezone"`
+	// Days that do not break a streak, written like a task recurrence
+	StreakSkipDays *string `json:"streak_skip_days"`
+	// Streak bonuses; an empty list turns them off
+	StreakMilestones *model.StreakMilestones `json:"streak_milestones"`
+}
+
+// UpdateSettings changes the award limits and penalties of the parent's
+// family
+func (s *FamilyService) UpdateSettings(parentID uint, settings FamilySettings) (*model.Family, error) {
+	parent, err := s.userRepo.GetUser(parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.Role != "parent" {
+		return nil, ErrPermissionDenied
+	}
+	family, err := s.familyRepo.GetFamily(parent.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.MinAwardPercent != nil {
+		family.MinAwardPercent = *settings.MinAwardPercent
+	}
+	if settings.MaxAwardPercent != nil {
+		family.MaxAwardPercent = *settings.MaxAwardPercent
+	}
+	if settings.LatePenaltyPercent != nil {
+		family.LatePenaltyPercent = *settings.LatePenaltyPercent
+	}
+	if settings.MissedTaskPenalty != nil {
+		family.MissedTaskPenalty = *settings.MissedTaskPenalty
+	}
+	if settings.Timezone != nil {
+		family.Timezone = strings.TrimSpace(*settings.Timezone)
+	}
+	if settings.StreakSkipDays != nil {
+		family.StreakSkipDays = strings.ToLower(strings.TrimSpace(*settings.StreakSkipDays))
+	}
+	if settings.StreakMilestones != nil {
+		milestones := append(model.StreakMilestones{}, *settings.StreakMilestones...)
+		sort.Slice(milestones, func(i, j int) bool { return milestones[i].Days < milestones[j].Days })
+		family.StreakMilestones = milestones
+	}
+	if family.MinAwardPercent < 0 || family.MinAwardPercent > 100 {
+		return nil, errors.New("min_award_percent must be between 0 and 100")
+	}
+	if family.MaxAwardPercent < 100 || family.MaxAwardPercent > maxAwardPercent {
+		return nil, fmt.Errorf("max_award_percent must be between 100 and %d", maxAwardPercent)
+	}
+	if family.LatePenaltyPercent < 0 || family.LatePenaltyPercent > 100 {
+		return nil, errors.New("late_penalty_percent must be between 0 and 100")
+	}
+	if family.MissedTaskPenalty < 0 || family.MissedTaskPenalty > maxMissedPenalty {
+		return nil, fmt.Errorf("missed_task_penalty must be between 0 and %d", maxMissedPenalty)
+	}
+	if err := validateStreakSettings(family); err != nil {
+		return nil, err
+	}
+
+	if err := s.familyRepo.UpdateSettings(family); err != nil {
+		return nil, err
+	}
+	return s.familyRepo.GetFamily(parent.FamilyID)
+}
+
+func validateStreakSettings(family *model.Family) error {
+	if family.Timezone != "" {
+		if _, err := time.LoadLocation(family.Timezone); err != nil {
+			return fmt.Errorf("unknown timezone %q", family.Timezone)
+		}
+	}
+	skip, err := scheduler.ParseRule(family.StreakSkipDays)
+	if err != nil {
+		return fmt.Errorf("streak_skip_days: %w", err)
+	}
+	if skip != nil {
+		// Skipping every day would make any streak endless
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		every := true
+		for i := 0; i < 7; i++ {
+			every = every && skip.Matches(start.AddDate(0, 0, i))
+		}
+		if every {
+			return errors.New("streak_skip_days cannot skip every day")
+		}
+	}
+	if len(family.StreakMilestones) > maxMilestones {
+		return fmt.Errorf("at most %d streak milestones", maxMilestones)
+	}
+	for i, milestone := range family.StreakMilestones {
+		if milestone.Days < 2 || milestone.Days > maxStreakDays {
+			return fmt.Errorf("streak milestone days must be between 2 and %d", maxStreakDays)
+		}
+		if milestone.Points < 1 || milestone.Points > maxStreakBonus {
+			return fmt.Errorf("streak milestone points must be between 1 and %d", maxStreakBonus)
+		}
+		if i > 0 && family.StreakMilestones[i-1].Days == milestone.Days {
+			return fmt.Errorf("duplicate streak milestone for %d days", milestone.Days)
+		}
+	}
+	return nil
+}
+
+// useInvite consumes an invite for a user with the given role and returns
+// the family to join
+func (s *FamilyService) useInvite(code string, role string) (uint, error) {
+	invite, err := s.familyRepo.UseInvite(strings.ToUpper(strings.TrimSpace(code)), role, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return invite.FamilyID, nil
+}
+
+// releaseInvite gives back the use taken by useInvite
+func (s *FamilyService) releaseInvite(code string) error {
+	return s.familyRepo.ReleaseInvite(strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// JoinFamily moves an existing user into the family the invite belongs to
+func (s *FamilyService) JoinFamily(userID uint, code string) (*model.Family, error) {
+	user, err := s.userRepo.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	familyID, err := s.useInvite(code, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.moveMember(user, familyID); err != nil {
+		return nil, err
+	}
+	return s.familyRepo.GetFamily(familyID)
+}
+
+// RemoveMember lets a parent remove another member from their family. The
+// removed user is moved into a new family of their own so that they never
+// share data with another household.
+func (s *FamilyService) RemoveMember(parentID uint, memberID uint) error {
+	if parentID == memberID {
+		return errors.New("cannot remove yourself")
+	}
+	parent, err := s.userRepo.GetUser(parentID)
+	if err != nil {
+		return err
+	}
+	member, err := s.userRepo.GetUser(memberID)
+	if err != nil {
+		return err
+	}
+	if parent.Role != "parent" || parent.FamilyID != member.FamilyID {
+		return ErrPermissionDenied
+	}
+
+	family, err := s.CreateFamily(familyName(member))
+	if err != nil {
+		return err
+	}
+	return s.moveMember(member, family.ID)
+}
+
+// moveMember puts user into familyID. A student's open task logs belong to
+// the tasks of the family they leave, so they are cancelled rather than
+// showing up for review in the new family.
+func (s *FamilyService) moveMember(user *model.User, familyID uint) error {
+	if user.FamilyID == familyID {
+		return nil
+	}
+	if err := s.userRepo.SetFamily(user.ID, familyID); err != nil {
+		return err
+	}
+	if user.Role != "student" {
+		return nil
+	}
+	_, err := s.taskRepo.CancelStudentLogs(user.ID)
+	return err
+}
+
+func familyName(user *model.User) string {
+	name := user.RealName
+	if name == "" {
+		name = user.Username
+	}
+	return fmt.Sprintf("%s的家庭", name)
+}
+
+// InviteQRPayload is the string the app encodes into a QR code
+func InviteQRPayload(code string) string {
+	return "studyquest://family/join?code=" + code
+}
+
+func generateInviteCode() string {
+	b := make([]byte, inviteCodeLength)
+	rand.Read(b)
+	for i := range b {
+		b[i] = inviteCodeAlphabet[int(b[i])%len(inviteCodeAlphabet)]
+	}
+	return string(b)
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"study-quest-backend/internal/feature"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+	"time"
+)
+
+var (
+	ErrFeatureDisabled = errors.New("feature is disabled")
+	ErrInvalidFlag     = errors.New("invalid feature flag")
+)
+
+// defaultFeatures applies to flags that have no feature_flags row yet, so
+// existing deployments keep every module switched on
+var defaultFeatures = map[string]bool{
+	model.FeatureMall:       true,
+	model.FeatureGameCenter: true,
+}
+
+// FeatureService evaluates feature flags. Flags are cached like app configs
+// and edits through the service invalidate the cache.
+type FeatureService struct {
+	flagRepo repository.IFeatureFlagRepository
+	cache    *cachedList[model.FeatureFlag]
+}
+
+func NewFeatureService(flagRepo repository.IFeatureFlagRepository, ttl time.Duration) *FeatureService {
+	return &FeatureService{
+		flagRepo: flagRepo,
+		cache:    newCachedList(ttl, flagRepo.GetAllFlags),
+	}
+}
+
+// IsEnabled reports whether the flag key is on for ctx
+func (s *FeatureService) IsEnabled(key string, ctx feature.Context) (bool, error) {
+	flags, err := s.cache.Get()
+	if err != nil {
+		return false, err
+	}
+	for i := range flags {
+		if flags[i].Key == key {
+			return feature.Enabled(&flags[i], ctx), nil
+		}
+	}
+	return defaultFeatures[key], nil
+}
+
+// EnabledFeatures lists the keys of all flags that are on for ctx
+func (s *FeatureService) EnabledFeatures(ctx feature.Context) ([]string, error) {
+	flags, err := s.cache.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := make(map[string]bool, len(defaultFeatures)+len(flags))
+	for key, on := range defaultFeatures {
+		enabled[key] = on
+	}
+	for i := range flags {
+		enabled[flags[i].Key] = feature.Enabled(&flags[i], ctx)
+	}
+
+	keys := []string{}
+	for key, on := range enabled {
+		if on {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (s *FeatureService) ListFlags() ([]model.FeatureFlag, error) {
+	return s.flagRepo.GetAllFlags()
+}
+
+// SaveFlag creates or updates the flag with flag.Key. Family overrides are
+// kept.
+func (s *FeatureService) SaveFlag(flag *model.FeatureFlag) error {
+	flag.Key = strings.TrimSpace(flag.Key)
+	if flag.Key == "" || len(flag.Key) > 64 {
+		return fmt.Errorf("%w: key must be 1-64 characters", ErrInvalidFlag)
+	}
+	if flag.Percentage < 0 || flag.Percentage > 100 {
+		return fmt.Errorf("%w: percentage must be between 0 and 100", ErrInvalidFlag)
+	}
+
+	var platforms []string
+	for _, p := range strings.Split(flag.Platforms, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		if p == model.ConfigPlatformAll || !configPlatforms[p] {
+			return fmt.Errorf("%w: unknown platform %q", ErrInvalidFlag, p)
+		}
+		platforms = append(platforms, p)
+	}
+	flag.Platforms = strings.Join(platforms, ",")
+
+	if err := s.flagRepo.SaveFlag(flag); err != nil {
+		return err
+	}
+	s.cache.Invalidate()
+	return nil
+}
+
+// SetOverride forces a flag on or off for one family; nil removes the
+// override so the family follows the rollout again
+func (s *FeatureService) SetOverride(key string, familyID uint, enabled *bool) error {
+	if familyID == 0 {
+		return fmt.Errorf("%w: family_id is required", ErrInvalidFlag)
+	}
+	if err := s.flagRepo.SetOverride(key, familyID, enabled); err != nil {
+		return err
+	}
+	s.cache.Invalidate()
+	return nil
+}
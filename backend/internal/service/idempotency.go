@@ -0,0 +1,79 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+	"time"
+)
+
+// idempotencyTTL is how long a key and its stored response are kept
+const idempotencyTTL = 24 * time.Hour
+
+var (
+	ErrIdempotencyInProgress = errors.New("a request with this Idempotency-Key is still in progress")
+	ErrIdempotencyKeyReused  = errors.New("Idempotency-Key was already used for a different request")
+)
+
+// IdempotencyService remembers the responses of write requests sent with an
+// Idempotency-Key so that retries are answered without running them again
+type IdempotencyService struct {
+	repo repository.IIdempotencyRepository
+}
+
+func NewIdempotencyService(repo repository.IIdempotencyRepository) *IdempotencyService {
+	return &IdempotencyService{repo: repo}
+}
+
+// Begin reserves key for userID. When the key was already used for the same
+// request, the stored record is returned with replay set and the caller
+// should answer with its response instead of handling the request.
+func (s *IdempotencyService) Begin(userID uint, key string, requestHash string) (record *model.IdempotencyKey, replay bool, err error) {
+	now := time.Now()
+	record = &model.IdempotencyKey{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		ExpiresAt:   now.Add(idempotencyTTL),
+	}
+	existing, err := s.repo.ReserveKey(record, now)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing == nil {
+		return record, false, nil
+	}
+	if existing.RequestHash != requestHash {
+		return nil, false, ErrIdempotencyKeyReused
+	}
+	if existing.StatusCode == 0 {
+		return nil, false, ErrIdempotencyInProgress
+	}
+	return existing, true, nil
+}
+
+// Complete stores the response for record. Server errors release the key
+// so that the client can retry.
+func (s *IdempotencyService) Complete(record *model.IdempotencyKey, statusCode int, contentType string, response []byte) {
+	if statusCode >= http.StatusInternalServerError {
+		s.Abort(record)
+		return
+	}
+	if err := s.repo.CompleteKey(record.ID, statusCode, contentType, response); err != nil {
+		log.Printf("Failed to store response for Idempotency-Key %q: %v", record.Key, err)
+	}
+}
+
+// Abort releases a reserved key without storing a response
+func (s *IdempotencyService) Abort(record *model.IdempotencyKey) {
+	if err := s.repo.DeleteKey(record.ID); err != nil {
+		log.Printf("Failed to release Idempotency-Key %q: %v", record.Key, err)
+	}
+}
+
+// PurgeExpired deletes keys older than the retention period
+func (s *IdempotencyService) PurgeExpired(now time.Time) error {
+	return s.repo.DeleteExpiredKeys(now)
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"study-quest-backend/internal/model"
+	"time"
+)
+
+// Level is one step of the level curve
+type Level struct {
+	Threshold int    `json:"threshold"`
+	Title     string `json:"title"`
+	Icon      string `json:"icon"`
+}
+
+// DefaultLevels is used when the config defines no curve
+var DefaultLevels = []Level{
+	{Threshold: 0, Title: "学习新手", Icon: "🌱"},
+	{Threshold: 100, Title: "勤奋学徒", Icon: "📘"},
+	{Threshold: 300, Title: "知识探险家", Icon: "🧭"},
+	{Threshold: 600, Title: "学习达人", Icon: "⭐"},
+	{Threshold: 1000, Title: "智慧之星", Icon: "🌟"},
+	{Threshold: 1600, Title: "学霸", Icon: "🏅"},
+	{Threshold: 2500, Title: "学神", Icon: "🏆"},
+	{Threshold: 4000, Title: "传奇学者", Icon: "👑"},
+}
+
+// LevelCurve maps lifetime points to levels. Level 1 starts at 0 points.
+type LevelCurve struct {
+	levels []Level
+}
+
+// NewLevelCurve checks that thresholds start at 0 and strictly increase
+func NewLevelCurve(levels []Level) (*LevelCurve, error) {
+	if len(levels) == 0 {
+		levels = DefaultLevels
+	}
+	if levels[0].Threshold != 0 {
+		return nil, fmt.Errorf("the first level must start at 0 points, not %d", levels[0].Threshold)
+	}
+	for i := 1; i < len(levels); i++ {
+		if levels[i].Threshold <= levels[i-1].Threshold {
+			return nil, fmt.Errorf("level %d threshold %d must be above %d", i+1, levels[i].Threshold, levels[i-1].Threshold)
+		}
+	}
+	return &LevelCurve{levels: levels}, nil
+}
+
+// LevelInfo is a student's level and progress towards the next one
+type LevelInfo struct {
+	Level          int    `json:"level"`
+	Title          string `json:"title"`
+	Icon           string `json:"icon"`
+	TotalPoints    int    `json:"total_points"`
+	LevelThreshold int    `json:"level_threshold"`
+	// NextThreshold and NextTitle are empty at the top level
+	NextThreshold *int   `json:"next_threshold,omitempty"`
+	NextTitle     string `json:"next_title,omitempty"`
+	Progress      int    `json:"progress"` // 0-100 towards the next level
+}
+
+// Levels returns the whole curve
+func (c *LevelCurve) Levels() []Level {
+	return c.levels
+}
+
+// Info returns the level reached with totalPoints
+func (c *LevelCurve) Info(totalPoints int) LevelInfo {
+	index := 0
+	for i, level := range c.levels {
+		if totalPoints >= level.Threshold {
+			index = i
+		}
+	}
+	current := c.levels[index]
+	info := LevelInfo{
+		Level:          index + 1,
+		Title:          current.Title,
+		Icon:           current.Icon,
+		TotalPoints:    totalPoints,
+		LevelThreshold: current.Threshold,
+		Progress:       100,
+	}
+	if index+1 < len(c.levels) {
+		next := c.levels[index+1]
+		info.NextThreshold = &next.Threshold
+		info.NextTitle = next.Title
+		info.Progress = (totalPoints - current.Threshold) * 100 / (next.Threshold - current.Threshold)
+	}
+	return info
+}
+
+// recordLevelUp stores a level-up when totalBefore and the student's current
+// lifetime points fall on different levels
+func (s *TaskService) recordLevelUp(studentID uint, totalBefore int) *model.LevelUp {
+	student, err := s.userRepo.GetUser(studentID)
+	if err != nil {
+		log.Printf("Error loading student %d for level check: %v", studentID, err)
+		return nil
+	}
+	before, after := s.levels.Info(totalBefore), s.levels.Info(student.TotalPointsEarned)
+	if after.Level <= before.Level {
+		return nil
+	}
+
+	levelUp := &model.LevelUp{
+		StudentID:   studentID,
+		Level:       after.Level,
+		FromLevel:   before.Level,
+		Title:       after.Title,
+		Icon:        after.Icon,
+		TotalPoints: student.TotalPointsEarned,
+	}
+	created, err := s.userRepo.CreateLevelUp(levelUp)
+	if err != nil {
+		log.Printf("Error recording level-up of student %d: %v", studentID, err)
+		return nil
+	}
+	if !created {
+		return nil
+	}
+	log.Printf("Student %d reached level %d (%s)", studentID, after.Level, after.Title)
+	return levelUp
+}
+
+// Levels returns the level curve in use
+func (s *TaskService) Levels() []Level {
+	return s.levels.Levels()
+}
+
+// AcknowledgeLevelUps marks the student's level-ups as seen so the app stops
+// celebrating them
+func (s *TaskService) AcknowledgeLevelUps(studentID uint) error {
+	return s.userRepo.MarkLevelUpsSeen(studentID, time.Now())
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"log"
+	"study-quest-backend/internal/model"
+	"time"
+)
+
+// MarkOverdueTasks marks the open logs whose deadline has passed as overdue
+// and deducts the family's missed task penalty through the points ledger.
+// It runs as a scheduler job; a log is only ever marked and penalized once.
+func (s *TaskService) MarkOverdueTasks(now time.Time) error {
+	logs, err := s.taskRepo.GetNewlyOverdueLogs(now)
+	if err != nil {
+		return err
+	}
+
+	families := make(map[uint]*model.Family)
+	marked := 0
+	for _, taskLog := range logs {
+		family, ok := families[taskLog.Task.FamilyID]
+		if !ok {
+			family, err = s.familyRepo.GetFamily(taskLog.Task.FamilyID)
+			if err != nil {
+				return err
+			}
+			families[taskLog.Task.FamilyID] = family
+		}
+
+		var entry *model.PointTransaction
+		if family.MissedTaskPenalty > 0 {
+			entry = &model.PointTransaction{
+				UserID:     taskLog.StudentID,
+				SourceType: model.PointSourcePenalty,
+				SourceID:   taskLog.ID,
+				Delta:      -family.MissedTaskPenalty,
+				Remark:     taskLog.Task.Title + "（逾期未完成）",
+			}
+		}
+		ok, err = s.pointRepo.MarkOverdue(taskLog.ID, now, entry)
+		if err != nil {
+			log.Printf("Error marking task log %d overdue: %v", taskLog.ID, err)
+			continue
+		}
+		if ok {
+			marked++
+			if entry != nil {
+				s.publishPoints(taskLog.StudentID)
+			}
+		}
+	}
+
+	if marked > 0 {
+		log.Printf("Marked %d task logs overdue", marked)
+	}
+	return nil
+}
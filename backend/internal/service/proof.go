@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"study-quest-backend/internal/media"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/storage"
+	"time"
+)
+
+const (
+	// MaxProofImages is how many photos one submission may carry
+	MaxProofImages   = 3
+	thumbnailMaxSide = 320
+)
+
+var ErrInvalidProof = errors.New("invalid proof image")
+
+// ProofUpload is one uploaded file as received from the client
+type ProofUpload struct {
+	Filename string
+	Data     []byte
+}
+
+// ProofService validates proof photos, stores them with a thumbnail and
+// hands out short-lived signed URLs to view them
+type ProofService struct {
+	storage  storage.Storage
+	maxBytes int
+	urlTTL   time.Duration
+}
+
+func NewProofService(store storage.Storage, maxBytes int, urlTTL time.Duration) *ProofService {
+	return &ProofService{
+		storage:  store,
+		maxBytes: maxBytes,
+		urlTTL:   urlTTL,
+	}
+}
+
+// MaxBytes is the size limit for a single upload
+func (s *ProofService) MaxBytes() int {
+	return s.maxBytes
+}
+
+// Store validates and saves the uploads of task log logID. On failure
+// nothing is left behind in the storage.
+func (s *ProofService) Store(ctx context.Context, logID uint, uploads []ProofUpload) (model.ProofImages, error) {
+	if len(uploads) > MaxProofImages {
+		return nil, fmt.Errorf("%w: at most %d images", ErrInvalidProof, MaxProofImages)
+	}
+
+	type prepared struct {
+		contentType string
+		data, thumb []byte
+	}
+	var files []prepared
+	for _, upload := range uploads {
+		if len(upload.Data) > s.maxBytes {
+			return nil, fmt.Errorf("%w: %s is larger than %d bytes", ErrInvalidProof, upload.Filename, s.maxBytes)
+		}
+		contentType, err := media.DetectImage(upload.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidProof, upload.Filename, err)
+		}
+		thumb, err := media.Thumbnail(upload.Data, thumbnailMaxSide)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidProof, upload.Filename, err)
+		}
+		files = append(files, prepared{contentType: contentType, data: upload.Data, thumb: thumb})
+	}
+
+	var images model.ProofImages
+	for _, f := range files {
+		name := randomName()
+		image := model.ProofImage{
+			Key:          fmt.Sprintf("proofs/%d/%s%s", logID, name, media.AllowedTypes[f.contentType]),
+			ThumbnailKey: fmt.Sprintf("proofs/%d/%s_thumb.jpg", logID, name),
+			ContentType:  f.contentType,
+			Size:         len(f.data),
+		}
+		if err := s.storage.Put(ctx, image.Key, f.data, f.contentType); err != nil {
+			s.Remove(ctx, images)
+			return nil, err
+		}
+		images = append(images, image)
+		if err := s.storage.Put(ctx, image.ThumbnailKey, f.thumb, "image/jpeg"); err != nil {
+			s.Remove(ctx, images)
+			return nil, err
+		}
+	}
+	return images, nil
+}
+
+// Remove deletes stored proof images, logging failures
+func (s *ProofService) Remove(ctx context.Context, images model.ProofImages) {
+	for _, image := range images {
+		for _, key := range []string{image.Key, image.ThumbnailKey} {
+			if err := s.storage.Delete(ctx, key); err != nil {
+				log.Printf("Failed to delete proof %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// Attach fills in signed URLs for the proof images of every log
+func (s *ProofService) Attach(logs []model.TaskLog) {
+	for i := range logs {
+		logs[i].Proofs = nil
+		for _, image := range logs[i].ProofImg {
+			url, err := s.storage.SignedURL(image.Key, s.urlTTL)
+			if err != nil {
+				log.Printf("Failed to sign proof %s: %v", image.Key, err)
+				continue
+			}
+			thumbURL, err := s.storage.SignedURL(image.ThumbnailKey, s.urlTTL)
+			if err != nil {
+				thumbURL = url
+			}
+			logs[i].Proofs = append(logs[i].Proofs, model.ProofLink{URL: url, ThumbnailURL: thumbURL})
+		}
+	}
+}
+
+func randomName() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"study-quest-backend/internal/events"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+)
+
+var ErrInvalidRedemptionStatus = errors.New("invalid redemption status")
+
+var redemptionStatuses = map[string]bool{
+	model.RedemptionRequested: true,
+	model.RedemptionApproved:  true,
+	model.RedemptionFulfilled: true,
+	model.RedemptionRejected:  true,
+	model.RedemptionCancelled: true,
+	model.RedemptionRefunded:  true,
+}
+
+// GetRedemptions lists redemptions as seen by userID: a parent sees the
+// whole family, a student only their own. status filters when not empty.
+func (s *TaskService) GetRedemptions(userID uint, status string) ([]model.Redemption, error) {
+	if status != "" && !redemptionStatuses[status] {
+		return nil, ErrInvalidRedemptionStatus
+	}
+	user, err := s.userRepo.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == "parent" {
+		return s.redemptionRepo.GetRedemptionsByFamily(user.FamilyID, status)
+	}
+	return s.redemptionRepo.GetRedemptionsByStudent(user.ID, status)
+}
+
+// ApproveRedemption confirms a requested redemption
+func (s *TaskService) ApproveRedemption(parentID uint, redemptionID uint) error {
+	redemption, err := s.authorizeRedemption(parentID, redemptionID)
+	if err != nil {
+		return err
+	}
+	return s.moveRedemption(redemption, []string{model.RedemptionRequested}, model.RedemptionApproved, parentID)
+}
+
+// FulfillRedemption marks the reward as handed over. Requested redemptions
+// may be fulfilled directly without a separate approval.
+func (s *TaskService) FulfillRedemption(parentID uint, redemptionID uint) error {
+	redemption, err := s.authorizeRedemption(parentID, redemptionID)
+	if err != nil {
+		return err
+	}
+	from := []string{model.RedemptionRequested, model.RedemptionApproved}
+	return s.moveRedemption(redemption, from, model.RedemptionFulfilled, parentID)
+}
+
+// RejectRedemption declines a redemption that has not been fulfilled yet and
+// refunds its points
+func (s *TaskService) RejectRedemption(parentID uint, redemptionID uint, reason string) error {
+	redemption, err := s.authorizeRedemption(parentID, redemptionID)
+	if err != nil {
+		return err
+	}
+	note := "家长驳回"
+	if reason = strings.TrimSpace(reason); reason != "" {
+		note += ": " + reason
+	}
+	return s.refundRedemption(redemption, []string{model.RedemptionRequested, model.RedemptionApproved}, model.RedemptionRejected, note, parentID)
+}
+
+// CancelRedemption lets a student withdraw a request a parent has not acted
+// on yet and refunds its points
+func (s *TaskService) CancelRedemption(studentID uint, redemptionID uint) error {
+	redemption, err := s.redemptionRepo.GetRedemption(redemptionID)
+	if err != nil {
+		return err
+	}
+	if redemption.StudentID != studentID {
+		return repository.ErrRedemptionNotFound
+	}
+	return s.refundRedemption(redemption, []string{model.RedemptionRequested}, model.RedemptionCancelled, "学生取消", studentID)
+}
+
+// authorizeRedemption checks that parentID is a parent of the family the
+// redemption's student belongs to
+func (s *TaskService) authorizeRedemption(parentID uint, redemptionID uint) (*model.Redemption, error) {
+	redemption, err := s.redemptionRepo.GetRedemption(redemptionID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.AuthorizeStudent(parentID, redemption.StudentID); err != nil {
+		return nil, err
+	}
+	if parentID == redemption.StudentID {
+		return nil, ErrPermissionDenied
+	}
+	return redemption, nil
+}
+
+func (s *TaskService) moveRedemption(redemption *model.Redemption, from []string, to string, actorID uint) error {
+	ok, err := s.redemptionRepo.UpdateRedemptionStatus(redemption.ID, from, to, actorID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return repository.ErrInvalidTransition
+	}
+	redemption.Status = to
+	s.publishRedemption(redemption)
+	return nil
+}
+
+// refundRedemption rejects or cancels (status) the redemption and gives
+// its points back
+func (s *TaskService) refundRedemption(redemption *model.Redemption, from []string, status string, note string, actorID uint) error {
+	err := s.pointRepo.Refund(redemption.ID, from, status, note, &model.PointTransaction{
+		SourceType: model.PointSourceRefund,
+		ActorID:    actorID,
+		Remark:     redemption.RewardTitle,
+	})
+	if err != nil {
+		return err
+	}
+	redemption.Status = status
+	redemption.Note = note
+	s.publishRedemption(redemption)
+	s.publishPoints(redemption.StudentID)
+	return nil
+}
+
+// publishRedemption tells the family about the redemption's new status
+func (s *TaskService) publishRedemption(redemption *model.Redemption) {
+	if s.bus == nil {
+		return
+	}
+	student, err := s.userRepo.GetUser(redemption.StudentID)
+	if err != nil {
+		log.Printf("Error loading student %d for redemption event: %v", redemption.StudentID, err)
+		return
+	}
+	s.publish(events.RedemptionUpdated, student.FamilyID, redemption.StudentID, RedemptionEvent{
+		RedemptionID: redemption.ID,
+		RewardID:     redemption.RewardID,
+		Title:        redemption.RewardTitle,
+		Cost:         redemption.Cost,
+		Status:       redemption.Status,
+		Note:         redemption.Note,
+	})
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+)
+
+// RewardCategory describes one of the model.RewardCategory* values
+type RewardCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+var RewardCategories = []RewardCategory{
+	{ID: model.RewardCategoryTime, Name: "娱乐时间"},
+	{ID: model.RewardCategoryItem, Name: "实物奖励"},
+	{ID: model.RewardCategoryPrivilege, Name: "特权"},
+	{ID: model.RewardCategoryActivity, Name: "亲子活动"},
+}
+
+// RewardInput carries the editable reward fields; nil fields are left
+// unchanged on update
+type RewardInput struct {
+	Title       *string `json:"title"`
+	Cost        *int    `json:"cost"`
+	Category    *int    `json:"category"`
+	Stock       *int    `json:"stock"`
+	Minutes     *int    `json:"minutes"`
+	Description *string `json:"description"`
+	ImageURL    *string `json:"image_url"`
+}
+
+// RewardService manages a family's reward catalog
+type RewardService struct {
+	rewardRepo repository.IRewardRepository
+	userRepo   repository.IUserRepository
+}
+
+func NewRewardService(rewardRepo repository.IRewardRepository, userRepo repository.IUserRepository) *RewardService {
+	return &RewardService{
+		rewardRepo: rewardRepo,
+		userRepo:   userRepo,
+	}
+}
+
+// GetRewards lists the catalog of userID's family. Archived rewards are
+// only included for parents.
+func (s *RewardService) GetRewards(userID uint, includeArchived bool) ([]model.Reward, error) {
+	user, err := s.userRepo.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.rewardRepo.GetRewardsByFamily(user.FamilyID, includeArchived && user.Role == "parent")
+}
+
+func (s *RewardService) CreateReward(parentID uint, input RewardInput) (*model.Reward, error) {
+	parent, err := s.requireParent(parentID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Title == nil || input.Cost == nil {
+		return nil, errors.New("title and cost are required")
+	}
+
+	reward := &model.Reward{
+		FamilyID: parent.FamilyID,
+		Category: model.RewardCategoryItem,
+		Stock:    -1,
+	}
+	applyRewardInput(reward, input)
+	if err := validateReward(reward); err != nil {
+		return nil, err
+	}
+
+	// New rewards go to the end of the catalog
+	existing, err := s.rewardRepo.GetRewardsByFamily(parent.FamilyID, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range existing {
+		if r.SortOrder >= reward.SortOrder {
+			reward.SortOrder = r.SortOrder + 1
+		}
+	}
+
+	if err := s.rewardRepo.CreateReward(reward); err != nil {
+		return nil, err
+	}
+	return reward, nil
+}
+
+func (s *RewardService) UpdateReward(parentID uint, rewardID uint, input RewardInput) (*model.Reward, error) {
+	reward, err := s.ownedReward(parentID, rewardID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *reward
+	applyRewardInput(&updated, input)
+	if err := validateReward(&updated); err != nil {
+		return nil, err
+	}
+	if err := s.rewardRepo.UpdateReward(&updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// ArchiveReward takes a reward off the shelf (soft delete) or puts it back
+func (s *RewardService) ArchiveReward(parentID uint, rewardID uint, archived bool) error {
+	if _, err := s.ownedReward(parentID, rewardID); err != nil {
+		return err
+	}
+	return s.rewardRepo.SetRewardArchived(rewardID, archived)
+}
+
+func (s *RewardService) RestockReward(parentID uint, rewardID uint, amount int) error {
+	if amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	reward, err := s.ownedReward(parentID, rewardID)
+	if err != nil {
+		return err
+	}
+	if reward.Stock < 0 {
+		return errors.New("reward has unlimited stock")
+	}
+	return s.rewardRepo.AddStock(rewardID, amount)
+}
+
+// ReorderRewards sets the display order of the family's rewards
+func (s *RewardService) ReorderRewards(parentID uint, rewardIDs []uint) error {
+	parent, err := s.requireParent(parentID)
+	if err != nil {
+		return err
+	}
+	for _, id := range rewardIDs {
+		if _, err := s.ownedReward(parentID, id); err != nil {
+			return err
+		}
+	}
+	return s.rewardRepo.ReorderRewards(parent.FamilyID, rewardIDs)
+}
+
+func (s *RewardService) requireParent(userID uint) (*model.User, error) {
+	user, err := s.userRepo.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != "parent" {
+		return nil, ErrPermissionDenied
+	}
+	return user, nil
+}
+
+// ownedReward returns a reward of the parent's own family. Shared rewards
+// (FamilyID 0) are read-only.
+func (s *RewardService) ownedReward(parentID uint, rewardID uint) (*model.Reward, error) {
+	parent, err := s.requireParent(parentID)
+	if err != nil {
+		return nil, err
+	}
+	reward, err := s.rewardRepo.GetReward(rewardID)
+	if err != nil {
+		return nil, err
+	}
+	if reward.FamilyID == 0 {
+		return nil, ErrPermissionDenied
+	}
+	if reward.FamilyID != parent.FamilyID {
+		return nil, repository.ErrRewardNotFound
+	}
+	return reward, nil
+}
+
+func applyRewardInput(reward *model.Reward, input RewardInput) {
+	if input.Title != nil {
+		reward.Title = strings.TrimSpace(*input.Title)
+	}
+	if input.Cost != nil {
+		reward.Cost = *input.Cost
+	}
+	if input.Category != nil {
+		reward.Category = *input.Category
+	}
+	if input.Stock != nil {
+		reward.Stock = *input.Stock
+	}
+	if input.Minutes != nil {
+		reward.Minutes = *input.Minutes
+	}
+	if input.Description != nil {
+		reward.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.ImageURL != nil {
+		reward.ImageURL = strings.TrimSpace(*input.ImageURL)
+	}
+}
+
+func validateReward(reward *model.Reward) error {
+	if reward.Title == "" {
+		return errors.New("title is required")
+	}
+	if reward.Cost <= 0 {
+		return errors.New("cost must be positive")
+	}
+	if reward.Stock < -1 {
+		return errors.New("stock must be -1 (unlimited) or at least 0")
+	}
+	valid := false
+	for _, c := range RewardCategories {
+		if c.ID == reward.Category {
+			valid = true
+		}
+	}
+	if !valid {
+		return errors.New("invalid category")
+	}
+	if reward.Category == model.RewardCategoryTime && reward.Minutes <= 0 {
+		return errors.New("minutes must be positive for screen time rewards")
+	}
+	if reward.Category != model.RewardCategoryTime {
+		reward.Minutes = 0
+	}
+	if reward.ImageURL != "" {
+		u, err := url.Parse(reward.ImageURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("image_url must be an http(s) URL")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"study-quest-backend/internal/events"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+	"time"
+)
+
+var (
+	ErrNoScreenTime      = errors.New("no screen time left")
+	ErrNoOpenSession     = errors.New("no screen time session is open")
+	ErrSessionNotRunning = errors.New("screen time session is not running")
+)
+
+// ScreenTimeStatus is a student's remaining screen time together with their
+// open session, if any
+type ScreenTimeStatus struct {
+	StudentID        uint                     `json:"student_id"`
+	RemainingSeconds int                      `json:"remaining_seconds"`
+	Session          *model.ScreenTimeSession `json:"session"`
+}
+
+// ScreenTimeService runs the screen time sessions bought with time-category
+// rewards. Redeeming such a reward adds its minutes to the balance; a running
+// session consumes it and expires once it is used up. Every time the clock
+// starts or stops a screen_time.* event is published, which also drives the
+// family's devices.
+type ScreenTimeService struct {
+	screenTimeRepo repository.IScreenTimeRepository
+	userRepo       repository.IUserRepository
+	bus            *events.Bus
+}
+
+func NewScreenTimeService(screenTimeRepo repository.IScreenTimeRepository, userRepo repository.IUserRepository, bus *events.Bus) *ScreenTimeService {
+	return &ScreenTimeService{
+		screenTimeRepo: screenTimeRepo,
+		userRepo:       userRepo,
+		bus:            bus,
+	}
+}
+
+// GetStatus returns studentID's balance and open session as seen by actorID
+func (s *ScreenTimeService) GetStatus(actorID uint, studentID uint) (*ScreenTimeStatus, error) {
+	if err := s.authorize(actorID, studentID); err != nil {
+		return nil, err
+	}
+	return s.status(studentID, time.Now())
+}
+
+// Start opens a new session or resumes a paused one
+func (s *ScreenTimeService) Start(studentID uint) (*ScreenTimeStatus, error) {
+	now := time.Now()
+	status, err := s.status(studentID, now)
+	if err != nil {
+		return nil, err
+	}
+	if status.RemainingSeconds <= 0 {
+		return nil, ErrNoScreenTime
+	}
+
+	session := status.Session
+	if session == nil {
+		session = &model.ScreenTimeSession{
+			StudentID: studentID,
+			Status:    model.ScreenTimeActive,
+			StartedAt: now,
+			ResumedAt: &now,
+		}
+		if err := s.screenTimeRepo.CreateSession(session); err != nil {
+			return nil, err
+		}
+		status.Session = session
+		s.publish(events.ScreenTimeStarted, session, status.RemainingSeconds)
+		return status, nil
+	}
+
+	if session.Status == model.ScreenTimePaused {
+		session.Status = model.ScreenTimeActive
+		session.ResumedAt = &now
+		if err := s.save(session, model.ScreenTimePaused); err != nil {
+			return nil, err
+		}
+		s.publish(events.ScreenTimeStarted, session, status.RemainingSeconds)
+	}
+	return status, nil
+}
+
+// Pause stops the clock of the running session without closing it
+func (s *ScreenTimeService) Pause(studentID uint) (*ScreenTimeStatus, error) {
+	now := time.Now()
+	status, err := s.status(studentID, now)
+	if err != nil {
+		return nil, err
+	}
+	session := status.Session
+	if session == nil {
+		return nil, ErrNoOpenSession
+	}
+	if session.Status != model.ScreenTimeActive {
+		return nil, ErrSessionNotRunning
+	}
+
+	session.UsedSeconds = elapsedSeconds(session, now)
+	session.Status = model.ScreenTimePaused
+	session.ResumedAt = nil
+	if err := s.save(session, model.ScreenTimeActive); err != nil {
+		return nil, err
+	}
+	s.publish(events.ScreenTimeEnded, session, status.RemainingSeconds)
+	return status, nil
+}
+
+// Stop closes the open session of studentID. Parents may stop a session of
+// a child in their family.
+func (s *ScreenTimeService) Stop(actorID uint, studentID uint) (*ScreenTimeStatus, error) {
+	if err := s.authorize(actorID, studentID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	status, err := s.status(studentID, now)
+	if err != nil {
+		return nil, err
+	}
+	session := status.Session
+	if session == nil {
+		return nil, ErrNoOpenSession
+	}
+
+	from := session.Status
+	session.UsedSeconds = elapsedSeconds(session, now)
+	session.Status = model.ScreenTimeStopped
+	session.ResumedAt = nil
+	session.EndedAt = &now
+	if err := s.save(session, from); err != nil {
+		return nil, err
+	}
+	s.publish(events.ScreenTimeEnded, session, status.RemainingSeconds)
+	status.Session = nil
+	return status, nil
+}
+
+// GetFamilySessions lists the open sessions of the parent's family with
+// their live remaining time
+func (s *ScreenTimeService) GetFamilySessions(parentID uint) ([]ScreenTimeStatus, error) {
+	parent, err := s.userRepo.GetUser(parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent.Role != "parent" {
+		return nil, ErrPermissionDenied
+	}
+	sessions, err := s.screenTimeRepo.GetOpenSessionsByFamily(parent.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	result := make([]ScreenTimeStatus, 0, len(sessions))
+	for _, session := range sessions {
+		status, err := s.status(session.StudentID, now)
+		if err != nil {
+			return nil, err
+		}
+		if status.Session == nil {
+			continue // expired just now
+		}
+		status.Session.Student = session.Student
+		result = append(result, *status)
+	}
+	return result, nil
+}
+
+// ExpireSessions closes every running session whose balance is used up. It
+// is run periodically by the scheduler.
+func (s *ScreenTimeService) ExpireSessions(now time.Time) error {
+	sessions, err := s.screenTimeRepo.GetActiveSessions()
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if _, err := s.status(session.StudentID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// status computes the live balance of studentID and expires the open
+// session when it has run out
+func (s *ScreenTimeService) status(studentID uint, now time.Time) (*ScreenTimeStatus, error) {
+	balance, err := s.screenTimeRepo.GetBalanceSeconds(studentID)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.screenTimeRepo.GetOpenSession(studentID)
+	if err != nil {
+		return nil, err
+	}
+	status := &ScreenTimeStatus{StudentID: studentID, RemainingSeconds: balance}
+	if session == nil {
+		return status, nil
+	}
+
+	used := elapsedSeconds(session, now)
+	if session.Status == model.ScreenTimeActive && used >= balance {
+		// The balance ran out while the clock was running
+		endedAt := session.ResumedAt.Add(time.Duration(balance-session.UsedSeconds) * time.Second)
+		session.UsedSeconds = balance
+		session.Status = model.ScreenTimeExpired
+		session.ResumedAt = nil
+		session.EndedAt = &endedAt
+		err := s.save(session, model.ScreenTimeActive)
+		if err != nil && !errors.Is(err, repository.ErrInvalidTransition) {
+			return nil, err
+		}
+		if err == nil {
+			// Only the caller that expired the session announces it
+			s.publish(events.ScreenTimeEnded, session, 0)
+		}
+		status.RemainingSeconds = 0
+		return status, nil
+	}
+
+	status.RemainingSeconds = balance - used
+	status.Session = session
+	return status, nil
+}
+
+func (s *ScreenTimeService) save(session *model.ScreenTimeSession, from string) error {
+	ok, err := s.screenTimeRepo.UpdateSession(session, from)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return repository.ErrInvalidTransition
+	}
+	return nil
+}
+
+// publish announces that the clock of session started or stopped
+func (s *ScreenTimeService) publish(eventType string, session *model.ScreenTimeSession, remainingSeconds int) {
+	if s.bus == nil {
+		return
+	}
+	student, err := s.userRepo.GetUser(session.StudentID)
+	if err != nil {
+		log.Printf("Error loading student %d for screen time event: %v", session.StudentID, err)
+		return
+	}
+	s.bus.Publish(events.Event{
+		Type:      eventType,
+		FamilyID:  student.FamilyID,
+		StudentID: session.StudentID,
+		Data: ScreenTimeEvent{
+			SessionID:        session.ID,
+			Status:           session.Status,
+			RemainingSeconds: remainingSeconds,
+		},
+	})
+}
+
+// authorize lets a student act on their own screen time and a parent on
+// any child of their family
+func (s *ScreenTimeService) authorize(actorID uint, studentID uint) error {
+	if actorID == studentID {
+		return nil
+	}
+	actor, err := s.userRepo.GetUser(actorID)
+	if err != nil {
+		return err
+	}
+	student, err := s.userRepo.GetUser(studentID)
+	if err != nil {
+		return err
+	}
+	if actor.Role != "parent" || actor.FamilyID != student.FamilyID {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// elapsedSeconds is the time a session has used so far, including the
+// currently running stretch
+func elapsedSeconds(session *model.ScreenTimeSession, now time.Time) int {
+	used := session.UsedSeconds
+	if session.Status == model.ScreenTimeActive && session.ResumedAt != nil {
+		used += int(now.Sub(*session.ResumedAt) / time.Second)
+	}
+	return used
+}
@@ -1,82 +1,93 @@
 package service
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"log"
+	"study-quest-backend/internal/events"
 	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/password"
 	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/scheduler"
+	"strings"
 	"time"
 )
 
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrAwardOutOfRange  = errors.New("awarded points out of range")
+)
+
 type TaskService struct {
 	taskRepo       repository.ITaskRepository
 	userRepo       repository.IUserRepository
+	familyRepo     repository.IFamilyRepository
 	redemptionRepo repository.IRedemptionRepository
 	rewardRepo     repository.IRewardRepository
+	pointRepo      repository.IPointRepository
+	badgeRepo      repository.IBadgeRepository
+	proofService   *ProofService
+	levels         *LevelCurve
+	bus            *events.Bus
 }
 
-func NewTaskService(taskRepo repository.ITaskRepository, userRepo repository.IUserRepository, redemptionRepo repository.IRedemptionRepository, rewardRepo repository.IRewardRepository) *TaskService {
+func NewTaskService(taskRepo repository.ITaskRepository, userRepo repository.IUserRepository, familyRepo repository.IFamilyRepository, redemptionRepo repository.IRedemptionRepository, rewardRepo repository.IRewardRepository, pointRepo repository.IPointRepository, badgeRepo repository.IBadgeRepository, proofService *ProofService, levels *LevelCurve, bus *events.Bus) *TaskService {
 	return &TaskService{
 		taskRepo:       taskRepo,
 		userRepo:       userRepo,
+		familyRepo:     familyRepo,
 		redemptionRepo: redemptionRepo,
 		rewardRepo:     rewardRepo,
+		pointRepo:      pointRepo,
+		badgeRepo:      badgeRepo,
+		proofService:   proofService,
+		levels:         levels,
+		bus:            bus,
 	}
 }
 
-func (s *TaskService) GetTodayTasks(studentID uint) ([]model.TaskLog, error) {
-	return s.taskRepo.GetTodayTasks(studentID)
-}
-
-func (s *TaskService) GetPendingTasks() ([]model.TaskLog, error) {
-	return s.taskRepo.GetPendingTasks()
-}
-
-func (s *TaskService) CreateTask(title string, points int, familyID uint) error {
-	task := &model.Task{
-		Title:  title,
-		Points: points,
-		Type:   1,
+// GetTodayTasks returns the student's tasks for today in the family's time
+// zone, optionally narrowed to one task type or subject
+func (s *TaskService) GetTodayTasks(studentID uint, filter repository.TaskFilter) ([]model.TaskLog, error) {
+	student, err := s.userRepo.GetUser(studentID)
+	if err != nil {
+		return nil, err
 	}
-	
-	// Create task
-	err := s.taskRepo.CreateTask(task)
+	family, err := s.familyRepo.GetFamily(student.FamilyID)
 	if err != nil {
-		log.Printf("Error creating task: %v", err)
-		return err
+		return nil, err
 	}
-	
-	log.Printf("Task created with ID: %d, Title: %s, Points: %d", task.ID, title, points)
-	
-	// Assign to all students in the family
-	students, err := s.userRepo.GetStudentsByFamily(familyID)
+	today := scheduler.DateKey(time.Now().In(family.Location()))
+	logs, err := s.taskRepo.GetTodayTasks(studentID, student.FamilyID, today, filter)
 	if err != nil {
-		log.Printf("Error getting students for family %d: %v", familyID, err)
-		return err
+		return nil, err
 	}
-	
-	log.Printf("Found %d students in family %d", len(students), familyID)
-	
-	for _, student := range students {
-		log.Printf("Assigning task %d to student %d (%s)", task.ID, student.ID, student.Username)
-		err := s.taskRepo.AssignTaskToStudent(student.ID, task.ID)
-		if err != nil {
-			log.Printf("Error assigning task to student %d: %v", student.ID, err)
-			return err
-		}
+	s.proofService.Attach(logs)
+	return logs, nil
+}
+
+// GetPendingTasks lists the family's submissions awaiting review with
+// signed URLs for their proof photos
+func (s *TaskService) GetPendingTasks(familyID uint, filter repository.TaskFilter) ([]model.TaskLog, error) {
+	logs, err := s.taskRepo.GetPendingTasks(familyID, filter)
+	if err != nil {
+		return nil, err
 	}
-	
-	log.Printf("Task %d assigned to all students successfully", task.ID)
-	return nil
+	s.proofService.Attach(logs)
+	return logs, nil
 }
 
 func (s *TaskService) SubmitTask(studentID uint, taskID uint) error {
 	return s.taskRepo.SubmitTask(studentID, taskID)
 }
 
-func (s *TaskService) SubmitTaskByLogID(logID uint, studentID uint) error {
+// SubmitTaskByLogID submits a task log for review, optionally with proof
+// photos. A rejected log may be resubmitted; new photos replace the previous
+// attempt's, otherwise those are kept.
+func (s *TaskService) SubmitTaskByLogID(ctx context.Context, logID uint, studentID uint, uploads []ProofUpload) error {
 	// Verify the log belongs to this student
 	taskLog, err := s.taskRepo.GetTaskLog(logID)
 	if err != nil {
@@ -84,144 +95,487 @@ func (s *TaskService) SubmitTaskByLogID(logID uint, studentID uint) error {
 	}
 	
 	if taskLog.StudentID != studentID {
-		return errors.New("permission denied")
+		return ErrPermissionDenied
 	}
 	
-	if taskLog.Status != 0 {
-		return errors.New("task already submitted or completed")
+	if err := checkTaskTransition(taskLog.Status, model.TaskStatusPending); err != nil {
+		return err
 	}
 	
-	return s.taskRepo.SubmitTaskByLogID(logID)
+	proof, err := s.proofService.Store(ctx, logID, uploads)
+	if err != nil {
+		return err
+	}
+	if err := s.taskRepo.SubmitTaskByLogID(logID, proof); err != nil {
+		s.proofService.Remove(ctx, proof)
+		return err
+	}
+	if proof != nil {
+		s.proofService.Remove(ctx, taskLog.ProofImg)
+	}
+	s.publish(events.TaskSubmitted, taskLog.Task.FamilyID, studentID, TaskEvent{
+		LogID:  logID,
+		TaskID: taskLog.TaskID,
+		Title:  taskLog.Task.Title,
+		Points: taskLog.Task.Points,
+	})
+	return nil
 }
 
-func (s *TaskService) ApproveTask(logID uint) error {
-	// 1. Get task log to obtain student ID and points
+// taskTransitions lists the status changes a TaskLog may go through
+var taskTransitions = map[int][]int{
+	model.TaskStatusTodo:     {model.TaskStatusPending, model.TaskStatusCancelled},
+	model.TaskStatusPending:  {model.TaskStatusDone, model.TaskStatusRejected},
+	model.TaskStatusRejected: {model.TaskStatusPending, model.TaskStatusCancelled},
+}
+
+var taskStatusNames = map[int]string{
+	model.TaskStatusTodo:      "todo",
+	model.TaskStatusPending:   "pending",
+	model.TaskStatusDone:      "done",
+	model.TaskStatusRejected:  "rejected",
+	model.TaskStatusCancelled: "cancelled",
+}
+
+// checkTaskTransition reports whether a log in status from may move to to.
+// The repositories repeat the check in the update itself so that concurrent
+// requests cannot both pass it.
+func checkTaskTransition(from int, to int) error {
+	for _, allowed := range taskTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: task is %s, cannot become %s", repository.ErrInvalidTransition, taskStatusNames[from], taskStatusNames[to])
+}
+
+// authorizeReview checks that actorID is a parent of the family the log's
+// student belongs to and returns the log
+func (s *TaskService) authorizeReview(logID uint, actorID uint) (*model.TaskLog, error) {
+	actor, err := s.userRepo.GetUser(actorID)
+	if err != nil {
+		return nil, err
+	}
+	if actor.Role != "parent" {
+		return nil, ErrPermissionDenied
+	}
+
 	taskLog, err := s.taskRepo.GetTaskLog(logID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	student, err := s.userRepo.GetUser(taskLog.StudentID)
+	if err != nil {
+		return nil, err
+	}
+	// The task decides which family may review it; a student who has
+	// moved to another family can no longer be reviewed by either
+	if taskLog.Task.FamilyID != actor.FamilyID || student.FamilyID != actor.FamilyID {
+		return nil, ErrPermissionDenied
+	}
+	return taskLog, nil
+}
 
-	// 2. Approve the task
-	err = s.taskRepo.ApproveTask(logID)
+// Approval is what an approval brought the student besides the points
+type Approval struct {
+	LevelUp *model.LevelUp
+	Badges  []model.Badge
+}
+
+// ApproveTask approves a submission and awards the task's points, or
+// awarded points when given (partial credit or a bonus) within the limits
+// of the family
+func (s *TaskService) ApproveTask(logID uint, actorID uint, awarded *int) (*Approval, error) {
+	// 1. Get task log to obtain student ID and points
+	taskLog, err := s.authorizeReview(logID, actorID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if err := checkTaskTransition(taskLog.Status, model.TaskStatusDone); err != nil {
+		return nil, err
+	}
+
+	actor, err := s.userRepo.GetUser(actorID)
+	if err != nil {
+		return nil, err
+	}
+	family, err := s.familyRepo.GetFamily(actor.FamilyID)
+	if err != nil {
+		return nil, err
 	}
+	student, err := s.userRepo.GetUser(taskLog.StudentID)
+	if err != nil {
+		return nil, err
+	}
+	totalBefore := student.TotalPointsEarned
 
-	// 3. Add points to student
-	return s.userRepo.AddPoints(taskLog.StudentID, taskLog.Task.Points)
+	points := taskLog.Task.Points
+	remark := taskLog.Task.Title
+	// Overdue submissions lose the family's late penalty unless the parent
+	// picks the points explicitly
+	if taskLog.OverdueAt != nil && awarded == nil && family.LatePenaltyPercent > 0 {
+		points = points * (100 - family.LatePenaltyPercent) / 100
+		remark += "（逾期提交）"
+	}
+	if awarded != nil && *awarded != points {
+		min, max := AwardRange(family, points)
+		if *awarded < min || *awarded > max {
+			return nil, fmt.Errorf("%w: must be between %d and %d", ErrAwardOutOfRange, min, max)
+		}
+		if *awarded < points {
+			remark += "（部分完成）"
+		} else {
+			remark += "（额外奖励）"
+		}
+		points = *awarded
+	}
+
+	// 2. Approve the task and add points in one transaction
+	err = s.pointRepo.ApproveTask(logID, &model.PointTransaction{
+		UserID:     taskLog.StudentID,
+		SourceType: model.PointSourceTask,
+		SourceID:   logID,
+		Delta:      points,
+		ActorID:    actorID,
+		Remark:     remark,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Pay streak milestones the approval completed, record a level-up and
+	// unlock badges; the approval itself stands even if these fail
+	s.awardStreakBonuses(taskLog.StudentID)
+	approval := &Approval{
+		LevelUp: s.recordLevelUp(taskLog.StudentID, totalBefore),
+		Badges:  s.evaluateBadges(taskLog.StudentID, model.PointSourceTask, logID),
+	}
+
+	// 4. Tell the family
+	s.publish(events.TaskApproved, student.FamilyID, taskLog.StudentID, TaskEvent{
+		LogID:   logID,
+		TaskID:  taskLog.TaskID,
+		Title:   taskLog.Task.Title,
+		Points:  points,
+		LevelUp: approval.LevelUp,
+		Badges:  approval.Badges,
+	})
+	s.publishPoints(taskLog.StudentID)
+	return approval, nil
 }
 
-func (s *TaskService) RejectTask(logID uint) error {
-	return s.taskRepo.RejectTask(logID)
+// AwardRange is the range of points a family may award for a task worth
+// points
+func AwardRange(family *model.Family, points int) (int, int) {
+	return points * family.MinAwardPercent / 100, points * family.MaxAwardPercent / 100
+}
+
+// GetTaskHistory returns the reviewed tasks of studentID as seen by actorID,
+// with the points actually awarded
+func (s *TaskService) GetTaskHistory(actorID uint, studentID uint, limit int) ([]model.TaskLog, error) {
+	if _, err := s.AuthorizeStudent(actorID, studentID); err != nil {
+		return nil, err
+	}
+	logs, err := s.taskRepo.GetTaskHistory(studentID, limit)
+	if err != nil {
+		return nil, err
+	}
+	s.proofService.Attach(logs)
+	return logs, nil
+}
+
+// RejectTask sends a pending submission back to the student. The reason is
+// shown on the log and kept in its comment thread.
+func (s *TaskService) RejectTask(logID uint, actorID uint, reason string) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return ErrReasonRequired
+	}
+	if err := validateComment(reason); err != nil {
+		return err
+	}
+	taskLog, err := s.authorizeReview(logID, actorID)
+	if err != nil {
+		return err
+	}
+	if err := checkTaskTransition(taskLog.Status, model.TaskStatusRejected); err != nil {
+		return err
+	}
+	err = s.taskRepo.RejectTask(logID, &model.TaskComment{
+		LogID:      logID,
+		AuthorID:   actorID,
+		AuthorRole: "parent",
+		Kind:       model.TaskCommentRejection,
+		Attempt:    taskLog.Attempts,
+		Content:    reason,
+	})
+	if err != nil {
+		return err
+	}
+	s.publish(events.TaskRejected, taskLog.Task.FamilyID, taskLog.StudentID, TaskEvent{
+		LogID:  logID,
+		TaskID: taskLog.TaskID,
+		Title:  taskLog.Task.Title,
+		Points: taskLog.Task.Points,
+		Reason: reason,
+	})
+	return nil
 }
 
 func (s *TaskService) GetUserProfile(userID uint) (*model.User, error) {
 	return s.userRepo.GetUser(userID)
 }
 
-func (s *TaskService) RedeemReward(studentID uint, rewardID uint, rewardTitle string, rewardCost int) error {
-	// 1. Check if user has enough points
-	user, err := s.userRepo.GetUser(studentID)
+// Profile is the signed-in user as shown on /profile; students also get
+// their level, unacknowledged level-ups and streaks
+type Profile struct {
+	*model.User
+	Level    *LevelInfo      `json:"level,omitempty"`
+	LevelUps []model.LevelUp `json:"level_ups,omitempty"`
+	Streak   *StreakSummary  `json:"streak,omitempty"`
+}
+
+func (s *TaskService) GetProfile(userID uint) (*Profile, error) {
+	user, err := s.userRepo.GetUser(userID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	profile := &Profile{User: user}
+	if user.Role == "student" {
+		level := s.levels.Info(user.TotalPointsEarned)
+		profile.Level = &level
+		if profile.LevelUps, err = s.userRepo.GetUnseenLevelUps(userID); err != nil {
+			return nil, err
+		}
+		if profile.Streak, err = s.GetStreaks(userID); err != nil {
+			return nil, err
+		}
 	}
+	return profile, nil
+}
 
-	if user.Points < rewardCost {
-		return errors.New("insufficient points")
+// RedeemReward prices the reward server-side and deducts points and stock
+// atomically. It also returns the badges the redemption unlocked.
+func (s *TaskService) RedeemReward(studentID uint, rewardID uint) (*model.Redemption, []model.Badge, error) {
+	student, err := s.userRepo.GetUser(studentID)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// 2. Create redemption record
+	// 1. Look up the reward; other families' rewards are invisible
+	reward, err := s.rewardRepo.GetReward(rewardID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reward.FamilyID != 0 && reward.FamilyID != student.FamilyID {
+		return nil, nil, repository.ErrRewardNotFound
+	}
+
+	// 2. Create redemption record, decrement stock and deduct points in one transaction.
+	// Screen time is granted right away; everything else waits for a parent.
+	status := model.RedemptionRequested
+	if reward.Category == model.RewardCategoryTime {
+		status = model.RedemptionFulfilled
+	}
 	redemption := &model.Redemption{
-		StudentID:   studentID,
-		RewardID:    rewardID,
-		RewardTitle: rewardTitle,
-		Cost:        rewardCost,
+		StudentID: studentID,
+		RewardID:  reward.ID,
+		Status:    status,
 	}
-	err = s.redemptionRepo.CreateRedemption(redemption)
+	err = s.pointRepo.Redeem(redemption, &model.PointTransaction{
+		UserID:     studentID,
+		SourceType: model.PointSourceRedemption,
+		ActorID:    studentID,
+	})
 	if err != nil {
-		log.Printf("Failed to create redemption record: %v", err)
-		return err
+		log.Printf("Failed to redeem reward %d for student %d: %v", rewardID, studentID, err)
+		return nil, nil, err
 	}
 
-	// 3. Deduct points
-	return s.userRepo.AddPoints(studentID, -rewardCost)
+	// 3. Unlock the badges the redemption earned and tell the family
+	badges := s.evaluateBadges(studentID, model.PointSourceRedemption, redemption.ID)
+	s.publish(events.RewardRedeemed, student.FamilyID, studentID, RedemptionEvent{
+		RedemptionID: redemption.ID,
+		RewardID:     redemption.RewardID,
+		Title:        redemption.RewardTitle,
+		Cost:         redemption.Cost,
+		Status:       redemption.Status,
+		Badges:       badges,
+	})
+	s.publishPoints(studentID)
+	return redemption, badges, nil
 }
 
-func (s *TaskService) GetRedemptionsByFamily(familyID uint) ([]model.Redemption, error) {
-	return s.redemptionRepo.GetRedemptionsByFamily(familyID)
+// GetPointTransactions returns the newest ledger entries of studentID as
+// seen by actorID
+func (s *TaskService) GetPointTransactions(actorID uint, studentID uint, limit int) ([]model.PointTransaction, error) {
+	if _, err := s.AuthorizeStudent(actorID, studentID); err != nil {
+		return nil, err
+	}
+	return s.pointRepo.GetTransactionsByUser(studentID, limit)
 }
 
-func (s *TaskService) GetRedemptionsByStudent(studentID uint) ([]model.Redemption, error) {
-	return s.redemptionRepo.GetRedemptionsByStudent(studentID)
-}
+// AuthorizeStudent checks that actorID may act on studentID's data: a
+// student only on their own, a parent on any student of their family
+func (s *TaskService) AuthorizeStudent(actorID uint, studentID uint) (*model.User, error) {
+	student, err := s.userRepo.GetUser(studentID)
+	if err != nil {
+		return nil, err
+	}
+	if actorID == studentID {
+		return student, nil
+	}
 
-func (s *TaskService) GetAllRewards() ([]model.Reward, error) {
-	return s.rewardRepo.GetAllRewards()
+	actor, err := s.userRepo.GetUser(actorID)
+	if err != nil {
+		return nil, err
+	}
+	if actor.Role != "parent" || actor.FamilyID != student.FamilyID {
+		return nil, ErrPermissionDenied
+	}
+	return student, nil
 }
 
 func (s *TaskService) GetStudentsByFamily(familyID uint) ([]model.User, error) {
 	return s.userRepo.GetStudentsByFamily(familyID)
 }
 
-func (s *TaskService) GetTopStudents(limit int) ([]model.User, error) {
-	return s.userRepo.GetTopStudents(limit)
+// RankedStudent is a ranking entry with the student's level
+type RankedStudent struct {
+	model.User
+	Level LevelInfo `json:"level"`
+}
+
+func (s *TaskService) GetTopStudents(familyID uint, limit int) ([]RankedStudent, error) {
+	students, err := s.userRepo.GetTopStudents(familyID, limit)
+	if err != nil {
+		return nil, err
+	}
+	ranking := make([]RankedStudent, len(students))
+	for i, student := range students {
+		ranking[i] = RankedStudent{User: student, Level: s.levels.Info(student.TotalPointsEarned)}
+	}
+	return ranking, nil
 }
 
 // AuthService
 type AuthService struct {
-	userRepo    repository.IUserRepository
-	sessionRepo repository.ISessionRepository
+	userRepo          repository.IUserRepository
+	sessionRepo       repository.ISessionRepository
+	familyService     *FamilyService
+	hasher            *password.Hasher
+	passwordMinLength int
+	admins            map[string]bool
 }
 
-func NewAuthService(userRepo repository.IUserRepository, sessionRepo repository.ISessionRepository) *AuthService {
+func NewAuthService(userRepo repository.IUserRepository, sessionRepo repository.ISessionRepository, familyService *FamilyService, hasher *password.Hasher, passwordMinLength int, adminUsernames []string) *AuthService {
+	admins := make(map[string]bool, len(adminUsernames))
+	for _, name := range adminUsernames {
+		admins[name] = true
+	}
 	return &AuthService{
-		userRepo:    userRepo,
-		sessionRepo: sessionRepo,
+		userRepo:          userRepo,
+		sessionRepo:       sessionRepo,
+		familyService:     familyService,
+		hasher:            hasher,
+		passwordMinLength: passwordMinLength,
+		admins:            admins,
 	}
 }
 
-func (s *AuthService) Register(username, password, role, realName string, grade int) (*model.User, error) {
+// IsAdmin reports whether user is listed in security.admin_usernames and
+// may therefore edit app-wide settings
+func (s *AuthService) IsAdmin(user *model.User) bool {
+	return s.admins[user.Username]
+}
+
+// Register creates a user. With an invite code the user joins that family,
+// otherwise a new family is created for them.
+func (s *AuthService) Register(username, plainPassword, role, realName string, grade int, inviteCode string) (*model.User, error) {
 	// Simple validation
 	if len(username) < 3 {
 		return nil, errors.New("username must be at least 3 characters")
 	}
-	if len(password) < 6 {
-		return nil, errors.New("password must be at least 6 characters")
+	if err := password.Validate(plainPassword, username, s.passwordMinLength); err != nil {
+		return nil, err
+	}
+	if role != "parent" && role != "student" {
+		return nil, errors.New("role must be parent or student")
+	}
+	if _, err := s.userRepo.GetUserByUsername(username); err == nil {
+		return nil, errors.New("username already exists")
 	}
 	
+	hash, err := s.hasher.Hash(plainPassword)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create user
 	user := &model.User{
 		Username: username,
-		Password: password, // In production, should hash the password
+		Password: hash,
 		Role:     role,
 		RealName: realName,
 		Grade:    grade,
-		FamilyID: 1, // Default family, in real app should be generated
+	}
+
+	// Resolve family
+	if inviteCode != "" {
+		familyID, err := s.familyService.useInvite(inviteCode, role)
+		if err != nil {
+			return nil, err
+		}
+		user.FamilyID = familyID
+	} else {
+		family, err := s.familyService.CreateFamily(familyName(user))
+		if err != nil {
+			return nil, err
+		}
+		user.FamilyID = family.ID
 	}
 	
 	if role == "student" {
 		user.Points = 100 // Initial points for students
 	}
 	
-	err := s.userRepo.CreateUser(user)
+	err = s.userRepo.CreateUser(user)
 	if err != nil {
+		// A failed sign-up must not use up a limited invite
+		if inviteCode != "" {
+			if releaseErr := s.familyService.releaseInvite(inviteCode); releaseErr != nil {
+				log.Printf("Failed to give back invite use after failed sign-up of %s: %v", username, releaseErr)
+			}
+		}
 		return nil, err
 	}
 	
 	return user, nil
 }
 
-func (s *AuthService) Login(username, password string) (*model.User, string, error) {
+func (s *AuthService) Login(username, plainPassword string) (*model.User, string, error) {
 	// Get user
 	user, err := s.userRepo.GetUserByUsername(username)
 	if err != nil {
 		return nil, "", errors.New("invalid username or password")
 	}
 	
-	// Check password (simple comparison, should use bcrypt in production)
-	if user.Password != password {
+	// Check password
+	ok, needsRehash := s.hasher.Verify(user.Password, plainPassword)
+	if !ok {
 		return nil, "", errors.New("invalid username or password")
 	}
+
+	// Transparently migrate legacy plaintext rows and outdated hashes
+	if needsRehash {
+		if hash, err := s.hasher.Hash(plainPassword); err != nil {
+			log.Printf("Failed to rehash password for user %d: %v", user.ID, err)
+		} else if err := s.userRepo.UpdatePassword(user.ID, hash); err != nil {
+			log.Printf("Failed to store rehashed password for user %d: %v", user.ID, err)
+		} else {
+			user.Password = hash
+		}
+	}
 	
 	// Generate token
 	token := generateToken()
@@ -242,6 +596,30 @@ func (s *AuthService) Login(username, password string) (*model.User, string, err
 	return user, token, nil
 }
 
+// ChangePassword verifies the old password, stores the new one and ends all
+// other sessions of the user
+func (s *AuthService) ChangePassword(userID uint, currentToken, oldPassword, newPassword string) error {
+	user, err := s.userRepo.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if ok, _ := s.hasher.Verify(user.Password, oldPassword); !ok {
+		return errors.New("old password is incorrect")
+	}
+	if err := password.Validate(newPassword, user.Username, s.passwordMinLength); err != nil {
+		return err
+	}
+
+	hash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.userRepo.UpdatePassword(user.ID, hash); err != nil {
+		return err
+	}
+	return s.sessionRepo.DeleteUserSessions(user.ID, currentToken)
+}
+
 func (s *AuthService) Logout(token string) error {
 	return s.sessionRepo.DeleteSession(token)
 }
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/password"
+	"study-quest-backend/internal/repository"
+)
+
+// flakyUserRepository fails CreateUser while failCreate is set, like a
+// database insert losing a race on the unique username
+type flakyUserRepository struct {
+	repository.IUserRepository
+	failCreate bool
+}
+
+func (r *flakyUserRepository) CreateUser(user *model.User) error {
+	if r.failCreate {
+		return errors.New("duplicate entry")
+	}
+	return r.IUserRepository.CreateUser(user)
+}
+
+func TestRegisterFailureKeepsInviteUse(t *testing.T) {
+	hasher := password.NewHasher("", 4)
+	userRepo := &flakyUserRepository{IUserRepository: repository.NewMemoryUserRepository(hasher)}
+	familyRepo := repository.NewMemoryFamilyRepository()
+	familyService := NewFamilyService(familyRepo, userRepo, repository.NewMemoryRewardRepository(), repository.NewMemoryTaskRepository())
+	auth := NewAuthService(userRepo, repository.NewMemorySessionRepository(), familyService, hasher, 8, nil)
+
+	invite, err := familyService.CreateInvite(2, "student", time.Hour, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := auth.Register("student1", "correct-horse-42", "student", "", 3, invite.Code); err == nil {
+		t.Fatal("registering a taken username succeeded")
+	}
+	userRepo.failCreate = true
+	if _, err := auth.Register("newkid", "correct-horse-42", "student", "", 3, invite.Code); err == nil {
+		t.Fatal("registering succeeded although the insert failed")
+	}
+	userRepo.failCreate = false
+
+	// The single use of the invite is still there
+	user, err := auth.Register("newkid", "correct-horse-42", "student", "", 3, invite.Code)
+	if err != nil {
+		t.Fatalf("Register with the invite after failed attempts: %v", err)
+	}
+	if user.FamilyID != invite.FamilyID {
+		t.Errorf("FamilyID = %d, want %d", user.FamilyID, invite.FamilyID)
+	}
+	if _, err := auth.Register("otherkid", "correct-horse-42", "student", "", 3, invite.Code); !errors.Is(err, repository.ErrInviteInvalid) {
+		t.Errorf("second use of a single-use invite = %v, want ErrInviteInvalid", err)
+	}
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/scheduler"
+	"time"
+)
+
+// StreakSummary is a student's run of consecutive days with at least one
+// approved task. Today only counts once something was done; until then
+// yesterday's streak is still current. Days whose submissions await review
+// and the family's skip days neither break nor extend it.
+type StreakSummary struct {
+	Current        int                    `json:"current"`
+	Longest        int                    `json:"longest"`
+	CompletedToday bool                   `json:"completed_today"`
+	StartDate      string                 `json:"start_date,omitempty"` // 当前连续记录开始的日期
+	NextMilestone  *model.StreakMilestone `json:"next_milestone,omitempty"`
+	Tasks          []TaskStreak           `json:"tasks"`
+}
+
+// TaskStreak counts consecutive approved occurrences of one recurring task
+type TaskStreak struct {
+	TaskID  uint   `json:"task_id"`
+	Title   string `json:"title"`
+	Current int    `json:"current"`
+	Longest int    `json:"longest"`
+}
+
+// GetStreaks computes the streaks of a student from the approved logs, in
+// the family's time zone and skipping the family's skip days
+func (s *TaskService) GetStreaks(studentID uint) (*StreakSummary, error) {
+	student, err := s.userRepo.GetUser(studentID)
+	if err != nil {
+		return nil, err
+	}
+	family, err := s.familyRepo.GetFamily(student.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := s.taskRepo.GetLogsByStudent(studentID)
+	if err != nil {
+		return nil, err
+	}
+	return computeStreaks(family, logs, time.Now()), nil
+}
+
+// awardStreakBonuses pays the milestone bonuses the student's current streak
+// has reached. Every milestone is paid once per streak.
+func (s *TaskService) awardStreakBonuses(studentID uint) {
+	student, err := s.userRepo.GetUser(studentID)
+	if err != nil {
+		log.Printf("Error loading student %d for streak bonuses: %v", studentID, err)
+		return
+	}
+	family, err := s.familyRepo.GetFamily(student.FamilyID)
+	if err != nil {
+		log.Printf("Error loading family %d for streak bonuses: %v", student.FamilyID, err)
+		return
+	}
+	logs, err := s.taskRepo.GetLogsByStudent(studentID)
+	if err != nil {
+		log.Printf("Error loading logs of student %d for streak bonuses: %v", studentID, err)
+		return
+	}
+
+	streak := computeStreaks(family, logs, time.Now())
+	for _, milestone := range family.Milestones() {
+		if milestone.Days > streak.Current {
+			break
+		}
+		bonus := &model.StreakBonus{
+			StudentID: studentID,
+			Days:      milestone.Days,
+			StartDate: streak.StartDate,
+			Points:    milestone.Points,
+		}
+		awarded, err := s.pointRepo.AwardStreakBonus(bonus, &model.PointTransaction{
+			UserID:     studentID,
+			SourceType: model.PointSourceStreak,
+			Delta:      milestone.Points,
+			Remark:     fmt.Sprintf("连续完成 %d 天奖励", milestone.Days),
+		})
+		if err != nil {
+			log.Printf("Error awarding %d-day streak bonus to student %d: %v", milestone.Days, studentID, err)
+			return
+		}
+		if awarded {
+			log.Printf("Awarded %d-day streak bonus of %d points to student %d", milestone.Days, milestone.Points, studentID)
+		}
+	}
+}
+
+func computeStreaks(family *model.Family, logs []model.TaskLog, now time.Time) *StreakSummary {
+	loc := family.Location()
+	today := scheduler.DateKey(now.In(loc))
+	// A bad rule was rejected when it was saved; treat it as no skip days
+	skip, _ := scheduler.ParseRule(family.StreakSkipDays)
+
+	summary := &StreakSummary{Tasks: []TaskStreak{}}
+	completed := make(map[string]bool)
+	// Days with submissions still waiting for review do not break a streak
+	pending := make(map[string]bool)
+	first := ""
+	for _, taskLog := range logs {
+		if taskLog.SubmittedAt == nil {
+			continue
+		}
+		day := scheduler.DateKey(taskLog.SubmittedAt.In(loc))
+		if taskLog.Status == model.TaskStatusPending {
+			pending[day] = true
+		}
+		if taskLog.Status != model.TaskStatusDone {
+			continue
+		}
+		completed[day] = true
+		if first == "" || day < first {
+			first = day
+		}
+	}
+
+	if first != "" {
+		run, start := 0, ""
+		day, _ := time.ParseInLocation("2006-01-02", first, loc)
+		for key := first; key <= today; key = scheduler.DateKey(day) {
+			switch {
+			case completed[key]:
+				if run == 0 {
+					start = key
+				}
+				run++
+				if run > summary.Longest {
+					summary.Longest = run
+				}
+			case key == today || pending[key] || (skip != nil && skip.Matches(day)):
+				// neither breaks nor extends the streak
+			default:
+				run = 0
+			}
+			day = day.AddDate(0, 0, 1)
+		}
+		summary.Current = run
+		summary.CompletedToday = completed[today]
+		if run > 0 {
+			summary.StartDate = start
+		}
+	}
+
+	for _, milestone := range family.Milestones() {
+		if milestone.Days > summary.Current {
+			next := milestone
+			summary.NextMilestone = &next
+			break
+		}
+	}
+	summary.Tasks = taskStreaks(logs, skip, today, loc)
+	return summary
+}
+
+// taskStreaks walks the occurrences of each recurring task in date order. A
+// missed occurrence breaks the streak unless it fell on a skip day; open
+// occurrences of today and later, pending reviews and cancellations are
+// neutral.
+func taskStreaks(logs []model.TaskLog, skip scheduler.Rule, today string, loc *time.Location) []TaskStreak {
+	var streaks []TaskStreak
+	index := make(map[uint]int)
+	for _, taskLog := range logs {
+		if taskLog.Task.Recurrence == "" || taskLog.Task.DeletedAt != nil {
+			continue
+		}
+		i, ok := index[taskLog.TaskID]
+		if !ok {
+			i = len(streaks)
+			index[taskLog.TaskID] = i
+			streaks = append(streaks, TaskStreak{TaskID: taskLog.TaskID, Title: taskLog.Task.Title})
+		}
+		streak := &streaks[i]
+
+		switch taskLog.Status {
+		case model.TaskStatusDone:
+			streak.Current++
+			if streak.Current > streak.Longest {
+				streak.Longest = streak.Current
+			}
+		case model.TaskStatusTodo, model.TaskStatusRejected:
+			if taskLog.OccurrenceDate >= today {
+				continue
+			}
+			if day, err := time.ParseInLocation("2006-01-02", taskLog.OccurrenceDate, loc); err == nil && skip != nil && skip.Matches(day) {
+				continue
+			}
+			streak.Current = 0
+		}
+	}
+	if streaks == nil {
+		return []TaskStreak{}
+	}
+	return streaks
+}
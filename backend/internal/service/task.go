@@ -0,0 +1,375 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+	"study-quest-backend/internal/scheduler"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits of the descriptive task fields
+const (
+	maxSubjectLength     = 32
+	maxDescriptionLength = 1000
+	maxEstimatedMinutes  = 600
+	maxDifficulty        = 5
+)
+
+var ErrInvalidTask = errors.New("invalid task")
+
+// TaskInput carries the editable task fields; nil fields are left unchanged
+// on update. An empty assignee list assigns the task to every child of the
+// family. Type is "study", "chore" or "habit" and defaults to study.
+type TaskInput struct {
+	Title            *string `json:"title"`
+	Points           *int    `json:"points"`
+	Type             *string `json:"type"`
+	Subject          *string `json:"subject"`
+	Description      *string `json:"description"`
+	EstimatedMinutes *int    `json:"estimated_minutes"`
+	Difficulty       *int    `json:"difficulty"`
+	DueTime          *string `json:"due_time"` // HH:MM
+	DueDate          *string `json:"due_date"` // YYYY-MM-DD, one-off tasks only
+	Recurrence       *string `json:"recurrence"`
+	AssigneeIDs      *[]uint `json:"assignee_ids"`
+}
+
+// GetFamilyTasks lists the tasks of the parent's family; archived tasks only
+// when includeArchived
+func (s *TaskService) GetFamilyTasks(parentID uint, includeArchived bool) ([]model.Task, error) {
+	parent, err := s.requireParent(parentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.taskRepo.GetTasksByFamily(parent.FamilyID, includeArchived)
+}
+
+// CreateTask creates a task for the parent's family and assigns today's
+// occurrence to its assignees
+func (s *TaskService) CreateTask(parentID uint, input TaskInput) (*model.Task, error) {
+	parent, err := s.requireParent(parentID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Title == nil || input.Points == nil {
+		return nil, fmt.Errorf("%w: title and points are required", ErrInvalidTask)
+	}
+
+	task := &model.Task{
+		Type:     model.TaskTypeStudy,
+		FamilyID: parent.FamilyID,
+	}
+	if err := s.applyTaskInput(task, input); err != nil {
+		return nil, err
+	}
+
+	// Create task
+	if err := s.taskRepo.CreateTask(task); err != nil {
+		log.Printf("Error creating task: %v", err)
+		return nil, err
+	}
+	log.Printf("Task created with ID: %d, Title: %s, Points: %d", task.ID, task.Title, task.Points)
+
+	if err := s.assignToday(task, nil); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// UpdateTask edits a task. Children removed from the assignees lose their
+// open logs; newly added children get today's occurrence. A new due date,
+// due time or recurrence moves the deadline of the open logs.
+func (s *TaskService) UpdateTask(parentID uint, taskID uint, input TaskInput) (*model.Task, error) {
+	task, err := s.ownedTask(parentID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *task
+	if err := s.applyTaskInput(&updated, input); err != nil {
+		return nil, err
+	}
+	if err := s.taskRepo.UpdateTask(&updated); err != nil {
+		return nil, err
+	}
+	if updated.DueTime != task.DueTime || updated.DueDate != task.DueDate || updated.Recurrence != task.Recurrence {
+		if err := s.rescheduleOpenLogs(&updated); err != nil {
+			return nil, err
+		}
+	}
+	if input.AssigneeIDs == nil {
+		return &updated, nil
+	}
+
+	students, err := s.userRepo.GetStudentsByFamily(updated.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	var removed, added []uint
+	for _, student := range students {
+		before, after := task.IsAssigned(student.ID), updated.IsAssigned(student.ID)
+		if before && !after {
+			removed = append(removed, student.ID)
+		}
+		if !before && after {
+			added = append(added, student.ID)
+		}
+	}
+	if len(removed) > 0 {
+		if _, err := s.taskRepo.CancelOpenLogs(updated.ID, removed); err != nil {
+			return nil, err
+		}
+	}
+	if len(added) > 0 && updated.ArchivedAt == nil {
+		if err := s.assignToday(&updated, added); err != nil {
+			return nil, err
+		}
+	}
+	return &updated, nil
+}
+
+// ArchiveTask stops a task from producing new logs, or resumes it. Open
+// logs are kept so children can still finish them unless cancelOpen is set.
+// Submissions waiting for review are never cancelled.
+func (s *TaskService) ArchiveTask(parentID uint, taskID uint, archived bool, cancelOpen bool) error {
+	task, err := s.ownedTask(parentID, taskID)
+	if err != nil {
+		return err
+	}
+	if err := s.taskRepo.SetTaskArchived(task.ID, archived); err != nil {
+		return err
+	}
+	if archived && cancelOpen {
+		_, err = s.taskRepo.CancelOpenLogs(task.ID, nil)
+	}
+	return err
+}
+
+// DeleteTask soft-deletes a task and cancels its open logs. Submissions
+// waiting for review stay in the pending list; history keeps its logs.
+func (s *TaskService) DeleteTask(parentID uint, taskID uint) error {
+	task, err := s.ownedTask(parentID, taskID)
+	if err != nil {
+		return err
+	}
+	if err := s.taskRepo.DeleteTask(task.ID); err != nil {
+		return err
+	}
+	_, err = s.taskRepo.CancelOpenLogs(task.ID, nil)
+	return err
+}
+
+// assignToday creates today's logs of task for studentIDs, or for every
+// assigned child when nil. Recurring tasks only get a log today when the
+// rule matches; the scheduler takes care of the following days.
+func (s *TaskService) assignToday(task *model.Task, studentIDs []uint) error {
+	rule, err := scheduler.ParseRule(task.Recurrence)
+	if err != nil {
+		return err
+	}
+	family, err := s.familyRepo.GetFamily(task.FamilyID)
+	if err != nil {
+		return err
+	}
+	today := time.Now().In(family.Location())
+	date := scheduler.DateKey(today)
+	if rule != nil && !rule.Matches(today) {
+		log.Printf("Task %d (%s) does not occur today, leaving it to the scheduler", task.ID, task.Recurrence)
+		return nil
+	}
+
+	students, err := s.userRepo.GetStudentsByFamily(task.FamilyID)
+	if err != nil {
+		log.Printf("Error getting students for family %d: %v", task.FamilyID, err)
+		return err
+	}
+	dueAt := scheduler.DueAt(task, date, today.Location())
+	for _, student := range students {
+		if !task.IsAssigned(student.ID) || (studentIDs != nil && !containsUint(studentIDs, student.ID)) {
+			continue
+		}
+		log.Printf("Assigning task %d to student %d (%s)", task.ID, student.ID, student.Username)
+		if _, err := s.taskRepo.AssignTaskToStudent(student.ID, task.ID, date, dueAt); err != nil {
+			log.Printf("Error assigning task to student %d: %v", student.ID, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// rescheduleOpenLogs moves the deadline of the task's open logs to match
+// its due date and time, in the family's time zone
+func (s *TaskService) rescheduleOpenLogs(task *model.Task) error {
+	family, err := s.familyRepo.GetFamily(task.FamilyID)
+	if err != nil {
+		return err
+	}
+	loc := family.Location()
+	changed, err := s.taskRepo.RescheduleOpenLogs(task.ID, func(date string) *time.Time {
+		return scheduler.DueAt(task, date, loc)
+	})
+	if err != nil {
+		return err
+	}
+	if changed > 0 {
+		log.Printf("Moved the deadline of %d open logs of task %d", changed, task.ID)
+	}
+	return nil
+}
+
+func (s *TaskService) applyTaskInput(task *model.Task, input TaskInput) error {
+	if input.Title != nil {
+		task.Title = strings.TrimSpace(*input.Title)
+	}
+	if input.Points != nil {
+		task.Points = *input.Points
+	}
+	if input.Type != nil {
+		taskType, ok := model.ParseTaskType(strings.ToLower(strings.TrimSpace(*input.Type)))
+		if !ok {
+			return fmt.Errorf("%w: type must be study, chore or habit", ErrInvalidTask)
+		}
+		task.Type = taskType
+	}
+	if input.Subject != nil {
+		task.Subject = strings.ToLower(strings.TrimSpace(*input.Subject))
+	}
+	if input.Description != nil {
+		task.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.EstimatedMinutes != nil {
+		task.EstimatedMinutes = *input.EstimatedMinutes
+	}
+	if input.Difficulty != nil {
+		task.Difficulty = *input.Difficulty
+	}
+	if input.DueTime != nil {
+		task.DueTime = strings.TrimSpace(*input.DueTime)
+	}
+	if input.DueDate != nil {
+		task.DueDate = strings.TrimSpace(*input.DueDate)
+	}
+	if input.Recurrence != nil {
+		rule, err := scheduler.ParseRule(*input.Recurrence)
+		if err != nil {
+			return err
+		}
+		task.Recurrence = ""
+		if rule != nil {
+			task.Recurrence = strings.ToLower(strings.TrimSpace(*input.Recurrence))
+		}
+	}
+	if input.AssigneeIDs != nil {
+		assignees, err := s.validateAssignees(task.FamilyID, *input.AssigneeIDs)
+		if err != nil {
+			return err
+		}
+		task.AssigneeIDs = assignees
+	}
+
+	if task.Title == "" {
+		return fmt.Errorf("%w: title is required", ErrInvalidTask)
+	}
+	if task.Points <= 0 {
+		return fmt.Errorf("%w: points must be positive", ErrInvalidTask)
+	}
+	return validateTaskDetails(task)
+}
+
+func validateTaskDetails(task *model.Task) error {
+	if utf8.RuneCountInString(task.Subject) > maxSubjectLength {
+		return fmt.Errorf("%w: subject is at most %d characters", ErrInvalidTask, maxSubjectLength)
+	}
+	if utf8.RuneCountInString(task.Description) > maxDescriptionLength {
+		return fmt.Errorf("%w: description is at most %d characters", ErrInvalidTask, maxDescriptionLength)
+	}
+	if task.EstimatedMinutes < 0 || task.EstimatedMinutes > maxEstimatedMinutes {
+		return fmt.Errorf("%w: estimated_minutes must be between 0 and %d", ErrInvalidTask, maxEstimatedMinutes)
+	}
+	if task.Difficulty < 0 || task.Difficulty > maxDifficulty {
+		return fmt.Errorf("%w: difficulty must be between 0 and %d", ErrInvalidTask, maxDifficulty)
+	}
+	if task.DueTime != "" {
+		if _, err := time.Parse("15:04", task.DueTime); err != nil {
+			return fmt.Errorf("%w: due_time must be HH:MM", ErrInvalidTask)
+		}
+	}
+	if task.DueDate != "" {
+		if task.Recurrence != "" {
+			return fmt.Errorf("%w: due_date is only for one-off tasks", ErrInvalidTask)
+		}
+		if _, err := time.Parse("2006-01-02", task.DueDate); err != nil {
+			return fmt.Errorf("%w: due_date must be YYYY-MM-DD", ErrInvalidTask)
+		}
+	}
+	return nil
+}
+
+// validateAssignees checks that every ID is a child of the family and
+// removes duplicates
+func (s *TaskService) validateAssignees(familyID uint, ids []uint) (model.UintList, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	students, err := s.userRepo.GetStudentsByFamily(familyID)
+	if err != nil {
+		return nil, err
+	}
+	var assignees model.UintList
+	for _, id := range ids {
+		found := false
+		for _, student := range students {
+			if student.ID == id {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: user %d is not a child of this family", ErrInvalidTask, id)
+		}
+		if !containsUint(assignees, id) {
+			assignees = append(assignees, id)
+		}
+	}
+	return assignees, nil
+}
+
+func (s *TaskService) requireParent(userID uint) (*model.User, error) {
+	user, err := s.userRepo.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != "parent" {
+		return nil, ErrPermissionDenied
+	}
+	return user, nil
+}
+
+// ownedTask returns a task of the parent's own family
+func (s *TaskService) ownedTask(parentID uint, taskID uint) (*model.Task, error) {
+	parent, err := s.requireParent(parentID)
+	if err != nil {
+		return nil, err
+	}
+	task, err := s.taskRepo.GetTask(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task.FamilyID != parent.FamilyID {
+		return nil, repository.ErrTaskNotFound
+	}
+	return task, nil
+}
+
+func containsUint(ids []uint, id uint) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"study-quest-backend/internal/events"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/password"
+	"study-quest-backend/internal/repository"
+)
+
+// newTestTaskService wires a TaskService to the in-memory repositories with
+// the demo family (parent1 is user 2, student1 is user 1) in timezone
+func newTestTaskService(t *testing.T, timezone string) (*TaskService, *repository.MemoryTaskRepository) {
+	t.Helper()
+	taskRepo := repository.NewMemoryTaskRepository()
+	userRepo := repository.NewMemoryUserRepository(password.NewHasher("", 4))
+	familyRepo := repository.NewMemoryFamilyRepository()
+	family, err := familyRepo.GetFamily(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	family.Timezone = timezone
+	if err := familyRepo.UpdateSettings(family); err != nil {
+		t.Fatal(err)
+	}
+	redemptionRepo := repository.NewMemoryRedemptionRepository(userRepo)
+	rewardRepo := repository.NewMemoryRewardRepository()
+	pointRepo := repository.NewMemoryPointRepository(taskRepo, userRepo, redemptionRepo, rewardRepo)
+	levels, err := NewLevelCurve(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewTaskService(taskRepo, userRepo, familyRepo, redemptionRepo, rewardRepo, pointRepo,
+		repository.NewMemoryBadgeRepository(), NewProofService(nil, 1<<20, time.Minute), levels, events.NewBus(10))
+	return service, taskRepo
+}
+
+func studentLog(t *testing.T, taskRepo repository.ITaskRepository, taskID uint) model.TaskLog {
+	t.Helper()
+	logs, err := taskRepo.GetLogsByStudent(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, log := range logs {
+		if log.TaskID == taskID {
+			return log
+		}
+	}
+	t.Fatalf("student 1 has no log of task %d", taskID)
+	return model.TaskLog{}
+}
+
+func TestTaskDeadlineUsesFamilyTimezone(t *testing.T) {
+	auckland, err := time.LoadLocation("Pacific/Auckland")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	service, taskRepo := newTestTaskService(t, "Pacific/Auckland")
+
+	title, points, dueDate, dueTime := "Read", 10, "2030-01-15", "20:00"
+	task, err := service.CreateTask(2, TaskInput{Title: &title, Points: &points, DueDate: &dueDate, DueTime: &dueTime})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2030, 1, 15, 20, 0, 0, 0, auckland)
+	if log := studentLog(t, taskRepo, task.ID); log.DueAt == nil || !log.DueAt.Equal(want) {
+		t.Fatalf("DueAt = %v, want %v", log.DueAt, want)
+	}
+
+	// Moving the deadline moves it on the open log too
+	dueDate, dueTime = "2030-01-20", "08:30"
+	if _, err := service.UpdateTask(2, task.ID, TaskInput{DueDate: &dueDate, DueTime: &dueTime}); err != nil {
+		t.Fatal(err)
+	}
+	want = time.Date(2030, 1, 20, 8, 30, 0, 0, auckland)
+	if log := studentLog(t, taskRepo, task.ID); log.DueAt == nil || !log.DueAt.Equal(want) {
+		t.Fatalf("DueAt after update = %v, want %v", log.DueAt, want)
+	}
+	if saved, err := taskRepo.GetTask(task.ID); err != nil || saved.DueDate != "2030-01-20" || saved.DueTime != "08:30" {
+		t.Fatalf("GetTask after update = %+v, %v, want due 2030-01-20 08:30", saved, err)
+	}
+
+	// Clearing both removes the deadline
+	empty := ""
+	if _, err := service.UpdateTask(2, task.ID, TaskInput{DueDate: &empty, DueTime: &empty}); err != nil {
+		t.Fatal(err)
+	}
+	if log := studentLog(t, taskRepo, task.ID); log.DueAt != nil {
+		t.Fatalf("DueAt after clearing = %v, want nil", log.DueAt)
+	}
+	if saved, err := taskRepo.GetTask(task.ID); err != nil || saved.DueDate != "" || saved.DueTime != "" {
+		t.Fatalf("GetTask after clearing = %+v, %v, want no due date or time", saved, err)
+	}
+}
+
+func TestRescheduleKeepsOverdueLogs(t *testing.T) {
+	service, taskRepo := newTestTaskService(t, "")
+
+	title, points, dueDate := "Tidy up", 5, "2020-01-01"
+	task, err := service.CreateTask(2, TaskInput{Title: &title, Points: &points, DueDate: &dueDate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.MarkOverdueTasks(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	before := studentLog(t, taskRepo, task.ID)
+	if before.OverdueAt == nil {
+		t.Fatal("the log was not marked overdue")
+	}
+
+	dueDate = "2030-01-01"
+	if _, err := service.UpdateTask(2, task.ID, TaskInput{DueDate: &dueDate}); err != nil {
+		t.Fatal(err)
+	}
+	if after := studentLog(t, taskRepo, task.ID).DueAt; after == nil || !after.Equal(*before.DueAt) {
+		t.Fatalf("DueAt of an overdue log = %v, want it kept at %v", after, before.DueAt)
+	}
+}
+
+// Today's list follows the family's calendar, not the server's
+func TestTodayTasksUseFamilyDate(t *testing.T) {
+	serverDate := time.Now().Format("2006-01-02")
+	timezone := ""
+	// Between them these zones are on another date than the server at any hour
+	for _, name := range []string{"Pacific/Auckland", "Pacific/Kiritimati", "Pacific/Pago_Pago"} {
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			t.Skip("no time zone database:", err)
+		}
+		if time.Now().In(loc).Format("2006-01-02") != serverDate {
+			timezone = name
+			break
+		}
+	}
+	if timezone == "" {
+		t.Skip("the server is on the same date as every test time zone")
+	}
+	service, taskRepo := newTestTaskService(t, timezone)
+
+	title, points, recurrence := "Practice piano", 10, "daily"
+	task, err := service.CreateTask(2, TaskInput{Title: &title, Points: &points, Recurrence: &recurrence})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The occurrence on the server's date belongs to another family day
+	if _, err := taskRepo.AssignTaskToStudent(1, task.ID, serverDate, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	logs, err := service.GetTodayTasks(1, repository.TaskFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loc, _ := time.LoadLocation(timezone)
+	familyDate := time.Now().In(loc).Format("2006-01-02")
+	var dates []string
+	for _, log := range logs {
+		if log.TaskID == task.ID {
+			dates = append(dates, log.OccurrenceDate)
+		}
+	}
+	if len(dates) != 1 || dates[0] != familyDate {
+		t.Fatalf("%s: today's logs of the task are on %v, want only %s", timezone, dates, familyDate)
+	}
+}
@@ -0,0 +1,546 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"study-quest-backend/internal/events"
+	"study-quest-backend/internal/model"
+	"study-quest-backend/internal/repository"
+	"syscall"
+	"time"
+)
+
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// errWebhookAddress is returned when a webhook host resolves to an address
+// of the server's own networks
+var errWebhookAddress = errors.New("webhook address is not allowed")
+
+// blockedWebhookNetworks are refused in addition to the loopback, private,
+// link-local, multicast and unspecified addresses
+var blockedWebhookNetworks = []*net.IPNet{
+	mustCIDR("0.0.0.0/8"),     // "this network"
+	mustCIDR("100.64.0.0/10"), // carrier-grade NAT
+	mustCIDR("192.0.0.0/24"),  // IETF protocol assignments
+	mustCIDR("198.18.0.0/15"), // benchmarking
+	mustCIDR("240.0.0.0/4"),   // reserved, including broadcast
+	mustCIDR("64:ff9b::/96"),  // NAT64, which can reach IPv4 internals
+}
+
+const (
+	maxWebhooksPerFamily = 10
+	maxWebhookURLLength  = 512
+	maxDeliveryError     = 500
+	// maxWebhookAttempts caps webhooks.max_attempts; with the backoff
+	// doubling the delay every time, more attempts would never be reached
+	maxWebhookAttempts = 20
+	// maxWebhookRetryDelay caps the doubled delay between two attempts
+	maxWebhookRetryDelay = 24 * time.Hour
+	// deliveryBatchSize is how many due deliveries one run sends
+	deliveryBatchSize = 50
+)
+
+// Webhook request headers. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the webhook's secret.
+const (
+	WebhookEventHeader     = "X-StudyQuest-Event"
+	WebhookDeliveryHeader  = "X-StudyQuest-Delivery"
+	WebhookTimestampHeader = "X-StudyQuest-Timestamp"
+	WebhookSignatureHeader = "X-StudyQuest-Signature"
+)
+
+// WebhookInput carries the editable webhook fields; nil fields are left
+// unchanged on update
+type WebhookInput struct {
+	URL         *string  `json:"url"`
+	Events      []string `json:"events"` // event types to send; empty sends all
+	Description *string  `json:"description"`
+	Enabled     *bool    `json:"enabled"`
+	// RotateSecret replaces the signing secret on update
+	RotateSecret bool `json:"rotate_secret"`
+}
+
+// WebhookService manages the families' webhooks and delivers the events
+// published on the bus to them. Deliveries are queued in the repository and
+// sent by a scheduler job, which retries failures with exponential backoff.
+type WebhookService struct {
+	webhookRepo repository.IWebhookRepository
+	userRepo    repository.IUserRepository
+	client      *http.Client
+	maxAttempts int
+	retryDelay  time.Duration
+	retention   time.Duration
+	// allowPrivate lets webhooks reach loopback and private addresses, for
+	// local development only
+	allowPrivate bool
+}
+
+// NewWebhookService delivers to public addresses only unless allowPrivate
+// is set. The check is made when a URL is saved and again on every
+// connection, so a host that later resolves to an internal address (DNS
+// rebinding) is refused as well; redirects are not followed.
+func NewWebhookService(webhookRepo repository.IWebhookRepository, userRepo repository.IUserRepository, timeout time.Duration, maxAttempts int, retryDelay time.Duration, retention time.Duration, allowPrivate bool) *WebhookService {
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	if maxAttempts > maxWebhookAttempts {
+		maxAttempts = maxWebhookAttempts
+	}
+	s := &WebhookService{
+		webhookRepo:  webhookRepo,
+		userRepo:     userRepo,
+		maxAttempts:  maxAttempts,
+		retryDelay:   retryDelay,
+		retention:    retention,
+		allowPrivate: allowPrivate,
+	}
+	dialer := &net.Dialer{Timeout: timeout, Control: s.checkDial}
+	s.client = &http.Client{
+		Timeout: timeout,
+		// No Proxy: a proxy would make the dial check see the proxy's
+		// address instead of the webhook's
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// The 3xx response is returned and counted as a failure
+			return http.ErrUseLastResponse
+		},
+	}
+	return s
+}
+
+// ListWebhooks returns the webhooks of the parent's family
+func (s *WebhookService) ListWebhooks(parentID uint) ([]model.Webhook, error) {
+	parent, err := s.requireParent(parentID)
+	if err != nil {
+		return nil, err
+	}
+	return s.webhookRepo.GetWebhooksByFamily(parent.FamilyID)
+}
+
+// CreateWebhook adds an enabled webhook with a new signing secret
+func (s *WebhookService) CreateWebhook(parentID uint, input WebhookInput) (*model.Webhook, error) {
+	parent, err := s.requireParent(parentID)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.webhookRepo.GetWebhooksByFamily(parent.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= maxWebhooksPerFamily {
+		return nil, fmt.Errorf("%w: a family can have at most %d webhooks", ErrInvalidWebhook, maxWebhooksPerFamily)
+	}
+
+	webhook := &model.Webhook{FamilyID: parent.FamilyID, Enabled: true, Secret: newWebhookSecret()}
+	if err := s.applyWebhookInput(webhook, input); err != nil {
+		return nil, err
+	}
+	if webhook.URL == "" {
+		return nil, fmt.Errorf("%w: url is required", ErrInvalidWebhook)
+	}
+	if err := s.webhookRepo.CreateWebhook(webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+func (s *WebhookService) UpdateWebhook(parentID uint, webhookID uint, input WebhookInput) (*model.Webhook, error) {
+	webhook, err := s.ownedWebhook(parentID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyWebhookInput(webhook, input); err != nil {
+		return nil, err
+	}
+	if input.RotateSecret {
+		webhook.Secret = newWebhookSecret()
+	}
+	if err := s.webhookRepo.UpdateWebhook(webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook removes the webhook and its delivery log
+func (s *WebhookService) DeleteWebhook(parentID uint, webhookID uint) error {
+	if _, err := s.ownedWebhook(parentID, webhookID); err != nil {
+		return err
+	}
+	return s.webhookRepo.DeleteWebhook(webhookID)
+}
+
+// GetDeliveries returns the newest entries of the webhook's delivery log
+func (s *WebhookService) GetDeliveries(parentID uint, webhookID uint, limit int) ([]model.WebhookDelivery, error) {
+	if _, err := s.ownedWebhook(parentID, webhookID); err != nil {
+		return nil, err
+	}
+	return s.webhookRepo.GetDeliveries(webhookID, limit)
+}
+
+// TestWebhook sends a ping event right away, even to a disabled webhook,
+// and returns the logged delivery. Pings are not retried.
+func (s *WebhookService) TestWebhook(parentID uint, webhookID uint) (*model.WebhookDelivery, error) {
+	webhook, err := s.ownedWebhook(parentID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(events.Event{
+		Type:      events.Ping,
+		FamilyID:  webhook.FamilyID,
+		Data:      map[string]uint{"webhook_id": webhook.ID},
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	delivery := &model.WebhookDelivery{
+		WebhookID: webhook.ID,
+		EventType: events.Ping,
+		Payload:   string(payload),
+		Status:    model.WebhookDeliveryPending,
+	}
+	if err := s.webhookRepo.CreateDelivery(delivery); err != nil {
+		return nil, err
+	}
+	s.attempt(delivery, webhook, time.Now(), false)
+	if err := s.webhookRepo.UpdateDelivery(delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// Enqueue queues event for every enabled webhook of its family that
+// subscribed to its type. It is registered as a listener on the event bus.
+func (s *WebhookService) Enqueue(event events.Event) {
+	webhooks, err := s.webhookRepo.GetWebhooksByFamily(event.FamilyID)
+	if err != nil {
+		log.Printf("Error loading webhooks of family %d: %v", event.FamilyID, err)
+		return
+	}
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !webhook.Enabled || !webhookWants(&webhook, event.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				log.Printf("Error encoding event %d for webhooks: %v", event.ID, err)
+				return
+			}
+		}
+		now := time.Now()
+		err := s.webhookRepo.CreateDelivery(&model.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        model.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+		})
+		if err != nil {
+			log.Printf("Error queueing event %d for webhook %d: %v", event.ID, webhook.ID, err)
+		}
+	}
+}
+
+// DeliverDue sends the queued deliveries that are due. It runs as a
+// scheduler job; a delivery is claimed before it is sent so that it is not
+// sent twice when several instances run the job.
+func (s *WebhookService) DeliverDue(now time.Time) error {
+	deliveries, err := s.webhookRepo.GetDueDeliveries(now, deliveryBatchSize)
+	if err != nil {
+		return err
+	}
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		lease := time.Now().Add(s.client.Timeout + time.Minute)
+		claimed, err := s.webhookRepo.ClaimDelivery(delivery.ID, now, lease)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		s.attempt(delivery, &delivery.Webhook, time.Now(), true)
+		if err := s.webhookRepo.UpdateDelivery(delivery); err != nil {
+			log.Printf("Error saving webhook delivery %d: %v", delivery.ID, err)
+		}
+	}
+	return nil
+}
+
+// PurgeDeliveries drops finished deliveries older than the retention
+func (s *WebhookService) PurgeDeliveries(now time.Time) error {
+	if s.retention <= 0 {
+		return nil
+	}
+	return s.webhookRepo.DeleteDeliveriesBefore(now.Add(-s.retention))
+}
+
+// attempt sends delivery once and records the outcome on it. A failure is
+// retried after retryDelay, doubled with every attempt, until maxAttempts;
+// without retry it fails right away. Queued deliveries of a webhook that
+// was disabled meanwhile fail without being sent.
+func (s *WebhookService) attempt(delivery *model.WebhookDelivery, webhook *model.Webhook, now time.Time, retry bool) {
+	var statusCode int
+	var err error
+	if retry && !webhook.Enabled {
+		err = errors.New("webhook is disabled")
+	} else {
+		delivery.Attempts++
+		statusCode, err = s.send(delivery, webhook, now)
+	}
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	if err == nil {
+		delivery.Status = model.WebhookDeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.NextAttemptAt = nil
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if len(delivery.LastError) > maxDeliveryError {
+		delivery.LastError = delivery.LastError[:maxDeliveryError]
+	}
+	if !retry || !webhook.Enabled || delivery.Attempts >= s.maxAttempts {
+		delivery.Status = model.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+		log.Printf("Webhook delivery %d to webhook %d failed after %d attempts: %v", delivery.ID, webhook.ID, delivery.Attempts, err)
+		return
+	}
+	next := now.Add(s.backoff(delivery.Attempts))
+	delivery.NextAttemptAt = &next
+}
+
+// backoff is the delay after the given number of failed attempts:
+// retryDelay doubled for every attempt after the first, at most
+// maxWebhookRetryDelay
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	delay := s.retryDelay
+	for i := 1; i < attempts && delay < maxWebhookRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxWebhookRetryDelay {
+		delay = maxWebhookRetryDelay
+	}
+	return delay
+}
+
+// send posts the payload signed with the webhook's secret; any status
+// other than 2xx is an error
+func (s *WebhookService) send(delivery *model.WebhookDelivery, webhook *model.Webhook, now time.Time) (int, error) {
+	if webhook.ID == 0 {
+		return 0, errors.New("webhook no longer exists")
+	}
+	body := []byte(delivery.Payload)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "StudyQuest-Webhook/1.0")
+	req.Header.Set(WebhookEventHeader, delivery.EventType)
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(webhook.Secret, timestamp, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>"
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *WebhookService) requireParent(userID uint) (*model.User, error) {
+	user, err := s.userRepo.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role != "parent" {
+		return nil, ErrPermissionDenied
+	}
+	return user, nil
+}
+
+// ownedWebhook returns a webhook of the parent's family; other families'
+// webhooks are reported as not found
+func (s *WebhookService) ownedWebhook(parentID uint, webhookID uint) (*model.Webhook, error) {
+	parent, err := s.requireParent(parentID)
+	if err != nil {
+		return nil, err
+	}
+	webhook, err := s.webhookRepo.GetWebhook(webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if webhook.FamilyID != parent.FamilyID {
+		return nil, repository.ErrWebhookNotFound
+	}
+	return webhook, nil
+}
+
+func (s *WebhookService) applyWebhookInput(webhook *model.Webhook, input WebhookInput) error {
+	if input.URL != nil {
+		rawURL := strings.TrimSpace(*input.URL)
+		u, err := url.Parse(rawURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			return fmt.Errorf("%w: url must be an http(s) URL", ErrInvalidWebhook)
+		}
+		if u.User != nil {
+			return fmt.Errorf("%w: url must not contain credentials", ErrInvalidWebhook)
+		}
+		if len(rawURL) > maxWebhookURLLength {
+			return fmt.Errorf("%w: url is longer than %d characters", ErrInvalidWebhook, maxWebhookURLLength)
+		}
+		if err := s.checkHost(u.Hostname()); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+		}
+		webhook.URL = rawURL
+	}
+	if input.Events != nil {
+		var types []string
+		for _, eventType := range input.Events {
+			eventType = strings.TrimSpace(eventType)
+			if !isEventType(eventType) {
+				return fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, eventType)
+			}
+			if !containsString(types, eventType) {
+				types = append(types, eventType)
+			}
+		}
+		webhook.Events = strings.Join(types, ",")
+	}
+	if input.Description != nil {
+		webhook.Description = strings.TrimSpace(*input.Description)
+	}
+	if input.Enabled != nil {
+		webhook.Enabled = *input.Enabled
+	}
+	return nil
+}
+
+// checkHost resolves host and refuses it when any of its addresses is one
+// of the server's own networks
+func (s *WebhookService) checkHost(host string) error {
+	if s.allowPrivate {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if !publicAddress(ip) {
+			return errWebhookAddress
+		}
+		return nil
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return errWebhookAddress
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s", host)
+	}
+	for _, addr := range addrs {
+		if !publicAddress(addr.IP) {
+			return errWebhookAddress
+		}
+	}
+	return nil
+}
+
+// checkDial is the dialer's Control hook: it sees the address actually
+// being connected to, after name resolution
+func (s *WebhookService) checkDial(network string, address string, conn syscall.RawConn) error {
+	if s.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !publicAddress(ip) {
+		return fmt.Errorf("%w: %s", errWebhookAddress, host)
+	}
+	return nil
+}
+
+// publicAddress reports whether ip may be reached by a webhook
+func publicAddress(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range blockedWebhookNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+func webhookWants(webhook *model.Webhook, eventType string) bool {
+	return webhook.Events == "" || containsString(strings.Split(webhook.Events, ","), eventType)
+}
+
+func isEventType(eventType string) bool {
+	return containsString(events.Types, eventType)
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newWebhookSecret() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocal(t *testing.T) (*Local, http.Handler) {
+	t.Helper()
+	l, err := NewLocal(t.TempDir(), "/files", []byte("test-signing-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Put(context.Background(), "proofs/1/a.jpg", []byte("jpeg"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	return l, http.StripPrefix("/files", l)
+}
+
+func get(handler http.Handler, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+	return w
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	l, handler := newTestLocal(t)
+	signed, err := l.SignedURL("proofs/1/a.jpg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(signed, "/files/proofs/1/a.jpg?") {
+		t.Fatalf("SignedURL = %s", signed)
+	}
+	if w := get(handler, signed); w.Code != http.StatusOK || w.Body.String() != "jpeg" {
+		t.Fatalf("GET signed URL = %d %q", w.Code, w.Body.String())
+	}
+	if _, err := l.SignedURL("../etc/passwd", time.Minute); err != ErrInvalidKey {
+		t.Errorf("SignedURL with .. = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestLocalSignedURLExpires(t *testing.T) {
+	l, handler := newTestLocal(t)
+	signed, err := l.SignedURL("proofs/1/a.jpg", -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get(handler, signed); w.Code != http.StatusForbidden {
+		t.Fatalf("GET expired URL = %d, want 403", w.Code)
+	}
+
+	// Extending the expiry invalidates the signature
+	u, _ := url.Parse(signed)
+	query := u.Query()
+	query.Set("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	u.RawQuery = query.Encode()
+	if w := get(handler, u.String()); w.Code != http.StatusForbidden {
+		t.Fatalf("GET URL with a later expiry = %d, want 403", w.Code)
+	}
+}
+
+func TestLocalSignedURLTampered(t *testing.T) {
+	l, handler := newTestLocal(t)
+	if err := l.Put(context.Background(), "proofs/2/b.jpg", []byte("other"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := l.SignedURL("proofs/1/a.jpg", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(signed)
+	signature := u.Query().Get("signature")
+
+	other, _ := NewLocal(t.TempDir(), "/files", []byte("another-key"))
+	foreign, _ := other.SignedURL("proofs/1/a.jpg", time.Minute)
+
+	tests := map[string]string{
+		"other key":          strings.Replace(signed, "proofs/1/a.jpg", "proofs/2/b.jpg", 1),
+		"flipped signature":  strings.Replace(signed, signature, flipHex(signature), 1),
+		"no signature":       "/files/proofs/1/a.jpg?expires=" + u.Query().Get("expires"),
+		"no expiry":          "/files/proofs/1/a.jpg?signature=" + signature,
+		"signed by another":  foreign,
+		"path traversal":     strings.Replace(signed, "proofs/1/a.jpg", "proofs/1/../1/a.jpg", 1),
+		"not a number":       strings.Replace(signed, "expires=", "expires=x", 1),
+		"truncated":          strings.Replace(signed, signature, signature[:32], 1),
+		"unsigned directory": "/files/proofs/1?expires=9999999999&signature=" + signature,
+	}
+	for name, target := range tests {
+		if w := get(handler, target); w.Code != http.StatusForbidden {
+			t.Errorf("%s: GET %s = %d, want 403", name, target, w.Code)
+		}
+	}
+}
+
+func flipHex(s string) string {
+	last := s[len(s)-1]
+	if last == '0' {
+		return s[:len(s)-1] + "1"
+	}
+	return s[:len(s)-1] + "0"
+}